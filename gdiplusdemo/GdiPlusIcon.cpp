@@ -3,6 +3,9 @@
 #pragma comment (lib, "Gdiplus.lib")
 #pragma comment (lib, "Msimg32.lib") // AlphaBlend
 
+#include <algorithm>
+#include <cmath>
+
 // DIBBuf is an interoperability buffer between GDI+ and GDI.
 //
 // Using DIBBuf to paint using GDI+ in an HDC can be faster
@@ -116,7 +119,8 @@ private:
 ////////////////////////////////////////////////////////////////////////////////
 
 GdiPlusIconEngine::GdiPlusIconEngine() :
-	m_solidBrush(Gdiplus::Color(0, 0, 0, 0)) {
+	m_solidBrush(Gdiplus::Color(0, 0, 0, 0)),
+	m_pen(Gdiplus::Color(0, 0, 0, 0)) {
 }
 
 void GdiPlusIconEngine::DrawIconEx(bool direct, HDC hdc, RECT const* rr,
@@ -203,11 +207,29 @@ GdiPlusIconEngine::DIBBuf& GdiPlusIconEngine::DrawIconBuf(SIZE size,
 void GdiPlusIconEngine::DrawIconImpl(vectoricon::Icon const& icon) {
 	m_currentPathIdx = 1;
 
+	// initial program style
+	m_solidBrush.SetColor(Gdiplus::Color(255, 0, 0, 0));
+	m_fillBrush = &m_solidBrush;
+	m_fill = true;
+	m_fillMode = Gdiplus::FillModeWinding;
+	m_stroke = false;
+	m_pen.SetWidth(1.f);
+	m_pen.SetLineCap(Gdiplus::LineCapFlat, Gdiplus::LineCapFlat, Gdiplus::DashCapFlat);
+	m_pen.SetLineJoin(Gdiplus::LineJoinMiterClipped);
+	m_pen.SetMiterLimit(4.f);
+
 	if (m_colorOverride == nullptr) {
 		icon.Draw(this, (uint16_t)m_dx, (uint16_t)m_dy, m_palIdx);
 	} else {
 		icon.Draw(this, (uint16_t)m_dx, (uint16_t)m_dy, m_palIdx, *m_colorOverride);
 	}
+
+	// Restore the clip region of programs with unbalanced clips.
+	if (!m_clipStates.empty()) {
+		m_gr->Restore(m_clipStates.front());
+		m_clipStates.clear();
+	}
+	m_clipRegion.reset();
 }
 
 void GdiPlusIconEngine::DebugSinglePath(size_t n) {
@@ -221,6 +243,8 @@ void GdiPlusIconEngine::ViewBox(float xmin, float ymin, float xmax, float ymax)
 	float yscale = float(m_dy)/vy;
 	Gdiplus::Matrix m(xscale, 0.f, 0.f, yscale, m_ox-xmin, m_oy-ymin);
 	m_gr->SetTransform(&m);
+
+	m_viewBox = Gdiplus::RectF(xmin, ymin, vx, vy);
 }
 
 void GdiPlusIconEngine::Colorize(uint8_t& /*r*/, uint8_t& /*g*/, uint8_t& /*b*/) {
@@ -229,12 +253,229 @@ void GdiPlusIconEngine::Colorize(uint8_t& /*r*/, uint8_t& /*g*/, uint8_t& /*b*/)
 void GdiPlusIconEngine::SetSolidFill(uint8_t r, uint8_t g, uint8_t b, uint8_t a) {
 	Colorize(r, g, b);
 	m_solidBrush.SetColor(Gdiplus::Color(a, r, g, b));
+	m_fillBrush = &m_solidBrush;
+	m_fill = true;
 }
 
-void GdiPlusIconEngine::MoveTo(vectoricon::Point p) {
-	if (m_hasPath) {
-		m_path.CloseFigure();
+namespace {
+
+// gradientColor returns the color of gradient g at offset t.
+Gdiplus::Color gradientColor(vectoricon::Gradient const& g, float t) {
+	switch (g.spread) {
+	case vectoricon::Spread::Repeat:
+		t -= std::floor(t);
+		break;
+	case vectoricon::Spread::Reflect:
+		t = std::abs(t - 2.f*std::floor(t/2.f + .5f));
+		break;
+	}
+
+	auto const& s = g.stops;
+	size_t i = 0;
+	while (i < s.size() && s[i].offset <= t) {
+		i++;
+	}
+
+	vectoricon::RGBA c;
+	if (i == 0) {
+		c = s.front().color;
+	} else if (i == s.size()) {
+		c = s.back().color;
+	} else {
+		auto const& a = s[i-1];
+		auto const& b = s[i];
+		float f = (t - a.offset) / (b.offset - a.offset);
+		auto mix = [f](uint8_t x, uint8_t y) {
+			return uint8_t(float(x) + (float(y) - float(x))*f + .5f);
+		};
+		c = {
+			mix(a.color.r, b.color.r),
+			mix(a.color.g, b.color.g),
+			mix(a.color.b, b.color.b),
+			mix(a.color.a, b.color.a),
+		};
+	}
+	return Gdiplus::Color(c.a, c.r, c.g, c.b);
+}
+
+// gradientSamples samples the colors of gradient g at offsets
+// evenly spaced in [t0, t1] for GDI+ interpolation colors.
+// If reverse is set, positions run from t1 to t0.
+void gradientSamples(vectoricon::Gradient const& g, float t0, float t1, bool reverse,
+		std::vector<Gdiplus::Color>& colors, std::vector<Gdiplus::REAL>& pos) {
+	size_t n = 2 + size_t(32.f * (t1 - t0));
+	if (n > 1024) {
+		n = 1024;
+	}
+
+	colors.clear();
+	pos.clear();
+	for (size_t i = 0; i < n; i++) {
+		float p = float(i) / float(n-1);
+		float t = reverse ? t1 - p*(t1 - t0) : t0 + p*(t1 - t0);
+		colors.push_back(gradientColor(g, t));
+		pos.push_back(p);
+	}
+}
+
+} // end namespace
+
+// gradientSpace sets up m to map gradient space of g to view box coordinates,
+// and transforms the view box corners into gradient space.
+bool GdiPlusIconEngine::gradientSpace(vectoricon::Gradient const& g,
+		Gdiplus::Matrix& m, Gdiplus::PointF* corners) {
+	auto const* v = g.matrix;
+	m.SetElements(v[0], v[1], v[2], v[3], v[4], v[5]);
+	if (!m.IsInvertible()) {
+		return false;
 	}
+
+	Gdiplus::Matrix inv;
+	inv.SetElements(v[0], v[1], v[2], v[3], v[4], v[5]);
+	inv.Invert();
+
+	auto const& r = m_viewBox;
+	corners[0] = {r.X, r.Y};
+	corners[1] = {r.X + r.Width, r.Y};
+	corners[2] = {r.X, r.Y + r.Height};
+	corners[3] = {r.X + r.Width, r.Y + r.Height};
+	inv.TransformPoints(corners, 4);
+	return true;
+}
+
+void GdiPlusIconEngine::SetLinearGradientFill(vectoricon::Gradient const& g) {
+	using namespace Gdiplus;
+
+	Matrix m;
+	PointF corners[4];
+	if (!gradientSpace(g, m, corners)) {
+		m_fill = false;
+		return;
+	}
+
+	// The brush covers the view box, so that
+	// spread methods can be applied when sampling.
+	float t0 = 0.f, t1 = 1.f;
+	for (auto const& p : corners) {
+		t0 = (std::min)(t0, p.X);
+		t1 = (std::max)(t1, p.X);
+	}
+
+	std::vector<Color> colors;
+	std::vector<REAL> pos;
+	gradientSamples(g, t0, t1, false, colors, pos);
+
+	auto b = std::make_unique<LinearGradientBrush>(
+		PointF(t0, 0.f), PointF(t1, 0.f), colors.front(), colors.back());
+	b->SetInterpolationColors(colors.data(), pos.data(), (INT)colors.size());
+	b->SetWrapMode(WrapModeTileFlipX);
+	b->MultiplyTransform(&m, MatrixOrderAppend);
+
+	m_fillBrush = b.get();
+	m_gradientBrush = std::move(b);
+	m_fill = true;
+}
+
+void GdiPlusIconEngine::SetRadialGradientFill(vectoricon::Gradient const& g) {
+	using namespace Gdiplus;
+
+	Matrix m;
+	PointF corners[4];
+	if (!gradientSpace(g, m, corners)) {
+		m_fill = false;
+		return;
+	}
+
+	Matrix inv;
+	inv.SetElements(g.matrix[0], g.matrix[1], g.matrix[2],
+		g.matrix[3], g.matrix[4], g.matrix[5]);
+	inv.Invert();
+	PointF focal(g.focal.x, g.focal.y);
+	inv.TransformPoints(&focal, 1);
+
+	// The brush ellipse covers the view box. Offsets on its boundary
+	// are approximated with its radius.
+	float radius = 1.f;
+	for (auto const& p : corners) {
+		radius = (std::max)(radius, std::sqrt(p.X*p.X + p.Y*p.Y));
+	}
+
+	std::vector<Color> colors;
+	std::vector<REAL> pos;
+	gradientSamples(g, 0.f, radius, true, colors, pos);
+
+	GraphicsPath path;
+	path.AddEllipse(-radius, -radius, 2*radius, 2*radius);
+
+	auto b = std::make_unique<PathGradientBrush>(&path);
+	b->SetCenterPoint(focal);
+	b->SetInterpolationColors(colors.data(), pos.data(), (INT)colors.size());
+	b->SetTransform(&m);
+
+	m_fillBrush = b.get();
+	m_gradientBrush = std::move(b);
+	m_fill = true;
+}
+
+void GdiPlusIconEngine::SetNoFill() {
+	m_fill = false;
+}
+
+void GdiPlusIconEngine::SetFillRule(vectoricon::FillRule r) {
+	if (r == vectoricon::FillRule::EvenOdd) {
+		m_fillMode = Gdiplus::FillModeAlternate;
+	} else {
+		m_fillMode = Gdiplus::FillModeWinding;
+	}
+}
+
+void GdiPlusIconEngine::SetSolidStroke(uint8_t r, uint8_t g, uint8_t b, uint8_t a) {
+	Colorize(r, g, b);
+	m_pen.SetColor(Gdiplus::Color(a, r, g, b));
+	m_stroke = true;
+}
+
+void GdiPlusIconEngine::SetNoStroke() {
+	m_stroke = false;
+}
+
+void GdiPlusIconEngine::SetStrokeWidth(float w) {
+	m_pen.SetWidth(w);
+}
+
+void GdiPlusIconEngine::SetLineCap(vectoricon::LineCap c) {
+	Gdiplus::LineCap lc = Gdiplus::LineCapFlat;
+	switch (c) {
+	case vectoricon::LineCap::Round:
+		lc = Gdiplus::LineCapRound;
+		break;
+	case vectoricon::LineCap::Square:
+		lc = Gdiplus::LineCapSquare;
+		break;
+	}
+	m_pen.SetLineCap(lc, lc, Gdiplus::DashCapFlat);
+}
+
+void GdiPlusIconEngine::SetLineJoin(vectoricon::LineJoin j) {
+	Gdiplus::LineJoin lj = Gdiplus::LineJoinMiterClipped;
+	switch (j) {
+	case vectoricon::LineJoin::Round:
+		lj = Gdiplus::LineJoinRound;
+		break;
+	case vectoricon::LineJoin::Bevel:
+		lj = Gdiplus::LineJoinBevel;
+		break;
+	}
+	m_pen.SetLineJoin(lj);
+}
+
+void GdiPlusIconEngine::SetMiterLimit(float limit) {
+	m_pen.SetMiterLimit(limit);
+}
+
+void GdiPlusIconEngine::MoveTo(vectoricon::Point p) {
+	// Figures are left open unless closed by CloseFigure,
+	// FillPath closes them implicitly.
 	m_path.StartFigure();
 
 	m_cursor = p;
@@ -293,9 +534,11 @@ void GdiPlusIconEngine::QuadraticBezierTo(std::vector<vectoricon::Point> const&
 	m_hasPath = true;
 }
 
-void GdiPlusIconEngine::ClosePath() {
+void GdiPlusIconEngine::CloseFigure() {
 	m_path.CloseFigure();
+}
 
+void GdiPlusIconEngine::ClosePath() {
 	if (m_hasPath) {
 		if (m_currentPathIdx == m_debugPathIdx) {
 			Gdiplus::PathData pd;
@@ -303,7 +546,13 @@ void GdiPlusIconEngine::ClosePath() {
 		}
 
 		if (m_debugPathIdx == 0 || m_currentPathIdx == m_debugPathIdx) {
-			m_gr->FillPath(&m_solidBrush, &m_path);
+			if (m_fill) {
+				m_path.SetFillMode(m_fillMode);
+				m_gr->FillPath(m_fillBrush, &m_path);
+			}
+			if (m_stroke) {
+				m_gr->DrawPath(&m_pen, &m_path);
+			}
 		}
 
 		m_currentPathIdx++;
@@ -314,6 +563,45 @@ void GdiPlusIconEngine::ClosePath() {
 	m_hasPath = false;
 }
 
+void GdiPlusIconEngine::PushClip(vectoricon::FillRule r) {
+	m_clipStates.push_back(m_gr->Save());
+
+	m_clipRegion = std::make_unique<Gdiplus::Region>();
+	m_clipRegion->MakeEmpty();
+
+	if (r == vectoricon::FillRule::EvenOdd) {
+		m_clipMode = Gdiplus::FillModeAlternate;
+	} else {
+		m_clipMode = Gdiplus::FillModeWinding;
+	}
+}
+
+void GdiPlusIconEngine::ClipPath() {
+	if (m_hasPath && m_clipRegion != nullptr) {
+		// Regions use world coordinates like paths.
+		m_path.SetFillMode(m_clipMode);
+		m_clipRegion->Union(&m_path);
+	}
+
+	m_path.Reset();
+
+	m_hasPath = false;
+}
+
+void GdiPlusIconEngine::EndClip() {
+	if (m_clipRegion != nullptr) {
+		m_gr->SetClip(m_clipRegion.get(), Gdiplus::CombineModeIntersect);
+		m_clipRegion.reset();
+	}
+}
+
+void GdiPlusIconEngine::PopClip() {
+	if (!m_clipStates.empty()) {
+		m_gr->Restore(m_clipStates.back());
+		m_clipStates.pop_back();
+	}
+}
+
 std::pair<const Gdiplus::PointF*, INT>
 GdiPlusIconEngine::convertPoints(std::vector<vectoricon::Point> const& pts) {
 	m_ptbuf.clear();
@@ -30,11 +30,26 @@ public:
 	// vectoricon::DrawEngine overrides
 	void ViewBox(float xmin, float ymin, float xmax, float ymax) override;
 	void SetSolidFill(uint8_t r, uint8_t g, uint8_t b, uint8_t a) override;
+	void SetNoFill() override;
+	void SetFillRule(vectoricon::FillRule r) override;
+	void SetLinearGradientFill(vectoricon::Gradient const& g) override;
+	void SetRadialGradientFill(vectoricon::Gradient const& g) override;
+	void SetSolidStroke(uint8_t r, uint8_t g, uint8_t b, uint8_t a) override;
+	void SetNoStroke() override;
+	void SetStrokeWidth(float w) override;
+	void SetLineCap(vectoricon::LineCap c) override;
+	void SetLineJoin(vectoricon::LineJoin j) override;
+	void SetMiterLimit(float limit) override;
 	void MoveTo(vectoricon::Point p) override;
 	void LineTo(std::vector<vectoricon::Point> const& p) override;
 	void CubicBezierTo(std::vector<vectoricon::Point> const& p) override;
 	void QuadraticBezierTo(std::vector<vectoricon::Point> const& p) override;
+	void CloseFigure() override;
 	void ClosePath() override;
+	void PushClip(vectoricon::FillRule r) override;
+	void ClipPath() override;
+	void EndClip() override;
+	void PopClip() override;
 
 	void DebugSinglePath(size_t n);
 
@@ -47,14 +62,27 @@ private:
 	std::pair<const Gdiplus::PointF*, INT>
 		convertPoints(std::vector<vectoricon::Point> const& pts);
 
+	bool gradientSpace(vectoricon::Gradient const& g,
+		Gdiplus::Matrix& m, Gdiplus::PointF* corners);
+
 private:
 	std::unordered_map<uint32_t, std::shared_ptr<DIBBuf>> m_dibs;
 
 	Gdiplus::Graphics* m_gr;
 
 	Gdiplus::SolidBrush m_solidBrush;
+	std::unique_ptr<Gdiplus::Brush> m_gradientBrush;
+	Gdiplus::Brush* m_fillBrush = &m_solidBrush;
+	Gdiplus::Pen m_pen;
+	bool m_fill = true;
+	Gdiplus::FillMode m_fillMode = Gdiplus::FillModeWinding;
+	bool m_stroke = false;
 	Gdiplus::GraphicsPath m_path;
 
+	std::vector<Gdiplus::GraphicsState> m_clipStates; // saved by PushClip
+	std::unique_ptr<Gdiplus::Region> m_clipRegion; // clip paths until EndClip
+	Gdiplus::FillMode m_clipMode = Gdiplus::FillModeWinding;
+
 	vectoricon::Point m_cursor = {0.f, 0.f};
 	bool m_hasPath = false;
 	std::vector<Gdiplus::PointF> m_ptbuf;
@@ -65,6 +93,8 @@ private:
 	size_t m_currentPathIdx = 0;
 	size_t m_debugPathIdx = 0;
 
+	Gdiplus::RectF m_viewBox;
+
 	int m_ox = 0;
 	int m_oy = 0;
 	int m_dx = 0;
@@ -1,6 +1,8 @@
 
 #include "IconPack.h"
 
+#include <algorithm>
+#include <cmath>
 #include <sstream>
 
 namespace vectoricon {
@@ -99,7 +101,8 @@ bool loadPalette(std::istream& strm, size_t sectSize,
 }
 
 std::optional<Icon> loadIcon(std::istream& strm, size_t sectSize,
-		std::shared_ptr<PaletteVector> const& pv) {
+		std::shared_ptr<PaletteVector> const& pv,
+		std::optional<size_t> currentColor) {
 	uint8_t nameLen = (uint8_t)strm.get();
 	if (!strm.good() || nameLen == 0) {
 		return std::nullopt;
@@ -116,6 +119,7 @@ std::optional<Icon> loadIcon(std::istream& strm, size_t sectSize,
 
 	icon.name = std::string(nameBuf, size_t(nameLen));
 	icon.palvec = pv;
+	icon.currentColor = currentColor;
 
 	uint8_t numImages = (uint8_t)strm.get();
 	if (!strm.good() || numImages == 0) {
@@ -168,6 +172,7 @@ bool Pack::load(std::istream& strm) {
 	icons_.reserve(icons_.size() + nicons);
 
 	std::shared_ptr<PaletteVector> pv;
+	std::optional<size_t> currentColor;
 	while (!strm.eof()) {
 		auto oh = detail::readSectionHeader(strm);
 		if (!oh.has_value()) {
@@ -180,8 +185,17 @@ bool Pack::load(std::istream& strm) {
 			if (!detail::loadPalette(strm, h.size, pv)) {
 				return false;
 			}
+		} else if (memcmp(h.magic, "CURC", 4) == 0) {
+			if (h.size != 1) {
+				return false;
+			}
+			uint8_t idx = (uint8_t)strm.get();
+			if (!strm.good()) {
+				return false;
+			}
+			currentColor = idx;
 		} else if (memcmp(h.magic, "ICON", 4) == 0) {
-			std::optional<Icon> x = detail::loadIcon(strm, h.size, pv);
+			std::optional<Icon> x = detail::loadIcon(strm, h.size, pv, currentColor);
 			if (!x.has_value() || !strm.good()) {
 				return false;
 			}
@@ -305,6 +319,55 @@ public:
 	virtual std::optional<RGBA> At(size_t colorIndex) const = 0;
 };
 
+// readGradient reads the spread method and stops of a gradient.
+// It returns false for invalid data, and sets badIndex
+// if a stop has an invalid palette index.
+bool readGradient(ProgMem& pm, PaletteHandler const& paletteHandler,
+		Gradient& g, size_t& badIndex) {
+	uint8_t spread = pm.byte();
+	if (spread > uint8_t(Spread::Repeat)) {
+		return false;
+	}
+	g.spread = Spread(spread);
+
+	size_t n = pm.byte();
+	if (n == 0) {
+		return false;
+	}
+
+	g.stops.clear();
+	for (size_t i = 0; i < n; i++) {
+		GradientStop s;
+		s.offset = float(pm.byte()) / 255.f;
+		switch (pm.byte()) {
+		case 0:
+			s.color.r = pm.byte();
+			s.color.g = pm.byte();
+			s.color.b = pm.byte();
+			s.color.a = pm.byte();
+			break;
+
+		case 1: {
+			size_t idx = pm.byte();
+			uint8_t a = pm.byte();
+			auto oc = paletteHandler.At(idx);
+			if (!oc) {
+				badIndex = idx;
+				return false;
+			}
+			s.color = *oc;
+			s.color.a = uint8_t((unsigned(s.color.a) * a + 127) / 255);
+			break;
+		}
+
+		default:
+			return false;
+		}
+		g.stops.push_back(s);
+	}
+	return pm.good();
+}
+
 void drawImage(IconData const& icon, PaletteHandler const& paletteHandler,
 	uint32_t ofs, uint32_t sz, DrawEngine* eng) {
 
@@ -328,20 +391,70 @@ void drawImage(IconData const& icon, PaletteHandler const& paletteHandler,
 	eng->ViewBox(xmin, ymin, xmax, ymax);
 
 	bool hasPath = false;
-	auto z = [eng, &hasPath]() {
+	bool inPath = false;
+	bool clipping = false; // collecting clip paths
+	size_t clipDepth = 0;
+	auto z = [eng, &hasPath, &clipping]() {
 		if (hasPath) {
-			eng->ClosePath();
+			if (clipping) {
+				eng->ClipPath();
+			} else {
+				eng->ClosePath();
+			}
 			hasPath = false;
 		}
 	};
 
+	// endPath ends the path and the clip paths.
+	auto endPath = [eng, &z, &inPath, &clipping]() {
+		z();
+		inPath = false;
+		if (clipping) {
+			eng->EndClip();
+			clipping = false;
+		}
+	};
+
+	// figureStart is the start of the current subpath,
+	// drawing after ClosePath begins a new subpath there.
+	Point figureStart{0.f, 0.f};
+	bool figureClosed = false;
+	auto reopen = [eng, &figureStart, &figureClosed]() {
+		if (figureClosed) {
+			eng->MoveTo(figureStart);
+			figureClosed = false;
+		}
+	};
+
+	// current point, needed for arcs
+	Point cur{0.f, 0.f};
+	auto drawn = [&hasPath, &cur](std::vector<Point> const& pts) {
+		cur = pts.back();
+		hasPath = true;
+	};
+
 	std::vector<Point> ptbuf;
+	std::vector<Arc> arcbuf;
+
+	// relPoints reads n points relative to the start of their segment.
+	auto relPoints = [&pm, &ptbuf, &cur](size_t n, size_t seglen) {
+		pm.points(ptbuf, n);
+		Point base = cur;
+		for (size_t i = 0; i < n; i++) {
+			if (i != 0 && i%seglen == 0) {
+				base = ptbuf[i-1];
+			}
+			ptbuf[i].x += base.x;
+			ptbuf[i].y += base.y;
+		}
+	};
+	Gradient grad;
 	while (pm.good()) {
 		size_t opPos = pm.pos();
 		uint8_t op = pm.byte();
 		switch (op & 0xf0) {
 		case 0x00:
-			z();
+			endPath();
 			switch (op) {
 
 			case 0x00:
@@ -371,6 +484,186 @@ void drawImage(IconData const& icon, PaletteHandler const& paletteHandler,
 				break;
 			}
 
+			case 0x03:
+				// Disable fill
+				eng->SetNoFill();
+				break;
+
+			case 0x07: {
+				// Set solid palette fill with alpha
+				size_t i = pm.byte();
+				uint8_t a = pm.byte();
+				auto oc = paletteHandler.At(i);
+				if (!oc) {
+					eng->Error(error::InvalidPaletteIndex{opPos, i});
+					return;
+				}
+				auto c = *oc;
+				c.a = uint8_t((unsigned(c.a) * a + 127) / 255);
+				eng->SetSolidFill(c.r, c.g, c.b, c.a);
+				break;
+			}
+
+			case 0x05:
+			case 0x06: {
+				// Set linear or radial gradient fill
+				if (op == 0x05) {
+					Point p1 = pm.point();
+					Point p2 = pm.point();
+					float dx = p2.x - p1.x;
+					float dy = p2.y - p1.y;
+					float m[6] = {dx, dy, -dy, dx, p1.x, p1.y};
+					std::copy(m, m+6, grad.matrix);
+				} else {
+					for (float& v : grad.matrix) {
+						v = pm.coord();
+					}
+					grad.focal = pm.point();
+				}
+
+				size_t badIndex = size_t(-1);
+				if (!readGradient(pm, paletteHandler, grad, badIndex)) {
+					if (badIndex != size_t(-1)) {
+						eng->Error(error::InvalidPaletteIndex{opPos, badIndex});
+					} else {
+						eng->Error(error::InvalidOpCode{opPos, op});
+					}
+					return;
+				}
+
+				if (op == 0x05) {
+					eng->SetLinearGradientFill(grad);
+				} else {
+					eng->SetRadialGradientFill(grad);
+				}
+				break;
+			}
+
+			case 0x04: {
+				// Set fill rule
+				uint8_t r = pm.byte();
+				if (r > uint8_t(FillRule::EvenOdd)) {
+					eng->Error(error::InvalidOpCode{opPos, op});
+					return;
+				}
+				eng->SetFillRule(FillRule(r));
+				break;
+			}
+
+			default:
+				eng->Error(error::InvalidOpCode{opPos, op});
+				return;
+			}
+			break;
+
+		case 0x10:
+			endPath();
+			switch (op) {
+
+			case 0x10:
+				// Disable stroke
+				eng->SetNoStroke();
+				break;
+
+			case 0x11: {
+				// Set solid RGBA stroke
+				uint8_t r = pm.byte();
+				uint8_t g = pm.byte();
+				uint8_t b = pm.byte();
+				uint8_t a = pm.byte();
+				eng->SetSolidStroke(r, g, b, a);
+				break;
+			}
+
+			case 0x12: {
+				// Set solid palette stroke
+				size_t i = pm.byte();
+				auto oc = paletteHandler.At(i);
+				if (!oc) {
+					eng->Error(error::InvalidPaletteIndex{opPos, i});
+					return;
+				}
+				auto c = *oc;
+				eng->SetSolidStroke(c.r, c.g, c.b, c.a);
+				break;
+			}
+
+			case 0x13:
+				eng->SetStrokeWidth(pm.coord());
+				break;
+
+			case 0x14: {
+				uint8_t c = pm.byte();
+				if (c > uint8_t(LineCap::Square)) {
+					eng->Error(error::InvalidOpCode{opPos, op});
+					return;
+				}
+				eng->SetLineCap(LineCap(c));
+				break;
+			}
+
+			case 0x15: {
+				uint8_t j = pm.byte();
+				if (j > uint8_t(LineJoin::Bevel)) {
+					eng->Error(error::InvalidOpCode{opPos, op});
+					return;
+				}
+				eng->SetLineJoin(LineJoin(j));
+				break;
+			}
+
+			case 0x16:
+				eng->SetMiterLimit(pm.coord());
+				break;
+
+			case 0x17: {
+				// Set solid palette stroke with alpha
+				size_t i = pm.byte();
+				uint8_t a = pm.byte();
+				auto oc = paletteHandler.At(i);
+				if (!oc) {
+					eng->Error(error::InvalidPaletteIndex{opPos, i});
+					return;
+				}
+				auto c = *oc;
+				c.a = uint8_t((unsigned(c.a) * a + 127) / 255);
+				eng->SetSolidStroke(c.r, c.g, c.b, c.a);
+				break;
+			}
+
+			default:
+				eng->Error(error::InvalidOpCode{opPos, op});
+				return;
+			}
+			break;
+
+		case 0x20:
+			endPath();
+			switch (op) {
+
+			case 0x20: {
+				// Push clip
+				uint8_t r = pm.byte();
+				if (r > uint8_t(FillRule::EvenOdd)) {
+					eng->Error(error::InvalidOpCode{opPos, op});
+					return;
+				}
+				eng->PushClip(FillRule(r));
+				clipping = true;
+				clipDepth++;
+				break;
+			}
+
+			case 0x21:
+				// Pop clip
+				if (clipDepth == 0) {
+					eng->Error(error::InvalidOpCode{opPos, op});
+					return;
+				}
+				eng->PopClip();
+				clipDepth--;
+				break;
+
 			default:
 				eng->Error(error::InvalidOpCode{opPos, op});
 				return;
@@ -382,8 +675,22 @@ void drawImage(IconData const& icon, PaletteHandler const& paletteHandler,
 				// MoveTo
 				if (op == 0x70) {
 					z();
+					inPath = true;
+				} else if (!inPath) {
+					eng->Error(error::InvalidOpCode{opPos, op});
+					return;
+				}
+				figureStart = pm.point();
+				figureClosed = false;
+				eng->MoveTo(figureStart);
+				cur = figureStart;
+			} else if (op == 0x72 && inPath) {
+				// ClosePath
+				if (!figureClosed) {
+					eng->CloseFigure();
+					figureClosed = true;
+					cur = figureStart;
 				}
-				eng->MoveTo(pm.point());
 			} else {
 				eng->Error(error::InvalidOpCode{opPos, op});
 				return;
@@ -393,31 +700,106 @@ void drawImage(IconData const& icon, PaletteHandler const& paletteHandler,
 		case 0x80:
 		case 0x90: {
 			// LineTo
+			reopen();
 			size_t rep = 1 + size_t(op - 0x80);
 			pm.points(ptbuf, rep);
 			eng->LineTo(ptbuf);
-			hasPath = true;
+			drawn(ptbuf);
 			break;
 		}
 
 		case 0xa0: {
 			// CubicBézierTo
+			reopen();
 			size_t rep = 1 + size_t(op - 0xa0);
 			pm.points(ptbuf, rep*3);
 			eng->CubicBezierTo(ptbuf);
-			hasPath = true;
+			drawn(ptbuf);
 			break;
 		}
 
 		case 0xb0: {
 			// QuadraticBézierTo
+			reopen();
 			size_t rep = 1 + size_t(op - 0xb0);
 			pm.points(ptbuf, rep*2);
 			eng->QuadraticBezierTo(ptbuf);
+			drawn(ptbuf);
+			break;
+		}
+
+		case 0xc0: {
+			// ArcTo
+			reopen();
+			size_t rep = 1 + size_t(op - 0xc0);
+			arcbuf.clear();
+			for (size_t i = 0; i < rep; i++) {
+				Arc a;
+				a.radius = pm.point();
+				a.rotation = pm.coord();
+				uint8_t flags = pm.byte();
+				if (flags > 0x03) {
+					eng->Error(error::InvalidOpCode{opPos, op});
+					return;
+				}
+				a.largeArc = (flags & 0x01) != 0;
+				a.sweep = (flags & 0x02) != 0;
+				a.end = pm.point();
+				arcbuf.push_back(a);
+			}
+			eng->ArcTo(cur, arcbuf);
+			cur = arcbuf.back().end;
 			hasPath = true;
 			break;
 		}
 
+		case 0xd0: {
+			// RelLineTo
+			reopen();
+			size_t rep = 1 + size_t(op - 0xd0);
+			relPoints(rep, 1);
+			eng->LineTo(ptbuf);
+			drawn(ptbuf);
+			break;
+		}
+
+		case 0xe0: {
+			// RelCubicBézierTo and RelQuadraticBézierTo
+			reopen();
+			if (op < 0xe8) {
+				size_t rep = 1 + size_t(op - 0xe0);
+				relPoints(rep*3, 3);
+				eng->CubicBezierTo(ptbuf);
+			} else {
+				size_t rep = 1 + size_t(op - 0xe8);
+				relPoints(rep*2, 2);
+				eng->QuadraticBezierTo(ptbuf);
+			}
+			drawn(ptbuf);
+			break;
+		}
+
+		case 0xf0: {
+			// horizontal and vertical lines
+			if (op > 0xf3) {
+				eng->Error(error::InvalidOpCode{opPos, op});
+				return;
+			}
+			reopen();
+			float v = pm.coord();
+			Point p = cur;
+			switch (op) {
+			case 0xf0: p.x = v; break;
+			case 0xf1: p.y = v; break;
+			case 0xf2: p.x += v; break;
+			case 0xf3: p.y += v; break;
+			}
+			ptbuf.assign(1, p);
+			eng->LineTo(ptbuf);
+			drawn(ptbuf);
+			break;
+		}
+
 		default:
 			eng->Error(error::InvalidOpCode{opPos, op});
 			return;
@@ -494,8 +876,116 @@ private:
 	ColorOverride const& colorOverride_;
 };
 
+class CurrentColorOverride : public ColorOverride {
+public:
+	CurrentColorOverride(std::optional<size_t> index, RGBA color) :
+		index_(index), color_(color) {
+	}
+
+	std::optional<RGBA> At(size_t colorIndex) const override {
+		if (index_ && *index_ == colorIndex) {
+			return color_;
+		}
+		return std::nullopt;
+	}
+
+private:
+	std::optional<size_t> index_;
+	RGBA color_;
+};
+
 } // end namespace detail
 
+void AppendArcCubics(std::vector<Point>& pts, Point p0, Arc const& arc) {
+	const double pi = 3.14159265358979323846;
+
+	Point p1 = arc.end;
+	if (p0.x == p1.x && p0.y == p1.y) {
+		return;
+	}
+
+	double rx = std::fabs(arc.radius.x), ry = std::fabs(arc.radius.y);
+	if (rx == 0 || ry == 0) {
+		pts.push_back(p0);
+		pts.push_back(p1);
+		pts.push_back(p1);
+		return;
+	}
+
+	double phi = arc.rotation * pi / 180;
+	double sinphi = std::sin(phi), cosphi = std::cos(phi);
+
+	// end point to center parametrization
+	double dx = (p0.x - p1.x) / 2, dy = (p0.y - p1.y) / 2;
+	double x1 = cosphi*dx + sinphi*dy;
+	double y1 = -sinphi*dx + cosphi*dy;
+
+	double lambda = x1*x1/(rx*rx) + y1*y1/(ry*ry);
+	if (lambda > 1) {
+		double s = std::sqrt(lambda);
+		rx *= s;
+		ry *= s;
+	}
+
+	double num = rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1;
+	double den = rx*rx*y1*y1 + ry*ry*x1*x1;
+	double k = num > 0 ? std::sqrt(num / den) : 0;
+	if (arc.largeArc == arc.sweep) {
+		k = -k;
+	}
+	double cx1 = k*rx*y1/ry, cy1 = -k*ry*x1/rx;
+	double cx = cosphi*cx1 - sinphi*cy1 + (p0.x + p1.x) / 2;
+	double cy = sinphi*cx1 + cosphi*cy1 + (p0.y + p1.y) / 2;
+
+	double theta = std::atan2((y1-cy1)/ry, (x1-cx1)/rx);
+	double dtheta = std::atan2((-y1-cy1)/ry, (-x1-cx1)/rx) - theta;
+	if (arc.sweep && dtheta < 0) {
+		dtheta += 2*pi;
+	} else if (!arc.sweep && dtheta > 0) {
+		dtheta -= 2*pi;
+	}
+
+	// segments of at most 90°
+	int n = int(std::ceil(std::fabs(dtheta) / (pi/2) - 1e-7));
+	if (n < 1) {
+		n = 1;
+	}
+	dtheta /= n;
+	double a = 4.0 / 3 * std::tan(dtheta / 4);
+
+	auto ellipse = [&](double x, double y) {
+		x *= rx;
+		y *= ry;
+		return Point{
+			float(cosphi*x - sinphi*y + cx),
+			float(sinphi*x + cosphi*y + cy),
+		};
+	};
+	for (int i = 0; i < n; i++) {
+		double c0 = std::cos(theta), s0 = std::sin(theta);
+		theta += dtheta;
+		double c1 = std::cos(theta), s1 = std::sin(theta);
+		pts.push_back(ellipse(c0 - a*s0, s0 + a*c0));
+		pts.push_back(ellipse(c1 + a*s1, s1 - a*c1));
+		if (i == n-1) {
+			pts.push_back(p1);
+		} else {
+			pts.push_back(ellipse(c1, s1));
+		}
+	}
+}
+
+void DrawEngine::ArcTo(Point p0, std::vector<Arc> const& arcs) {
+	std::vector<Point> pts;
+	for (auto const& arc : arcs) {
+		AppendArcCubics(pts, p0, arc);
+		p0 = arc.end;
+	}
+	if (!pts.empty()) {
+		CubicBezierTo(pts);
+	}
+}
+
 namespace error {
 
 std::string EmptyImage::Msg() const {
@@ -543,4 +1033,10 @@ void Icon::Draw(DrawEngine* eng, uint16_t dx, uint16_t dy,
 	return detail::drawIcon(icon, paletteHandler, eng, dx, dy);
 }
 
+void Icon::Draw(DrawEngine* eng, uint16_t dx, uint16_t dy,
+		size_t paletteIndex, RGBA currentColor) const {
+	detail::CurrentColorOverride co(CurrentColorIndex(), currentColor);
+	Draw(eng, dx, dy, paletteIndex, co);
+}
+
 } // end namespace vectoricon
@@ -33,6 +33,7 @@ struct IconData {
 	std::vector<RawImage> images;
 	std::vector<uint8_t> data;
 	std::shared_ptr<PaletteVector> palvec;
+	std::optional<size_t> currentColor; // palette index of currentColor
 };
 
 // ColorOverride returns override colors.
@@ -56,6 +57,15 @@ public:
 	void Draw(DrawEngine* eng, uint16_t dx, uint16_t dy,
 			size_t paletteIndex, ColorOverride const& colorOverride) const;
 
+	// Draw draws the icon with currentColor painted using color.
+	void Draw(DrawEngine* eng, uint16_t dx, uint16_t dy,
+			size_t paletteIndex, RGBA currentColor) const;
+
+	// CurrentColorIndex returns the palette index reserved for currentColor.
+	std::optional<size_t> CurrentColorIndex() const {
+		return d != nullptr ? d->currentColor : std::nullopt;
+	}
+
 private:
 	std::shared_ptr<IconData> d;
 };
@@ -81,6 +91,67 @@ struct Point {
 	float x, y;
 };
 
+// Arc is an elliptical arc segment ending at end.
+// Its parameters are the same as in SVG path elliptical arc commands.
+struct Arc {
+	Point radius;
+	float rotation; // x-axis rotation in degrees
+	bool largeArc, sweep;
+	Point end;
+};
+
+// AppendArcCubics appends the control and end points of cubic Bézier
+// curves approximating arc starting at p0 to pts.
+void AppendArcCubics(std::vector<Point>& pts, Point p0, Arc const& arc);
+
+enum class FillRule : uint8_t {
+	NonZero = 0,
+	EvenOdd = 1,
+};
+
+enum class Spread : uint8_t {
+	Pad = 0,
+	Reflect = 1,
+	Repeat = 2,
+};
+
+struct GradientStop {
+	float offset; // in [0, 1]
+	RGBA color;
+};
+
+// Gradient is a linear or radial gradient.
+struct Gradient {
+	// matrix maps gradient space to view box coordinates:
+	//   x' = m[0]*x + m[2]*y + m[4]
+	//   y' = m[1]*x + m[3]*y + m[5]
+	//
+	// Linear gradients go from offset 0 at (0, 0)
+	// to offset 1 at (1, 0) in gradient space.
+	// Radial gradients have offset 1 on the unit circle
+	// around the origin in gradient space.
+	float matrix[6];
+
+	// focal is the focal point of radial gradients
+	// in view box coordinates.
+	Point focal;
+
+	Spread spread;
+	std::vector<GradientStop> stops; // palette colors resolved
+};
+
+enum class LineCap : uint8_t {
+	Butt = 0,
+	Round = 1,
+	Square = 2,
+};
+
+enum class LineJoin : uint8_t {
+	Miter = 0,
+	Round = 1,
+	Bevel = 2,
+};
+
 // DrawError represents an error drawing icons.
 class DrawError {
 public:
@@ -105,13 +176,71 @@ public:
 	// SetSolidFill sets up solid fill mode.
 	virtual void SetSolidFill(uint8_t r, uint8_t g, uint8_t b, uint8_t a) = 0;
 
+	// SetNoFill disables filling paths.
+	virtual void SetNoFill() { }
+
+	// SetFillRule sets the fill rule used for filling paths.
+	virtual void SetFillRule(FillRule /*r*/) { }
+
+	// SetLinearGradientFill sets up linear gradient fill mode.
+	// The default implementation fills with the first stop color.
+	virtual void SetLinearGradientFill(Gradient const& g) {
+		auto c = g.stops.front().color;
+		SetSolidFill(c.r, c.g, c.b, c.a);
+	}
+
+	// SetRadialGradientFill sets up radial gradient fill mode.
+	// The default implementation fills with the first stop color.
+	virtual void SetRadialGradientFill(Gradient const& g) {
+		auto c = g.stops.front().color;
+		SetSolidFill(c.r, c.g, c.b, c.a);
+	}
+
+	// SetSolidStroke sets up solid stroke mode.
+	virtual void SetSolidStroke(uint8_t /*r*/, uint8_t /*g*/, uint8_t /*b*/, uint8_t /*a*/) { }
+
+	// SetNoStroke disables stroking paths.
+	virtual void SetNoStroke() { }
+
+	// SetStrokeWidth sets the stroke width in view box units.
+	virtual void SetStrokeWidth(float /*w*/) { }
+
+	virtual void SetLineCap(LineCap /*c*/) { }
+	virtual void SetLineJoin(LineJoin /*j*/) { }
+	virtual void SetMiterLimit(float /*limit*/) { }
+
 	virtual void MoveTo(Point p) = 0;
 	virtual void LineTo(std::vector<Point> const& p) = 0;
 	virtual void CubicBezierTo(std::vector<Point> const& p) = 0;
 	virtual void QuadraticBezierTo(std::vector<Point> const& p) = 0;
 
-	// ClosePath paints the path with the current fill style.
+	// ArcTo draws elliptical arcs starting at the current point p0.
+	// The default implementation draws them with CubicBezierTo.
+	virtual void ArcTo(Point p0, std::vector<Arc> const& arcs);
+
+	// CloseFigure closes the current subpath with a line to its start.
+	// Drawing after CloseFigure is preceded by a MoveTo to the start.
+	// The default implementation leaves the subpath open,
+	// which affects strokes only.
+	virtual void CloseFigure() { }
+
+	// ClosePath paints the path with the current fill and stroke style.
 	virtual void ClosePath() = 0;
+
+	// PushClip saves the clip region. Paths up to the next EndClip
+	// are clip paths passed to ClipPath instead of ClosePath.
+	// The default implementation ignores clipping.
+	virtual void PushClip(FillRule /*r*/) { }
+
+	// ClipPath adds the path filled using the PushClip rule
+	// to the clip paths, and starts a new path.
+	virtual void ClipPath() = 0;
+
+	// EndClip intersects the clip region with the union of the clip paths.
+	virtual void EndClip() { }
+
+	// PopClip restores the clip region saved by the matching PushClip.
+	virtual void PopClip() { }
 };
 
 namespace error {
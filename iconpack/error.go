@@ -0,0 +1,41 @@
+package iconpack
+
+import "fmt"
+
+// FormatError reports that the input is not a valid icon pack.
+type FormatError string
+
+func (e FormatError) Error() string {
+	return "iconpack: invalid format: " + string(e)
+}
+
+// ProgramError reports an invalid icon variant program.
+type ProgramError struct {
+	Pos int // byte position within the variant data
+	Msg string
+}
+
+func (e *ProgramError) Error() string {
+	return fmt.Sprintf("iconpack: %s at byte %d", e.Msg, e.Pos)
+}
+
+// OpcodeError reports an invalid or reserved opcode.
+type OpcodeError struct {
+	Pos int // byte position within the variant data
+	Op  byte
+}
+
+func (e *OpcodeError) Error() string {
+	return fmt.Sprintf("iconpack: invalid opcode %#02x at byte %d", e.Op, e.Pos)
+}
+
+// PaletteIndexError reports a palette index
+// not present in the palette used for painting.
+type PaletteIndexError struct {
+	Pos   int // byte position within the variant data
+	Index int
+}
+
+func (e *PaletteIndexError) Error() string {
+	return fmt.Sprintf("iconpack: invalid palette index %d at byte %d", e.Index, e.Pos)
+}
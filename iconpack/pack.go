@@ -0,0 +1,352 @@
+// Package iconpack reads binary icon packs generated by procsvg.
+//
+// The format of icon packs is described in spec.md
+// at the root of the repository.
+package iconpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+)
+
+const (
+	PackMagic         = "icpk"
+	PaletteMagic      = "PALT"
+	CurrentColorMagic = "CURC"
+	IconMagic         = "ICON"
+)
+
+// maxSectionSize limits the size of sections to detect corrupt files.
+const maxSectionSize = 1 << 20
+
+var byteOrder = binary.LittleEndian
+
+// Palette is a list of non-alpha-premultiplied colors.
+type Palette []color.NRGBA
+
+// Pack is an icon pack.
+type Pack struct {
+	palettes     []Palette
+	currentColor int // palette index of currentColor, or -1
+	icons        []*Icon
+	index        map[string]int
+}
+
+// Icon is an icon within a Pack.
+type Icon struct {
+	Name  string
+	Index int // index of the icon in the pack
+
+	// Variants of the icon ordered by decreasing area.
+	Variants []*Variant
+}
+
+// Variant is an icon image variant of a specific size.
+type Variant struct {
+	Width  int // suggested width in pixels
+	Height int // suggested height in pixels
+
+	// Data holds the raw image data (view box and program).
+	Data []byte
+}
+
+// Icons returns the icons of the pack in pack order.
+func (p *Pack) Icons() []*Icon {
+	return p.icons
+}
+
+// Palettes returns the palettes of the pack.
+// The first palette is the default palette.
+func (p *Pack) Palettes() []Palette {
+	return p.palettes
+}
+
+// Palette returns palette i, or nil if there is no such palette.
+func (p *Pack) Palette(i int) Palette {
+	if i < 0 || i >= len(p.palettes) {
+		return nil
+	}
+	return p.palettes[i]
+}
+
+// CurrentColor returns the palette index reserved for currentColor.
+// It returns false if the pack has no current color entry.
+func (p *Pack) CurrentColor() (int, bool) {
+	return p.currentColor, p.currentColor >= 0
+}
+
+// CurrentColorPalette returns a copy of palette i with
+// its current color entry replaced by c.
+// It returns palette i unchanged if the pack has no current color entry.
+func (p *Pack) CurrentColorPalette(i int, c color.NRGBA) Palette {
+	pal := p.Palette(i)
+	if p.currentColor < 0 || p.currentColor >= len(pal) {
+		return pal
+	}
+	pal = append(Palette(nil), pal...)
+	pal[p.currentColor] = c
+	return pal
+}
+
+// Find returns the icon with the specified name,
+// or nil if there is no such icon.
+func (p *Pack) Find(name string) *Icon {
+	i, ok := p.index[name]
+	if !ok {
+		return nil
+	}
+	return p.icons[i]
+}
+
+// Variant returns the largest image variant of the icon that fits
+// within dx×dy pixels. It returns the smallest variant if none fits,
+// and nil if the icon has no variants.
+func (ic *Icon) Variant(dx, dy int) *Variant {
+	for _, v := range ic.Variants {
+		if v.Width <= dx && v.Height <= dy {
+			return v
+		}
+	}
+	if n := len(ic.Variants); n != 0 {
+		return ic.Variants[n-1]
+	}
+	return nil
+}
+
+// ReadFile reads the icon pack in the named file.
+func ReadFile(fn string) (*Pack, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
+
+// Decode reads an icon pack from r.
+//
+// Unknown sections are skipped.
+func Decode(r io.Reader) (*Pack, error) {
+	sc, err := NewScanner(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pack{
+		currentColor: -1,
+		index:        make(map[string]int),
+	}
+
+	for {
+		sec, err := sc.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch sec.Magic {
+		case PaletteMagic:
+			pal, idx, err := sec.Palette()
+			if err != nil {
+				return nil, err
+			}
+			for len(p.palettes) <= idx {
+				p.palettes = append(p.palettes, nil)
+			}
+			p.palettes[idx] = pal
+
+		case CurrentColorMagic:
+			i, err := sec.CurrentColor()
+			if err != nil {
+				return nil, err
+			}
+			p.currentColor = i
+
+		case IconMagic:
+			ic, err := sec.Icon()
+			if err != nil {
+				return nil, err
+			}
+			ic.Index = len(p.icons)
+			if _, dup := p.index[ic.Name]; !dup {
+				p.index[ic.Name] = ic.Index
+			}
+			p.icons = append(p.icons, ic)
+		}
+	}
+
+	if err := sc.Check(len(p.icons)); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Scanner reads an icon pack section by section,
+// for example to inspect invalid icon packs.
+type Scanner struct {
+	r io.Reader
+
+	// NumIcons is the number of icons in the pack header.
+	NumIcons int
+}
+
+// NewScanner reads the icon pack header from r,
+// and returns a Scanner for the sections that follow.
+func NewScanner(r io.Reader) (*Scanner, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, noEOF(err)
+	}
+
+	if string(header[:4]) != PackMagic {
+		return nil, FormatError("invalid header")
+	}
+
+	return &Scanner{
+		r:        r,
+		NumIcons: int(byteOrder.Uint32(header[4:])),
+	}, nil
+}
+
+// Next reads the next section.
+// It returns io.EOF at the end of the pack.
+func (sc *Scanner) Next() (Section, error) {
+	magic, data, err := readSection(sc.r)
+	return Section{Magic: magic, Data: data}, err
+}
+
+// Check reports if nicons icons found match the pack header.
+func (sc *Scanner) Check(nicons int) error {
+	if nicons != sc.NumIcons {
+		return FormatError(fmt.Sprintf("header has %d icons, found %d", sc.NumIcons, nicons))
+	}
+	return nil
+}
+
+// Section is a section of an icon pack.
+type Section struct {
+	Magic string // section magic such as PaletteMagic
+	Data  []byte // section data
+}
+
+// Palette decodes the palette of a PaletteMagic section
+// and returns it with its palette index.
+func (s Section) Palette() (Palette, int, error) {
+	return parsePalette(s.Data)
+}
+
+// CurrentColor decodes the palette index of a CurrentColorMagic section.
+func (s Section) CurrentColor() (int, error) {
+	if len(s.Data) != 1 {
+		return 0, FormatError(fmt.Sprintf("invalid current color size %d", len(s.Data)))
+	}
+	return int(s.Data[0]), nil
+}
+
+// Icon decodes the icon of an IconMagic section.
+// The Index of the icon returned is zero.
+func (s Section) Icon() (*Icon, error) {
+	return parseIcon(s.Data)
+}
+
+func readSection(r io.Reader) (magic string, data []byte, err error) {
+	var header [8]byte
+	n, err := io.ReadFull(r, header[:])
+	if err != nil {
+		if n == 0 && err == io.EOF {
+			return "", nil, io.EOF
+		}
+		return "", nil, noEOF(err)
+	}
+
+	nbytes := int(byteOrder.Uint32(header[4:]))
+	if nbytes > maxSectionSize {
+		return "", nil, FormatError("section size too large")
+	}
+
+	data = make([]byte, nbytes)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", nil, noEOF(err)
+	}
+
+	return string(header[:4]), data, nil
+}
+
+func parsePalette(data []byte) (pal Palette, idx int, err error) {
+	n := len(data)
+	if n < 2 || n != 2+4*int(data[1]) {
+		return nil, 0, FormatError(fmt.Sprintf("invalid palette size %d", n))
+	}
+
+	idx = int(data[0])
+	pal = make(Palette, 0, data[1])
+	for i := 2; i < n; i += 4 {
+		c := data[i:]
+		pal = append(pal, color.NRGBA{c[0], c[1], c[2], c[3]})
+	}
+	return pal, idx, nil
+}
+
+// iconHeaderBytes is the size of an icon variant header.
+const iconHeaderBytes = 8
+
+func parseIcon(data []byte) (*Icon, error) {
+	if len(data) == 0 {
+		return nil, FormatError("empty icon section")
+	}
+
+	e := int(data[0]) + 1
+	if e+1 > len(data) {
+		return nil, FormatError("invalid icon header")
+	}
+
+	ic := &Icon{Name: string(data[1:e])}
+
+	nvariants := int(data[e])
+	data = data[e+1:]
+
+	if len(data) < nvariants*iconHeaderBytes {
+		return nil, FormatError(fmt.Sprintf("icon %q: invalid variant headers", ic.Name))
+	}
+
+	hdr := data[:nvariants*iconHeaderBytes]
+	data = data[len(hdr):]
+	for i := 0; i < nvariants; i++ {
+		h := hdr[i*iconHeaderBytes:]
+		dx := int(byteOrder.Uint16(h[0:]))
+		dy := int(byteOrder.Uint16(h[2:]))
+		nbytes := int(byteOrder.Uint32(h[4:]))
+
+		if len(data) < nbytes {
+			return nil, FormatError(fmt.Sprintf("icon %q: variant %d×%d data truncated", ic.Name, dx, dy))
+		}
+
+		ic.Variants = append(ic.Variants, &Variant{
+			Width:  dx,
+			Height: dy,
+			Data:   data[:nbytes:nbytes],
+		})
+
+		data = data[nbytes:]
+	}
+
+	if len(data) != 0 {
+		return nil, FormatError(fmt.Sprintf("icon %q: garbage after image data", ic.Name))
+	}
+
+	return ic, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,402 @@
+package iconpack
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testPack builds an icon pack with a single palette and
+// the specified icons, each having one 16×16 variant.
+func testPack(pal Palette, icons map[string][]byte, names ...string) []byte {
+	var buf bytes.Buffer
+	u32 := func(v int) {
+		var b [4]byte
+		byteOrder.PutUint32(b[:], uint32(v))
+		buf.Write(b[:])
+	}
+
+	buf.WriteString(PackMagic)
+	u32(len(names))
+
+	buf.WriteString(PaletteMagic)
+	u32(2 + 4*len(pal))
+	buf.WriteByte(0)
+	buf.WriteByte(byte(len(pal)))
+	for _, c := range pal {
+		buf.Write([]byte{c.R, c.G, c.B, c.A})
+	}
+
+	for _, n := range names {
+		data := icons[n]
+		buf.WriteString(IconMagic)
+		u32(1 + len(n) + 1 + iconHeaderBytes + len(data))
+		buf.WriteByte(byte(len(n)))
+		buf.WriteString(n)
+		buf.WriteByte(1)
+		buf.Write([]byte{16, 0, 16, 0})
+		u32(len(data))
+		buf.Write(data)
+	}
+
+	return buf.Bytes()
+}
+
+// 1 byte coordinate
+func c1(v int) byte {
+	return byte(v+64)<<1 | 0x01
+}
+
+var testTriangle = []byte{
+	c1(0), c1(0), c1(16), c1(16), // view box
+	0x02, 0, // palette fill
+	0x70, c1(8), c1(2),
+	0x81, c1(14), c1(14), c1(2), c1(14),
+	0x01, 0x10, 0x20, 0x30, 0x40, // rgba fill
+	0x70, c1(0), c1(0),
+	0xa0, 0x82, 0x87, c1(1), c1(2), c1(3), c1(4), c1(5),
+	0x00,
+}
+
+func TestDecode(t *testing.T) {
+	pal := Palette{{0xff, 0, 0, 0xff}}
+	data := testPack(pal, map[string][]byte{
+		"tri": testTriangle,
+		"dot": {c1(0), c1(0), c1(1), c1(1), 0x00},
+	}, "tri", "dot")
+
+	p, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(p.Icons()); n != 2 {
+		t.Fatalf("got %d icons, want 2", n)
+	}
+	if got := p.Palette(0); len(got) != 1 || got[0] != pal[0] {
+		t.Fatalf("got palette %v, want %v", got, pal)
+	}
+
+	ic := p.Find("tri")
+	if ic == nil || ic.Index != 0 {
+		t.Fatalf("Find: got %v", ic)
+	}
+	if p.Find("missing") != nil {
+		t.Fatal("Find: found missing icon")
+	}
+
+	v := ic.Variant(32, 32)
+	if v == nil || v.Width != 16 || v.Height != 16 {
+		t.Fatalf("Variant: got %v", v)
+	}
+
+	prog, err := v.Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (Rect{Point{0, 0}, Point{16, 16}}); prog.ViewBox != want {
+		t.Errorf("got view box %v, want %v", prog.ViewBox, want)
+	}
+
+	wantOps := []Op{
+		{Code: OpPaletteFill, Pos: 4, Index: 0},
+		{Code: OpBeginMoveTo, Pos: 6, Pt: []Point{{8, 2}}},
+		{Code: OpLineTo, Pos: 9, Pt: []Point{{14, 14}, {2, 14}}},
+		{Code: OpSolidFill, Pos: 14, Color: color.NRGBA{0x10, 0x20, 0x30, 0x40}},
+		{Code: OpBeginMoveTo, Pos: 19, Pt: []Point{{0, 0}}},
+		{Code: OpCubicBezierTo, Pos: 22, Pt: []Point{{7.5, 1}, {2, 3}, {4, 5}}},
+	}
+	if len(prog.Ops) != len(wantOps) {
+		t.Fatalf("got %d ops, want %d", len(prog.Ops), len(wantOps))
+	}
+	for i, op := range prog.Ops {
+		w := wantOps[i]
+		if op.Code != w.Code || op.Pos != w.Pos || op.Index != w.Index ||
+			op.Color != w.Color || !equalPts(op.Pt, w.Pt) {
+			t.Errorf("op %d: got %+v, want %+v", i, op, w)
+		}
+	}
+}
+
+func equalPts(a, b []Point) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScanner(t *testing.T) {
+	pal := Palette{{0xff, 0, 0, 0xff}}
+	data := testPack(pal, map[string][]byte{
+		"tri": testTriangle,
+		"dot": {c1(0), c1(0), c1(1), c1(1), 0x00},
+	}, "tri", "dot")
+
+	// Sections before a truncated one are returned.
+	sc, err := NewScanner(bytes.NewReader(data[:len(data)-3]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.NumIcons != 2 {
+		t.Errorf("got %d icons, want 2", sc.NumIcons)
+	}
+	var magic []string
+	for {
+		sec, err := sc.Next()
+		if err != nil {
+			if err == io.EOF {
+				t.Error("truncated pack: no error")
+			}
+			break
+		}
+		magic = append(magic, sec.Magic)
+		if sec.Magic == IconMagic {
+			if ic, err := sec.Icon(); err != nil || ic.Name != "tri" {
+				t.Errorf("got icon %v, %v; want tri", ic, err)
+			}
+		}
+	}
+	if got, want := strings.Join(magic, " "), PaletteMagic+" "+IconMagic; got != want {
+		t.Errorf("got sections %s, want %s", got, want)
+	}
+
+	if err := sc.Check(1); err == nil {
+		t.Error("icon count mismatch: no error")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	pal := Palette{{0xff, 0, 0, 0xff}}
+
+	_, err := Decode(bytes.NewReader([]byte("ICPK\x00\x00\x00\x00")))
+	var fe FormatError
+	if !errors.As(err, &fe) {
+		t.Errorf("bad magic: got %v, want FormatError", err)
+	}
+
+	data := testPack(pal, map[string][]byte{"x": testTriangle}, "x")
+	_, err = Decode(bytes.NewReader(data[:len(data)-3]))
+	if err == nil {
+		t.Error("truncated pack: no error")
+	}
+
+	progs := []struct {
+		data []byte
+		pos  int
+	}{
+		{[]byte{c1(0), c1(0)}, 0},
+		{[]byte{c1(0), c1(0), c1(1), c1(1)}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x0f, 0x00}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x04, 0x02, 0x00}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x81, c1(0), c1(0), 0x00}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x70, c1(0)}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x20, 0x02, 0x00}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x20, 0x00, 0x21, 0x21, 0x00}, 7},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x72, 0x00}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x70, c1(0), c1(0), 0x03, 0x72, 0x00}, 8},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x70, c1(0), c1(0), 0x73, 0x00}, 7},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0xc0, c1(1), c1(1), c1(0), 0x00, c1(1), c1(1), 0x00}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x70, c1(0), c1(0), 0xc0, c1(1), c1(1), c1(0), 0x04, c1(1), c1(1), 0x00}, 7},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x70, c1(0), c1(0), 0xc1, c1(1), c1(1), c1(0), 0x00, c1(1), c1(1), 0x00}, 7},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0xd0, c1(1), c1(1), 0x00}, 4},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x70, c1(0), c1(0), 0xf4, c1(1), 0x00}, 7},
+		{[]byte{c1(0), c1(0), c1(1), c1(1), 0x70, c1(0), c1(0), 0xf0}, 7},
+	}
+	for i, tt := range progs {
+		_, err := DecodeProgram(tt.data)
+		var pe *ProgramError
+		var oe *OpcodeError
+		switch {
+		case errors.As(err, &pe):
+			if pe.Pos != tt.pos {
+				t.Errorf("prog %d: got error at %d, want %d", i, pe.Pos, tt.pos)
+			}
+		case errors.As(err, &oe):
+			if oe.Pos != tt.pos {
+				t.Errorf("prog %d: got error at %d, want %d", i, oe.Pos, tt.pos)
+			}
+		default:
+			t.Errorf("prog %d: got %v, want program error", i, err)
+		}
+	}
+}
+
+func TestCurrentColor(t *testing.T) {
+	pal := Palette{{0xff, 0, 0, 0xff}, {0, 0, 0, 0xff}}
+	icon := []byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x07, 1, 0x80, // palette fill with alpha
+		0x17, 1, 0x40, // palette stroke with alpha
+		0x00,
+	}
+	data := testPack(pal, map[string][]byte{"x": icon}, "x")
+
+	p, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, ok := p.CurrentColor(); ok {
+		t.Errorf("got current color %d without segment", i)
+	}
+
+	data = append(data, CurrentColorMagic...)
+	data = append(data, 1, 0, 0, 0, 1)
+	p, err = Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, ok := p.CurrentColor(); !ok || i != 1 {
+		t.Errorf("got current color %d %v, want 1 true", i, ok)
+	}
+
+	tint := color.NRGBA{0, 0x80, 0xff, 0xff}
+	got := p.CurrentColorPalette(0, tint)
+	if len(got) != 2 || got[0] != pal[0] || got[1] != tint {
+		t.Errorf("got tinted palette %v", got)
+	}
+	if p.Palette(0)[1] != pal[1] {
+		t.Error("CurrentColorPalette modified pack palette")
+	}
+
+	prog, err := p.Icons()[0].Variants[0].Program()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOps := []Op{
+		{Code: OpPaletteAlphaFill, Index: 1, Color: color.NRGBA{A: 0x80}},
+		{Code: OpPaletteAlphaStroke, Index: 1, Color: color.NRGBA{A: 0x40}},
+	}
+	if len(prog.Ops) != len(wantOps) {
+		t.Fatalf("got %d ops, want %d", len(prog.Ops), len(wantOps))
+	}
+	for i, op := range prog.Ops {
+		w := wantOps[i]
+		if op.Code != w.Code || op.Index != w.Index || op.Color != w.Color {
+			t.Errorf("op %d: got %+v, want %+v", i, op, w)
+		}
+	}
+}
+
+func TestDecodeArc(t *testing.T) {
+	prog, err := DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x70, c1(2), c1(8),
+		0xc1, // 2 arcs
+		c1(6), c1(6), c1(0), 0x00, c1(14), c1(8),
+		c1(8), c1(4), c1(30), 0x03, c1(2), c1(8),
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prog.Ops) != 2 {
+		t.Fatalf("got %d ops, want 2", len(prog.Ops))
+	}
+
+	op := prog.Ops[1]
+	wantArc := []Arc{
+		{Radius: Point{6, 6}},
+		{Radius: Point{8, 4}, Rotation: 30, LargeArc: true, Sweep: true},
+	}
+	wantPt := []Point{{14, 8}, {2, 8}}
+	if op.Code != OpArcTo || len(op.Arc) != len(wantArc) || !equalPts(op.Pt, wantPt) {
+		t.Fatalf("got %+v", op)
+	}
+	for i, a := range op.Arc {
+		if a != wantArc[i] {
+			t.Errorf("arc %d: got %+v, want %+v", i, a, wantArc[i])
+		}
+	}
+}
+
+func TestDecodeRelative(t *testing.T) {
+	prog, err := DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x70, c1(2), c1(2),
+		0xd1, c1(4), c1(0), c1(0), c1(4), // relative lines
+		0xe0, c1(1), c1(0), c1(2), c1(1), c1(2), c1(2), // relative cubic
+		0xe9, c1(1), c1(1), c1(2), c1(2), c1(-1), c1(0), c1(-2), c1(0), // 2 relative quadratics
+		0xf0, c1(1),
+		0xf1, c1(3),
+		0xf2, c1(5),
+		0xf3, c1(-1),
+		0x72,
+		0xd0, c1(1), c1(1), // after ClosePath
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		code Opcode
+		pt   []Point
+	}{
+		{OpBeginMoveTo, []Point{{2, 2}}},
+		{OpRelLineTo, []Point{{6, 2}, {6, 6}}},
+		{OpRelCubicBezierTo, []Point{{7, 6}, {8, 7}, {8, 8}}},
+		{OpRelQuadraticBezierTo, []Point{{9, 9}, {10, 10}, {9, 10}, {8, 10}}},
+		{OpHLineTo, []Point{{1, 10}}},
+		{OpVLineTo, []Point{{1, 3}}},
+		{OpRelHLineTo, []Point{{6, 3}}},
+		{OpRelVLineTo, []Point{{6, 2}}},
+		{OpClosePath, nil},
+		{OpRelLineTo, []Point{{3, 3}}},
+	}
+	if len(prog.Ops) != len(want) {
+		t.Fatalf("got %d ops, want %d", len(prog.Ops), len(want))
+	}
+	for i, op := range prog.Ops {
+		if op.Code != want[i].code || !equalPts(op.Pt, want[i].pt) {
+			t.Errorf("op %d: got %v %v, want %v %v", i, op.Code, op.Pt, want[i].code, want[i].pt)
+		}
+	}
+}
+
+func TestDecodeClip(t *testing.T) {
+	prog, err := DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x20, 0x01, // push clip, evenodd
+		0x70, c1(0), c1(0),
+		0x81, c1(8), c1(0), c1(0), c1(8),
+		0x70, c1(4), c1(4),
+		0x80, c1(6), c1(6),
+		0x70, c1(0), c1(0),
+		0x80, c1(16), c1(16),
+		0x21,       // pop clip
+		0x20, 0x00, // unbalanced push clip
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Opcode{
+		OpPushClip,
+		OpBeginMoveTo, OpLineTo,
+		OpBeginMoveTo, OpLineTo,
+		OpBeginMoveTo, OpLineTo,
+		OpPopClip,
+		OpPushClip,
+	}
+	if len(prog.Ops) != len(want) {
+		t.Fatalf("got %d ops, want %d", len(prog.Ops), len(want))
+	}
+	for i, op := range prog.Ops {
+		if op.Code != want[i] {
+			t.Errorf("op %d: got %v, want %v", i, op.Code, want[i])
+		}
+	}
+	if m := prog.Ops[0].Mode; m != byte(FillEvenOdd) {
+		t.Errorf("got clip rule %d, want %d", m, FillEvenOdd)
+	}
+}
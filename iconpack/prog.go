@@ -0,0 +1,570 @@
+package iconpack
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Opcode is a base program opcode.
+//
+// Opcodes with a repeat count, such as OpLineTo,
+// are represented by the opcode with repeat count 1.
+type Opcode byte
+
+const (
+	OpStop                 Opcode = 0x00
+	OpSolidFill            Opcode = 0x01 // solid fill with color
+	OpPaletteFill          Opcode = 0x02 // solid fill with palette index
+	OpNoFill               Opcode = 0x03
+	OpFillRule             Opcode = 0x04
+	OpLinearGradient       Opcode = 0x05 // linear gradient fill
+	OpRadialGradient       Opcode = 0x06 // radial gradient fill
+	OpPaletteAlphaFill     Opcode = 0x07 // solid fill with palette index and alpha
+	OpNoStroke             Opcode = 0x10
+	OpSolidStroke          Opcode = 0x11 // solid stroke with color
+	OpPaletteStroke        Opcode = 0x12 // solid stroke with palette index
+	OpStrokeWidth          Opcode = 0x13
+	OpLineCap              Opcode = 0x14
+	OpLineJoin             Opcode = 0x15
+	OpMiterLimit           Opcode = 0x16
+	OpPaletteAlphaStroke   Opcode = 0x17 // solid stroke with palette index and alpha
+	OpPushClip             Opcode = 0x20 // intersect clip region with the paths that follow
+	OpPopClip              Opcode = 0x21 // restore clip region
+	OpBeginMoveTo          Opcode = 0x70
+	OpMoveTo               Opcode = 0x71
+	OpClosePath            Opcode = 0x72 // close the current subpath
+	OpLineTo               Opcode = 0x80
+	OpCubicBezierTo        Opcode = 0xa0
+	OpQuadraticBezierTo    Opcode = 0xb0
+	OpArcTo                Opcode = 0xc0 // elliptical arc
+	OpRelLineTo            Opcode = 0xd0
+	OpRelCubicBezierTo     Opcode = 0xe0
+	OpRelQuadraticBezierTo Opcode = 0xe8
+	OpHLineTo              Opcode = 0xf0 // horizontal line to x
+	OpVLineTo              Opcode = 0xf1 // vertical line to y
+	OpRelHLineTo           Opcode = 0xf2 // horizontal line by dx
+	OpRelVLineTo           Opcode = 0xf3 // vertical line by dy
+)
+
+var opNames = map[Opcode]string{
+	OpStop:                 "Stop",
+	OpSolidFill:            "SetSolidFill",
+	OpPaletteFill:          "SetSolidFill",
+	OpNoFill:               "SetNoFill",
+	OpFillRule:             "SetFillRule",
+	OpLinearGradient:       "SetLinearGradientFill",
+	OpRadialGradient:       "SetRadialGradientFill",
+	OpPaletteAlphaFill:     "SetSolidFill",
+	OpNoStroke:             "SetNoStroke",
+	OpSolidStroke:          "SetSolidStroke",
+	OpPaletteStroke:        "SetSolidStroke",
+	OpStrokeWidth:          "SetStrokeWidth",
+	OpLineCap:              "SetLineCap",
+	OpLineJoin:             "SetLineJoin",
+	OpMiterLimit:           "SetMiterLimit",
+	OpPaletteAlphaStroke:   "SetSolidStroke",
+	OpPushClip:             "PushClip",
+	OpPopClip:              "PopClip",
+	OpBeginMoveTo:          "BeginMoveTo",
+	OpMoveTo:               "MoveTo",
+	OpClosePath:            "ClosePath",
+	OpLineTo:               "LineTo",
+	OpCubicBezierTo:        "CubicBezierTo",
+	OpQuadraticBezierTo:    "QuadraticBezierTo",
+	OpArcTo:                "ArcTo",
+	OpRelLineTo:            "RelLineTo",
+	OpRelCubicBezierTo:     "RelCubicBezierTo",
+	OpRelQuadraticBezierTo: "RelQuadraticBezierTo",
+	OpHLineTo:              "HLineTo",
+	OpVLineTo:              "VLineTo",
+	OpRelHLineTo:           "RelHLineTo",
+	OpRelVLineTo:           "RelVLineTo",
+}
+
+func (op Opcode) String() string {
+	if s, ok := opNames[op]; ok {
+		return s
+	}
+	return fmt.Sprintf("Opcode(%#02x)", byte(op))
+}
+
+// FillRule determines which parts of a path are inside.
+type FillRule byte
+
+const (
+	FillNonZero FillRule = iota
+	FillEvenOdd
+)
+
+// Spread specifies how gradients paint outside their [0, 1] offset range.
+type Spread byte
+
+const (
+	SpreadPad Spread = iota
+	SpreadReflect
+	SpreadRepeat
+)
+
+// Gradient is a linear or radial gradient.
+type Gradient struct {
+	// Matrix maps gradient space to view box coordinates:
+	//   x' = m[0]*x + m[2]*y + m[4]
+	//   y' = m[1]*x + m[3]*y + m[5]
+	//
+	// Linear gradients go from offset 0 at (0, 0)
+	// to offset 1 at (1, 0) in gradient space.
+	// Radial gradients have offset 1 on the unit circle
+	// around the origin in gradient space.
+	Matrix [6]float64
+
+	// Focal is the focal point of radial gradients
+	// in view box coordinates. Offset 0 is at the focal point.
+	Focal Point
+
+	Spread Spread
+	Stops  []GradientStop
+}
+
+// GradientStop is a color stop of a gradient.
+type GradientStop struct {
+	Offset float64 // in [0, 1]
+
+	// Color is the stop color. For palette stops,
+	// Color.A is the opacity applied to the palette color.
+	Color color.NRGBA
+
+	Palette bool // the stop uses the palette color at Index
+	Index   int
+}
+
+// LineCap is the shape at the end of open stroked subpaths.
+type LineCap byte
+
+const (
+	CapButt LineCap = iota
+	CapRound
+	CapSquare
+)
+
+// LineJoin is the shape at the corners of stroked paths.
+type LineJoin byte
+
+const (
+	JoinMiter LineJoin = iota
+	JoinRound
+	JoinBevel
+)
+
+// Point is a point in view box coordinates.
+type Point struct {
+	X, Y float64
+}
+
+// Rect is a rectangle in view box coordinates.
+type Rect struct {
+	Min, Max Point
+}
+
+func (r Rect) Dx() float64 { return r.Max.X - r.Min.X }
+func (r Rect) Dy() float64 { return r.Max.Y - r.Min.Y }
+
+// Arc holds the ellipse parameters of an OpArcTo segment.
+// Their meaning is the same as in SVG path elliptical arc commands.
+type Arc struct {
+	Radius   Point   // ellipse radii
+	Rotation float64 // x-axis rotation in degrees
+	LargeArc bool
+	Sweep    bool
+}
+
+// Op is a decoded program instruction.
+type Op struct {
+	Code Opcode
+	Pos  int // byte position of the opcode in Variant.Data
+
+	// Color is the OpSolidFill and OpSolidStroke color.
+	// For OpPaletteAlphaFill and OpPaletteAlphaStroke,
+	// Color.A is the opacity applied to the palette color.
+	Color color.NRGBA
+
+	Index int // palette index of palette fill and stroke ops
+
+	Value float64 // OpStrokeWidth and OpMiterLimit value
+	Mode  byte    // OpFillRule, OpPushClip, OpLineCap and OpLineJoin mode
+
+	Gradient *Gradient // OpLinearGradient and OpRadialGradient
+
+	// Pt holds the points of path ops in view box coordinates,
+	// including ops encoded with relative coordinates.
+	// CubicBezierTo has 3 and QuadraticBezierTo has 2 points per segment.
+	Pt []Point
+
+	// Arc holds the ellipse parameters of ArcTo segments
+	// ending at the corresponding point in Pt.
+	Arc []Arc
+}
+
+// Program is a decoded icon variant image.
+type Program struct {
+	ViewBox Rect
+	Ops     []Op // program ops, excluding the final Stop
+}
+
+// Program decodes the image data of v.
+func (v *Variant) Program() (*Program, error) {
+	return DecodeProgram(v.Data)
+}
+
+// DecodeProgram decodes icon variant image data.
+func DecodeProgram(data []byte) (*Program, error) {
+	d := progDecoder{data: data}
+
+	p := new(Program)
+	p.ViewBox.Min = d.point()
+	p.ViewBox.Max = d.point()
+	if d.err != nil {
+		return nil, &ProgramError{Pos: 0, Msg: "missing view box"}
+	}
+
+	inPath := false
+	clipDepth := 0
+	var start, cur Point // start of the subpath and current point
+	for {
+		if d.pos >= len(d.data) {
+			return nil, &ProgramError{Pos: d.pos, Msg: "missing stop"}
+		}
+
+		pos := d.pos
+		b := d.byte()
+
+		op := Op{Pos: pos}
+		npt := 0
+		seglen := 0 // points per segment of relative ops
+		switch b & 0xf0 {
+
+		case 0x00:
+			switch Opcode(b) {
+			case OpStop:
+				return p, nil
+
+			case OpSolidFill:
+				op.Code = OpSolidFill
+				op.Color = color.NRGBA{d.byte(), d.byte(), d.byte(), d.byte()}
+
+			case OpPaletteFill:
+				op.Code = OpPaletteFill
+				op.Index = int(d.byte())
+
+			case OpPaletteAlphaFill:
+				op.Code = OpPaletteAlphaFill
+				op.Index = int(d.byte())
+				op.Color.A = d.byte()
+
+			case OpNoFill:
+				op.Code = OpNoFill
+
+			case OpFillRule:
+				op.Code = OpFillRule
+				op.Mode = d.byte()
+				if op.Mode > byte(FillEvenOdd) && d.err == nil {
+					return nil, &ProgramError{Pos: pos, Msg: "invalid fill rule"}
+				}
+
+			case OpLinearGradient:
+				op.Code = OpLinearGradient
+				p1, p2 := d.point(), d.point()
+				dx, dy := p2.X-p1.X, p2.Y-p1.Y
+				op.Gradient = &Gradient{Matrix: [6]float64{dx, dy, -dy, dx, p1.X, p1.Y}}
+
+			case OpRadialGradient:
+				op.Code = OpRadialGradient
+				op.Gradient = new(Gradient)
+				for i := range op.Gradient.Matrix {
+					op.Gradient.Matrix[i] = d.coord()
+				}
+				op.Gradient.Focal = d.point()
+
+			default:
+				return nil, &OpcodeError{Pos: pos, Op: b}
+			}
+
+			if op.Gradient != nil {
+				if msg := d.gradient(op.Gradient); msg != "" && d.err == nil {
+					return nil, &ProgramError{Pos: pos, Msg: msg}
+				}
+			}
+
+		case 0x10:
+			op.Code = Opcode(b)
+			switch op.Code {
+			case OpNoStroke:
+
+			case OpSolidStroke:
+				op.Color = color.NRGBA{d.byte(), d.byte(), d.byte(), d.byte()}
+
+			case OpPaletteStroke:
+				op.Index = int(d.byte())
+
+			case OpPaletteAlphaStroke:
+				op.Index = int(d.byte())
+				op.Color.A = d.byte()
+
+			case OpStrokeWidth, OpMiterLimit:
+				op.Value = d.coord()
+
+			case OpLineCap:
+				op.Mode = d.byte()
+				if op.Mode > byte(CapSquare) && d.err == nil {
+					return nil, &ProgramError{Pos: pos, Msg: "invalid line cap"}
+				}
+
+			case OpLineJoin:
+				op.Mode = d.byte()
+				if op.Mode > byte(JoinBevel) && d.err == nil {
+					return nil, &ProgramError{Pos: pos, Msg: "invalid line join"}
+				}
+
+			default:
+				return nil, &OpcodeError{Pos: pos, Op: b}
+			}
+
+		case 0x20:
+			op.Code = Opcode(b)
+			switch op.Code {
+			case OpPushClip:
+				op.Mode = d.byte()
+				if op.Mode > byte(FillEvenOdd) && d.err == nil {
+					return nil, &ProgramError{Pos: pos, Msg: "invalid clip rule"}
+				}
+				clipDepth++
+
+			case OpPopClip:
+				if clipDepth == 0 {
+					return nil, &ProgramError{Pos: pos, Msg: "PopClip without PushClip"}
+				}
+				clipDepth--
+
+			default:
+				return nil, &OpcodeError{Pos: pos, Op: b}
+			}
+
+		case 0x70:
+			switch Opcode(b) {
+			case OpBeginMoveTo:
+				inPath = true
+				npt = 1
+			case OpMoveTo:
+				if !inPath {
+					return nil, &ProgramError{Pos: pos, Msg: "MoveTo outside path"}
+				}
+				npt = 1
+			case OpClosePath:
+				if !inPath {
+					return nil, &ProgramError{Pos: pos, Msg: "ClosePath outside path"}
+				}
+			default:
+				return nil, &OpcodeError{Pos: pos, Op: b}
+			}
+			op.Code = Opcode(b)
+
+		case 0x80, 0x90:
+			op.Code = OpLineTo
+			npt = int(b-0x80) + 1
+
+		case 0xa0:
+			op.Code = OpCubicBezierTo
+			npt = 3 * (int(b-0xa0) + 1)
+
+		case 0xb0:
+			op.Code = OpQuadraticBezierTo
+			npt = 2 * (int(b-0xb0) + 1)
+
+		case 0xc0:
+			op.Code = OpArcTo
+			for i := int(b-0xc0) + 1; i > 0; i-- {
+				var a Arc
+				a.Radius = d.point()
+				a.Rotation = d.coord()
+				flags := d.byte()
+				a.LargeArc = flags&0x01 != 0
+				a.Sweep = flags&0x02 != 0
+				if flags > 0x03 && d.err == nil {
+					return nil, &ProgramError{Pos: pos, Msg: "invalid arc flags"}
+				}
+				op.Arc = append(op.Arc, a)
+				op.Pt = append(op.Pt, d.point())
+			}
+
+		case 0xd0:
+			op.Code = OpRelLineTo
+			npt = int(b-0xd0) + 1
+			seglen = 1
+
+		case 0xe0:
+			if b < 0xe8 {
+				op.Code = OpRelCubicBezierTo
+				npt = 3 * (int(b-0xe0) + 1)
+				seglen = 3
+			} else {
+				op.Code = OpRelQuadraticBezierTo
+				npt = 2 * (int(b-0xe8) + 1)
+				seglen = 2
+			}
+
+		case 0xf0:
+			op.Code = Opcode(b)
+			switch op.Code {
+			case OpHLineTo, OpVLineTo, OpRelHLineTo, OpRelVLineTo:
+			default:
+				return nil, &OpcodeError{Pos: pos, Op: b}
+			}
+
+		default:
+			return nil, &OpcodeError{Pos: pos, Op: b}
+		}
+
+		if op.Code < OpBeginMoveTo {
+			inPath = false
+		}
+		if op.Code >= OpLineTo && !inPath {
+			return nil, &ProgramError{Pos: pos, Msg: fmt.Sprintf("%v outside path", op.Code)}
+		}
+
+		base := cur
+		for i := 0; i < npt; i++ {
+			pt := d.point()
+			if seglen != 0 {
+				if i != 0 && i%seglen == 0 {
+					base = op.Pt[i-1]
+				}
+				pt = Point{base.X + pt.X, base.Y + pt.Y}
+			}
+			op.Pt = append(op.Pt, pt)
+		}
+
+		switch op.Code {
+		case OpHLineTo, OpVLineTo, OpRelHLineTo, OpRelVLineTo:
+			v, pt := d.coord(), cur
+			switch op.Code {
+			case OpHLineTo:
+				pt.X = v
+			case OpVLineTo:
+				pt.Y = v
+			case OpRelHLineTo:
+				pt.X += v
+			case OpRelVLineTo:
+				pt.Y += v
+			}
+			op.Pt = []Point{pt}
+		}
+
+		if d.err != nil {
+			return nil, &ProgramError{Pos: pos, Msg: fmt.Sprintf("%v truncated", op.Code)}
+		}
+
+		switch {
+		case op.Code == OpBeginMoveTo || op.Code == OpMoveTo:
+			start, cur = op.Pt[0], op.Pt[0]
+		case op.Code == OpClosePath:
+			cur = start
+		case op.Code >= OpLineTo:
+			cur = op.Pt[len(op.Pt)-1]
+		}
+
+		p.Ops = append(p.Ops, op)
+	}
+}
+
+type progDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *progDecoder) byte() byte {
+	if d.pos >= len(d.data) {
+		d.err = errTruncated
+		return 0
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+// gradient decodes the spread method and stops of g.
+// It returns a message describing invalid data.
+func (d *progDecoder) gradient(g *Gradient) string {
+	g.Spread = Spread(d.byte())
+	if g.Spread > SpreadRepeat {
+		return "invalid gradient spread"
+	}
+
+	n := int(d.byte())
+	if n == 0 {
+		return "gradient without stops"
+	}
+	for i := 0; i < n && d.err == nil; i++ {
+		var s GradientStop
+		s.Offset = float64(d.byte()) / 255
+		switch d.byte() {
+		case 0:
+			s.Color = color.NRGBA{d.byte(), d.byte(), d.byte(), d.byte()}
+		case 1:
+			s.Palette = true
+			s.Index = int(d.byte())
+			s.Color.A = d.byte()
+		default:
+			return "invalid gradient stop"
+		}
+		g.Stops = append(g.Stops, s)
+	}
+	return ""
+}
+
+func (d *progDecoder) coord() float64 {
+	v, n := CoordFromBytes(d.data[d.pos:])
+	if n == 0 {
+		d.err = errTruncated
+	}
+	d.pos += n
+	return v
+}
+
+func (d *progDecoder) point() Point {
+	x := d.coord()
+	y := d.coord()
+	return Point{x, y}
+}
+
+var errTruncated = fmt.Errorf("truncated data")
+
+// CoordFromBytes reads a coordinate number from p,
+// and returns the number of bytes consumed.
+// It returns n == 0 if p doesn't contain a full number.
+func CoordFromBytes(p []byte) (v float64, n int) {
+	if len(p) == 0 {
+		return 0, 0
+	}
+
+	if (p[0] & 0x01) != 0 {
+		return float64(int(p[0]>>1) - 64), 1
+	}
+
+	if len(p) < 2 {
+		return 0, 0
+	}
+
+	if (p[0] & 0x02) != 0 {
+		u := uint16(p[0]) | (uint16(p[1]) << 8)
+		x := int(u>>2) - (128 * 64)
+		return float64(x) / 64, 2
+	}
+
+	if len(p) < 4 {
+		return 0, 0
+	}
+
+	bits := byteOrder.Uint32(p)
+	return float64(math.Float32frombits(bits)), 4
+}
@@ -8,6 +8,11 @@ import (
 
 const τ = math.Pi * 2
 
+// κ is the distance of the cubic Bézier control points
+// from the end points of a 90° unit circle arc, derived from
+// http://spencermortensen.com/articles/bezier-circle
+const κ = 0.551915024494
+
 func arcToBezier(p, c, r Point, xAxisRot float64, largeArc, sweep bool) []Point {
 	px, py := p.X, p.Y
 	cx, cy := c.X, c.Y
@@ -137,14 +142,12 @@ func vectorAngle(ux, uy, vx, vy float64) float64 {
 
 func approxUnitArc(θ1, dθ float64) []Point {
 
-	// For 90° a circular arc, use a constant as derived from
-	// http://spencermortensen.com/articles/bezier-circle
+	// For 90° a circular arc, use κ.
 	var a float64
-	const chalfpi = 0.551915024494
 	if dθ == math.Pi/2 {
-		a = chalfpi
+		a = κ
 	} else if dθ == -math.Pi/2 {
-		a = -chalfpi
+		a = -κ
 	} else {
 		at := math.Tan(dθ / 2)
 		a = math.Sin(dθ) * (math.Sqrt(4+3*at*at) - 1) / 3
@@ -189,3 +192,99 @@ func mapToEllipse(p Point, rx, ry, cosφ, sinφ, centerx, centery float64) Point
 func sq(v float64) float64 {
 	return v * v
 }
+
+// arc_pts returns the 'A' PathCmd points of an elliptical arc to p.
+func arc_pts(r Point, xAxisRot float64, largeArc, sweep bool, p Point) []Point {
+	var flags float64
+	if largeArc {
+		flags += 1
+	}
+	if sweep {
+		flags += 2
+	}
+	return []Point{r, {xAxisRot, flags}, p}
+}
+
+// arc_params returns the x-axis rotation and flags
+// encoded in the second point q of an 'A' PathCmd arc.
+func arc_params(q Point) (xAxisRot float64, largeArc, sweep bool) {
+	flags := int(q.Y)
+	return q.X, flags&1 != 0, flags&2 != 0
+}
+
+// cubic_arcs returns cmds with elliptical arcs
+// approximated by cubic Bézier curves.
+func cubic_arcs(cmds []PathCmd) []PathCmd {
+	hasArc := false
+	for _, c := range cmds {
+		hasArc = hasArc || c.Cmd == 'A'
+	}
+	if !hasArc {
+		return cmds
+	}
+
+	var r []PathCmd
+	add := func(cmd byte, v ...Point) {
+		if n := len(r); n != 0 && r[n-1].Cmd == cmd && cmd != 'M' {
+			r[n-1].Pt = append(r[n-1].Pt, v...)
+		} else {
+			r = append(r, PathCmd{cmd, v})
+		}
+	}
+
+	var last Point
+	for _, c := range cmds {
+		if c.Cmd != 'A' {
+			add(c.Cmd, c.Pt...)
+			if len(c.Pt) != 0 {
+				last = c.Pt[len(c.Pt)-1]
+			}
+			continue
+		}
+		for i := 0; i+2 < len(c.Pt); i += 3 {
+			rot, largeArc, sweep := arc_params(c.Pt[i+1])
+			p := c.Pt[i+2]
+			if pts := arcToBezier(last, p, c.Pt[i], rot, largeArc, sweep); pts != nil {
+				add('C', pts...)
+			} else if p != last {
+				add('L', p)
+			}
+			last = p
+		}
+	}
+	return r
+}
+
+// transform_arc returns the radii, x-axis rotation and
+// sweep flag of an elliptical arc transformed with m.
+// The rotation of the result is within (-90, 90] degrees.
+func transform_arc(m Matrix, r Point, xAxisRot float64, sweep bool) (Point, float64, bool) {
+	sinφ, cosφ := math.Sincos(xAxisRot * τ / 360)
+
+	// Linear part of m applied to the ellipse axes.
+	a := m[0]*cosφ*r.X + m[2]*sinφ*r.X
+	b := -m[0]*sinφ*r.Y + m[2]*cosφ*r.Y
+	c := m[1]*cosφ*r.X + m[3]*sinφ*r.X
+	d := -m[1]*sinφ*r.Y + m[3]*cosφ*r.Y
+
+	// Singular value decomposition of [a b; c d].
+	e, f := (a+d)/2, (a-d)/2
+	g, h := (c+b)/2, (c-b)/2
+	q, s := math.Hypot(e, h), math.Hypot(f, g)
+	rx, ry := q+s, math.Abs(q-s)
+	rot := (math.Atan2(h, e) + math.Atan2(g, f)) / 2 * 360 / τ
+
+	switch {
+	case math.Abs(rx-ry) <= 1e-9*rx:
+		rot = 0
+	case rot <= -90:
+		rot += 180
+	case rot > 90:
+		rot -= 180
+	}
+
+	if m.Determinant() < 0 {
+		sweep = !sweep
+	}
+	return Point{rx, ry}, rot, sweep
+}
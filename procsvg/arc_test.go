@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"strings"
 	"testing"
@@ -112,3 +113,82 @@ func TestArc2Bézier(t *testing.T) {
 		w.arct(tt)
 	}
 }
+
+func TestCubicArcs(t *testing.T) {
+	cmds, err := PathDCmds("M0 4 A4 4 0 0 1 8 4 A4 4 0 0 1 0 4 Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmtCmds(cubic_arcs(cmds))
+	want := "{M 0,4} {C 0,1.7923 1.7923,0 4,0 6.2077,0 8,1.7923 8,4 " +
+		"8,6.2077 6.2077,8 4,8 1.7923,8 0,6.2077 0,4} {Z}"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	cmds = []PathCmd{
+		{'M', []Point{{0, 0}}},
+		{'A', arc_pts(Point{1, 1}, 0, false, false, Point{0, 0})},
+		{'L', []Point{{1, 0}}},
+	}
+	if got, want := fmtCmds(cubic_arcs(cmds)), "{M 0,0} {L 1,0}"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestTransformArc(t *testing.T) {
+	tests := []struct {
+		m     Matrix
+		r     Point
+		rot   float64
+		sweep bool
+
+		wantR   Point
+		wantRot float64
+		wantSw  bool
+	}{
+		{MatrixIdentity, Point{2, 1}, 0, true, Point{2, 1}, 0, true},
+		{MatrixIdentity.Scale(2, 1), Point{1, 1}, 0, true, Point{2, 1}, 0, true},
+		{MatrixIdentity.Rotate(30), Point{2, 1}, 0, false, Point{2, 1}, 30, false},
+		{MatrixIdentity.Rotate(30), Point{2, 2}, 45, false, Point{2, 2}, 0, false},
+		{MatrixIdentity.Scale(-1, 1), Point{2, 1}, 30, true, Point{2, 1}, -30, false},
+		{MatrixIdentity, Point{1, 2}, 0, true, Point{2, 1}, 90, true},
+	}
+	for _, tt := range tests {
+		r, rot, sweep := transform_arc(tt.m, tt.r, tt.rot, tt.sweep)
+		if math.Abs(r.X-tt.wantR.X) > 1e-9 || math.Abs(r.Y-tt.wantR.Y) > 1e-9 ||
+			math.Abs(rot-tt.wantRot) > 1e-9 || sweep != tt.wantSw {
+			t.Errorf("%v %v %g: got %v %g %v, want %v %g %v", tt.m, tt.r, tt.rot,
+				r, rot, sweep, tt.wantR, tt.wantRot, tt.wantSw)
+		}
+	}
+
+	// The transformed ellipse E' = M·E must have the same shape
+	// matrix E'·E'ᵀ, where E maps the unit circle to the ellipse.
+	ellipse := func(r Point, rot float64) Matrix {
+		return MatrixIdentity.Rotate(rot).Scale(r.X, r.Y)
+	}
+	shape := func(e Matrix) [3]float64 {
+		return [3]float64{
+			e[0]*e[0] + e[2]*e[2],
+			e[0]*e[1] + e[2]*e[3],
+			e[1]*e[1] + e[3]*e[3],
+		}
+	}
+	for _, m := range []Matrix{
+		{2, 0.5, -0.3, 1, 4, 5},
+		{0.5, -1, 2, 0.25, 0, 0},
+		MatrixIdentity.SkewX(40).Rotate(-70),
+	} {
+		r, rot := Point{3, 1.5}, 20.0
+		r2, rot2, _ := transform_arc(m, r, rot, true)
+		want := shape(m.Mul(ellipse(r, rot)))
+		got := shape(ellipse(r2, rot2))
+		for i := range got {
+			if math.Abs(got[i]-want[i]) > 1e-9 {
+				t.Errorf("%v: got shape %v, want %v", m, got, want)
+				break
+			}
+		}
+	}
+}
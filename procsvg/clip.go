@@ -0,0 +1,663 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Clip path conversion modes used in project files.
+const (
+	ClipOps       = "ops"
+	ClipIntersect = "intersect"
+)
+
+// clipShape is a clip path child in view box coordinates.
+type clipShape struct {
+	cmds []PathCmd
+	rule byte // 0 for nonzero and 1 for evenodd
+}
+
+// push_clip applies the clip-path property value a of n.
+// It returns a function restoring the clip region after n
+// has been painted, or false if n is clipped entirely.
+func (g *svgprog) push_clip(n Node, a string) (func(), bool, error) {
+	nop := func() {}
+
+	id, ok := paint_url(a)
+	ref := g.ids[id]
+	if !ok || ref == nil || ref.Name.Local != "clipPath" {
+		fmt.Fprintf(os.Stderr, "invalid clip-path reference %q in %s\n", a, g.fn)
+		return nop, true, nil
+	}
+
+	shapes, err := g.clip_shapes(n, ref)
+	if err != nil {
+		return nil, false, err
+	}
+	return g.apply_clip(id, shapes)
+}
+
+// apply_clip intersects the clip region with the union of shapes.
+// It returns a function restoring the clip region,
+// or false if the clip region is empty.
+func (g *svgprog) apply_clip(id string, shapes []clipShape) (func(), bool, error) {
+	if len(shapes) == 0 {
+		return func() {}, false, nil
+	}
+
+	if g.clipIntersect {
+		if poly, ok := convex_polygon(shapes, g.flatness()); ok {
+			g.clipPolys = append(g.clipPolys, poly)
+			return func() {
+				g.clipPolys = g.clipPolys[:len(g.clipPolys)-1]
+			}, true, nil
+		}
+		g.verbose("clip path %q is not convex, using clip ops", id)
+	}
+
+	rule := shapes[0].rule
+	for _, s := range shapes[1:] {
+		if s.rule != rule {
+			fmt.Fprintf(os.Stderr, "clip path %q with mixed clip rules in %s\n", id, g.fn)
+			break
+		}
+	}
+
+	g.mem.Byte(0x20)
+	g.mem.Byte(rule)
+	for _, s := range shapes {
+		g.mem.BeginPath(MatrixIdentity)
+		for _, c := range g.simplify(strip_close(s.cmds), MatrixIdentity) {
+			if err := g.mem.PathCmd(c); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	return func() {
+		g.mem.Byte(0x21)
+	}, true, nil
+}
+
+// clip_shapes returns the shapes of clipPath element ref
+// applied to element n.
+func (g *svgprog) clip_shapes(n Node, ref *Node) ([]clipShape, error) {
+	m := g.transform()
+	if hasattr(*ref, "transform") {
+		mat, err := SvgTransformMatrix(findattr(*ref, "transform"))
+		if err != nil {
+			return nil, fmt.Errorf("clipPath transform: %w", err)
+		}
+		m = m.Mul(mat)
+	}
+
+	if findattr(*ref, "clipPathUnits") == "objectBoundingBox" {
+		b, err := node_bbox(n, MatrixIdentity, g.viewport)
+		if err != nil {
+			return nil, err
+		}
+		w, h := b[1].X-b[0].X, b[1].Y-b[0].Y
+		if !(w > 0 && h > 0) {
+			return nil, nil
+		}
+		m = m.Translate(b[0].X, b[0].Y).Scale(w, h)
+	}
+
+	rule, _ := get_svg_clip_rule(*ref)
+
+	var shapes []clipShape
+	for _, c := range ref.Node {
+		if is_hidden(c) {
+			continue
+		}
+
+		cm, crule := m, rule
+		if r, ok := get_svg_clip_rule(c); ok {
+			crule = r
+		}
+		if hasattr(c, "transform") {
+			mat, err := SvgTransformMatrix(findattr(c, "transform"))
+			if err != nil {
+				return nil, fmt.Errorf("transform: %w", err)
+			}
+			cm = cm.Mul(mat)
+		}
+
+		if c.Name.Local == "use" {
+			id := strings.TrimPrefix(get_href(c), "#")
+			u := g.ids[id]
+			if u == nil {
+				fmt.Fprintf(os.Stderr, "invalid use reference %q in %s\n", id, g.fn)
+				continue
+			}
+			x, y, _, _, err := shapeattrs(c, g.viewport, "x", "y", "width", "height")
+			if err != nil {
+				return nil, err
+			}
+			cm = cm.Translate(x, y)
+			if r, ok := get_svg_clip_rule(*u); ok {
+				crule = r
+			}
+			if hasattr(*u, "transform") {
+				mat, err := SvgTransformMatrix(findattr(*u, "transform"))
+				if err != nil {
+					return nil, fmt.Errorf("transform: %w", err)
+				}
+				cm = cm.Mul(mat)
+			}
+			c = *u
+		}
+
+		cmds, ok, err := element_cmds(c, g.viewport)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unsupported %s in clip path in %s\n", c.Name.Local, g.fn)
+			continue
+		}
+		if len(cmds) != 0 {
+			shapes = append(shapes, clipShape{transform_cmds(cmds, cm), crule})
+		}
+	}
+	return shapes, nil
+}
+
+// get_svg_clip_rule returns the clip rule of n,
+// 0 for nonzero and 1 for evenodd.
+func get_svg_clip_rule(n Node) (byte, bool) {
+	switch get_presentation_attr(n, "clip-rule") {
+	case "nonzero":
+		return 0, true
+	case "evenodd":
+		return 1, true
+	}
+	return 0, false
+}
+
+// element_cmds returns the path of a path or basic shape element
+// with elliptical arcs approximated by cubic Bézier curves.
+// Percentage lengths are relative to the viewport size vp.
+// It returns false for other elements.
+func element_cmds(n Node, vp Point) ([]PathCmd, bool, error) {
+	switch n.Name.Local {
+	case "path":
+		cmds, err := PathDCmds(findattr(n, "d"))
+		return cubic_arcs(cmds), true, err
+
+	case "rect", "circle", "ellipse", "line", "polyline", "polygon":
+		cmds, err := ShapeCmds(n, vp)
+		return cubic_arcs(cmds), true, err
+	}
+	return nil, false, nil
+}
+
+// node_bbox returns the bounding box of the paths
+// of n and its descendants transformed with m.
+// Percentage lengths are relative to the viewport size vp.
+func node_bbox(n Node, m Matrix, vp Point) ([2]Point, error) {
+	inf := math.Inf(1)
+	b := [2]Point{{inf, inf}, {-inf, -inf}}
+	if is_hidden(n) || is_definition(n) {
+		return b, nil
+	}
+
+	cmds, ok, err := element_cmds(n, vp)
+	if err != nil || ok {
+		if len(cmds) != 0 {
+			b = cmds_bbox(transform_cmds(cmds, m))
+		}
+		return b, err
+	}
+
+	for _, c := range n.Node {
+		cm := m
+		if hasattr(c, "transform") {
+			mat, err := SvgTransformMatrix(findattr(c, "transform"))
+			if err != nil {
+				return b, fmt.Errorf("transform: %w", err)
+			}
+			cm = m.Mul(mat)
+		}
+		cb, err := node_bbox(c, cm, vp)
+		if err != nil {
+			return b, err
+		}
+		b[0].X = math.Min(b[0].X, cb[0].X)
+		b[0].Y = math.Min(b[0].Y, cb[0].Y)
+		b[1].X = math.Max(b[1].X, cb[1].X)
+		b[1].Y = math.Max(b[1].Y, cb[1].Y)
+	}
+	return b, nil
+}
+
+// transform_cmds returns cmds transformed with m.
+func transform_cmds(cmds []PathCmd, m Matrix) []PathCmd {
+	r := make([]PathCmd, len(cmds))
+	for i, c := range cmds {
+		r[i].Cmd = c.Cmd
+		r[i].Pt = make([]Point, len(c.Pt))
+		for j, p := range c.Pt {
+			r[i].Pt[j] = m.Transform(p)
+		}
+	}
+	return r
+}
+
+// flatness returns the tolerance for flattening clip paths.
+func (g *svgprog) flatness() float64 {
+	vb := g.viewbox
+	return math.Max(g.mem.Precision, math.Max(vb[1].X-vb[0].X, vb[1].Y-vb[0].Y)/1000)
+}
+
+// clip_path intersects the path cmds with the clip polygons.
+// It returns the clipped path and its transformation, or false if
+// the path is stroked and its stroke may cross the clip region boundary.
+// The clipped path is empty if nothing remains visible.
+func (g *svgprog) clip_path(cmds []PathCmd) ([]PathCmd, Matrix, bool) {
+	vc := transform_cmds(cmds, g.transform())
+	b := cmds_bbox(vc)
+	if g.stroke_visible() {
+		m := g.transform()
+		f := math.Sqrt2
+		if g.stroke.join == 0 && g.stroke.miterLimit > f {
+			f = g.stroke.miterLimit
+		}
+		d := g.stroke.width * math.Sqrt(math.Abs(m.Determinant())) * f / 2
+		b[0].X, b[0].Y = b[0].X-d, b[0].Y-d
+		b[1].X, b[1].Y = b[1].X+d, b[1].Y+d
+	}
+
+	corners := []Point{b[0], {b[1].X, b[0].Y}, b[1], {b[0].X, b[1].Y}}
+	inside := true
+	for _, poly := range g.clipPolys {
+		for i := range poly {
+			a, e := poly[i], poly[(i+1)%len(poly)]
+			nin := 0
+			for _, p := range corners {
+				if side(a, e, p) >= 0 {
+					nin++
+				}
+			}
+			if nin == 0 {
+				return nil, MatrixIdentity, true
+			}
+			inside = inside && nin == len(corners)
+		}
+	}
+	if inside {
+		return cmds, g.transform(), true
+	}
+	if g.stroke_visible() {
+		return nil, MatrixIdentity, false
+	}
+
+	var res []PathCmd
+	for _, sp := range cmds_subpaths(vc) {
+		for _, poly := range g.clipPolys {
+			for i := range poly {
+				sp = clip_subpath(sp, poly[i], poly[(i+1)%len(poly)])
+			}
+		}
+		res = append(res, subpath_cmds(sp)...)
+	}
+	return res, MatrixIdentity, true
+}
+
+// clip_poly_ops emits clip ops for the clip polygons,
+// and returns the number of PopClip ops needed to restore the clip region.
+func (g *svgprog) clip_poly_ops() (int, error) {
+	for _, poly := range g.clipPolys {
+		g.mem.Byte(0x20)
+		g.mem.Byte(0)
+		g.mem.BeginPath(MatrixIdentity)
+		if err := g.mem.PathCmd(PathCmd{'M', poly[:1]}); err != nil {
+			return 0, err
+		}
+		if err := g.mem.PathCmd(PathCmd{'L', poly[1:]}); err != nil {
+			return 0, err
+		}
+	}
+	return len(g.clipPolys), nil
+}
+
+// bezier is a line, quadratic or cubic Bézier segment
+// defined by its 2, 3 or 4 control points.
+type bezier []Point
+
+// at returns the point of b at t.
+func (b bezier) at(t float64) Point {
+	l, _ := b.split(t)
+	return l[len(l)-1]
+}
+
+// split splits b at t using de Casteljau's algorithm.
+func (b bezier) split(t float64) (bezier, bezier) {
+	n := len(b)
+	l, r := make(bezier, n), make(bezier, n)
+	p := append(bezier(nil), b...)
+	for k := 0; k < n; k++ {
+		l[k], r[n-1-k] = p[0], p[n-1-k]
+		for i := 0; i < n-1-k; i++ {
+			p[i] = Point{p[i].X + (p[i+1].X-p[i].X)*t, p[i].Y + (p[i+1].Y-p[i].Y)*t}
+		}
+	}
+	return l, r
+}
+
+// cmds_subpaths returns the subpaths of cmds as segments.
+// Subpaths are closed with a line if needed.
+func cmds_subpaths(cmds []PathCmd) [][]bezier {
+	var v [][]bezier
+	var sp []bezier
+	var start, cur Point
+	close := func() {
+		if len(sp) != 0 && cur != start {
+			sp = append(sp, bezier{cur, start})
+		}
+		if len(sp) != 0 {
+			v = append(v, sp)
+		}
+		sp = nil
+	}
+	for _, c := range cmds {
+		k := 1
+		switch c.Cmd {
+		case 'M':
+			close()
+			start, cur = c.Pt[0], c.Pt[0]
+			continue
+		case 'Z':
+			close()
+			cur = start
+			continue
+		case 'Q':
+			k = 2
+		case 'C':
+			k = 3
+		}
+		for i := 0; i+k <= len(c.Pt); i += k {
+			b := append(bezier{cur}, c.Pt[i:i+k]...)
+			sp = append(sp, b)
+			cur = b[k]
+		}
+	}
+	close()
+	return v
+}
+
+// subpath_cmds returns the path cmds of the closed subpath sp.
+func subpath_cmds(sp []bezier) []PathCmd {
+	if len(sp) == 0 {
+		return nil
+	}
+	cmds := []PathCmd{{'M', []Point{sp[0][0]}}}
+	for _, b := range sp {
+		cmd := []byte{0, 0, 'L', 'Q', 'C'}[len(b)]
+		last := &cmds[len(cmds)-1]
+		if last.Cmd == cmd {
+			last.Pt = append(last.Pt, b[1:]...)
+		} else {
+			cmds = append(cmds, PathCmd{cmd, append([]Point(nil), b[1:]...)})
+		}
+	}
+	return cmds
+}
+
+// side returns the signed distance of p from the line through a and e.
+// It is positive on the inside of clip polygons.
+func side(a, e, p Point) float64 {
+	dx, dy := e.X-a.X, e.Y-a.Y
+	return (dx*(p.Y-a.Y) - dy*(p.X-a.X)) / math.Hypot(dx, dy)
+}
+
+// clip_subpath returns the part of the closed subpath sp
+// inside the line from a to e, closed along the line.
+func clip_subpath(sp []bezier, a, e Point) []bezier {
+	var out []bezier
+	add := func(b bezier) {
+		if n := len(out); n != 0 {
+			if last := out[n-1][len(out[n-1])-1]; last != b[0] {
+				out = append(out, bezier{last, b[0]})
+			}
+		}
+		out = append(out, b)
+	}
+
+	for _, b := range sp {
+		d := make([]float64, len(b))
+		nin, nout := 0, 0
+		for i, p := range b {
+			d[i] = side(a, e, p)
+			if d[i] >= 0 {
+				nin++
+			}
+			if d[i] <= 0 {
+				nout++
+			}
+		}
+		switch {
+		case nin == len(b):
+			add(b)
+			continue
+		case nout == len(b):
+			continue
+		}
+
+		t0 := 0.0
+		rest := b
+		for _, t := range append(bernstein_roots(d), 1) {
+			var piece bezier
+			if t < 1 {
+				piece, rest = rest.split((t - t0) / (1 - t0))
+			} else {
+				piece = rest
+			}
+			t0 = t
+			if side(a, e, piece.at(0.5)) >= 0 {
+				add(piece)
+			}
+		}
+	}
+
+	if n := len(out); n != 0 {
+		if last := out[n-1][len(out[n-1])-1]; last != out[0][0] {
+			out = append(out, bezier{last, out[0][0]})
+		}
+	}
+	return out
+}
+
+// bernstein_roots returns the roots in (0, 1) of the polynomial
+// with Bernstein coefficients d in increasing order.
+func bernstein_roots(d []float64) []float64 {
+	var c []float64 // power basis coefficients
+	switch len(d) {
+	case 2:
+		c = []float64{d[0], d[1] - d[0]}
+	case 3:
+		c = []float64{d[0], 2 * (d[1] - d[0]), d[0] - 2*d[1] + d[2]}
+	case 4:
+		c = []float64{
+			d[0],
+			3 * (d[1] - d[0]),
+			3 * (d[0] - 2*d[1] + d[2]),
+			-d[0] + 3*d[1] - 3*d[2] + d[3],
+		}
+	}
+	return poly_roots01(c)
+}
+
+// poly_roots01 returns the roots of the polynomial c[0] + c[1]x + ...
+// in (0, 1) where it changes sign, in increasing order.
+// Roots are bracketed between the roots of the derivative.
+func poly_roots01(c []float64) []float64 {
+	for len(c) > 1 && math.Abs(c[len(c)-1]) < 1e-12 {
+		c = c[:len(c)-1]
+	}
+	eval := func(x float64) float64 {
+		v := 0.0
+		for i := len(c) - 1; i >= 0; i-- {
+			v = v*x + c[i]
+		}
+		return v
+	}
+
+	const eps = 1e-9
+	switch len(c) {
+	case 0, 1:
+		return nil
+	case 2:
+		if x := -c[0] / c[1]; eps < x && x < 1-eps {
+			return []float64{x}
+		}
+		return nil
+	}
+
+	deriv := make([]float64, len(c)-1)
+	for i := range deriv {
+		deriv[i] = float64(i+1) * c[i+1]
+	}
+	bounds := append(append([]float64{0}, poly_roots01(deriv)...), 1)
+
+	var roots []float64
+	for i := 0; i+1 < len(bounds); i++ {
+		lo, hi := bounds[i], bounds[i+1]
+		flo, fhi := eval(lo), eval(hi)
+		if flo*fhi >= 0 {
+			continue
+		}
+		for k := 0; k < 60; k++ {
+			mid := (lo + hi) / 2
+			if fm := eval(mid); (fm < 0) == (flo < 0) {
+				lo, flo = mid, fm
+			} else {
+				hi = mid
+			}
+		}
+		if x := (lo + hi) / 2; eps < x && x < 1-eps {
+			roots = append(roots, x)
+		}
+	}
+	return roots
+}
+
+// convex_polygon returns the polygon of shapes flattened with
+// tolerance tol, oriented with its inside on the positive side
+// of its edges. It returns false unless shapes is a single
+// convex subpath with a nonzero area.
+func convex_polygon(shapes []clipShape, tol float64) ([]Point, bool) {
+	if len(shapes) != 1 {
+		return nil, false
+	}
+	if len(cmds_subpaths(shapes[0].cmds)) != 1 {
+		return nil, false
+	}
+
+	var poly []Point
+	for _, p := range flatten_cmds(shapes[0].cmds, tol)[0] {
+		if n := len(poly); n == 0 || math.Hypot(p.X-poly[n-1].X, p.Y-poly[n-1].Y) > tol/100 {
+			poly = append(poly, p)
+		}
+	}
+	if n := len(poly); n > 1 && math.Hypot(poly[0].X-poly[n-1].X, poly[0].Y-poly[n-1].Y) <= tol/100 {
+		poly = poly[:n-1]
+	}
+	if len(poly) < 3 {
+		return nil, false
+	}
+
+	var area, turn float64
+	sign := 0.0
+	for i := range poly {
+		p0, p1, p2 := poly[i], poly[(i+1)%len(poly)], poly[(i+2)%len(poly)]
+		area += p0.X*p1.Y - p1.X*p0.Y
+
+		ux, uy := p1.X-p0.X, p1.Y-p0.Y
+		vx, vy := p2.X-p1.X, p2.Y-p1.Y
+		cross, dot := ux*vy-uy*vx, ux*vx+uy*vy
+		if math.Abs(cross) > 1e-12*math.Hypot(ux, uy)*math.Hypot(vx, vy) {
+			if sign*cross < 0 {
+				return nil, false
+			}
+			sign = math.Copysign(1, cross)
+		}
+		turn += math.Atan2(cross, dot)
+	}
+	if math.Abs(math.Abs(turn)-2*math.Pi) > 1e-6 || math.Abs(area) < 1e-12 {
+		return nil, false
+	}
+
+	if area < 0 {
+		for i, j := 0, len(poly)-1; i < j; i, j = i+1, j-1 {
+			poly[i], poly[j] = poly[j], poly[i]
+		}
+	}
+	return poly, true
+}
+
+// flatten_cmds returns the subpaths of cmds
+// as polylines within tolerance tol.
+// Closed subpaths end at their start point.
+func flatten_cmds(cmds []PathCmd, tol float64) [][]Point {
+	var v [][]Point
+	var cur Point
+	for _, c := range cmds {
+		k := 1
+		switch c.Cmd {
+		case 'M':
+			cur = c.Pt[0]
+			v = append(v, []Point{cur})
+			continue
+		case 'Z':
+			if len(v) != 0 {
+				sp := &v[len(v)-1]
+				cur = (*sp)[0]
+				*sp = append(*sp, cur)
+			}
+			continue
+		case 'Q':
+			k = 2
+		case 'C':
+			k = 3
+		}
+		if len(v) == 0 {
+			v = append(v, []Point{cur})
+		}
+		sp := &v[len(v)-1]
+		for i := 0; i+k <= len(c.Pt); i += k {
+			b := append(bezier{cur}, c.Pt[i:i+k]...)
+			*sp = append(*sp, b.flatten(tol)...)
+			cur = b[k]
+		}
+	}
+	return v
+}
+
+// flatten returns points of b after its start point
+// approximating b within tolerance tol.
+func (b bezier) flatten(tol float64) []Point {
+	if len(b) == 2 {
+		return []Point{b[1]}
+	}
+
+	// Wang's formula for the number of segments.
+	var m float64
+	for i := 0; i+2 < len(b); i++ {
+		m = math.Max(m, math.Hypot(b[i].X-2*b[i+1].X+b[i+2].X, b[i].Y-2*b[i+1].Y+b[i+2].Y))
+	}
+	deg := float64(len(b) - 1)
+	n := int(math.Ceil(math.Sqrt(deg * (deg - 1) / 8 * m / tol)))
+	if n < 1 {
+		n = 1
+	} else if n > 100 {
+		n = 100
+	}
+
+	pts := make([]Point, 0, n)
+	for i := 1; i < n; i++ {
+		pts = append(pts, b.at(float64(i)/float64(n)))
+	}
+	return append(pts, b[len(b)-1])
+}
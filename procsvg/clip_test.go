@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClipSubpath(t *testing.T) {
+	// circle of radius 4 around (4, 4)
+	cmds, err := PathDCmds("M0 4 A4 4 0 0 1 8 4 A4 4 0 0 1 0 4 Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keep the left half
+	var res []PathCmd
+	for _, sp := range cmds_subpaths(cubic_arcs(cmds)) {
+		sp = clip_subpath(sp, Point{4, -10}, Point{4, 10})
+		res = append(res, subpath_cmds(sp)...)
+	}
+
+	b := cmds_bbox(res)
+	want := [2]Point{{0, 0}, {4, 8}}
+	for i := range b {
+		if math.Abs(b[i].X-want[i].X) > 1e-6 || math.Abs(b[i].Y-want[i].Y) > 1e-6 {
+			t.Fatalf("got bbox %v, want %v", b, want)
+		}
+	}
+}
+
+func TestConvexPolygon(t *testing.T) {
+	tests := []struct {
+		d    string
+		want bool
+	}{
+		{"M0 0 L10 0 L10 10 L0 10 Z", true},
+		{"M0 0 L0 10 L10 10 L10 0", true},
+		{"M0 0 C5 -5 10 0 10 0 L5 10 Z", true},
+		{"M0 0 L10 0 L5 2 L10 10 L0 10 Z", false},
+		{"M0 0 L10 10 L10 0 L0 10 Z", false},
+		{"M0 0 L10 0 L10 10 Z M20 20 L30 20 L30 30 Z", false},
+		{"M0 0 L10 0 L20 0 Z", false},
+	}
+	for _, tt := range tests {
+		cmds, err := PathDCmds(tt.d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		poly, ok := convex_polygon([]clipShape{{cmds: cmds}}, 0.01)
+		if ok != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.d, ok, tt.want)
+			continue
+		}
+		for i := range poly {
+			if side(poly[i], poly[(i+1)%len(poly)], poly[(i+2)%len(poly)]) < -1e-9 {
+				t.Errorf("%q: polygon %v not oriented", tt.d, poly)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parse_color parses a CSS color value.
+//
+// It accepts hex colors (#rgb, #rgba, #rrggbb, #rrggbbaa),
+// the functional notations rgb(), rgba(), hsl() and hsla(),
+// the SVG color keywords, transparent and currentColor,
+// which is resolved to current.
+func parse_color(s string, current color.NRGBA) (color.NRGBA, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return color.NRGBA{}, false
+	}
+
+	if s[0] == '#' {
+		return parse_hex_color(s[1:])
+	}
+
+	lower := strings.ToLower(s)
+	switch lower {
+	case "transparent":
+		return color.NRGBA{}, true
+	case "currentcolor":
+		return current, true
+	}
+
+	if v, ok := namedColors[lower]; ok {
+		return color.NRGBA{byte(v >> 16), byte(v >> 8), byte(v), 0xff}, true
+	}
+
+	open := strings.IndexByte(lower, '(')
+	if open < 0 || !strings.HasSuffix(lower, ")") {
+		return color.NRGBA{}, false
+	}
+	fn := strings.TrimSpace(lower[:open])
+	args, ok := color_args(lower[open+1 : len(lower)-1])
+	if !ok {
+		return color.NRGBA{}, false
+	}
+
+	switch fn {
+	case "rgb", "rgba":
+		return rgb_color(args)
+	case "hsl", "hsla":
+		return hsl_color(args)
+	}
+	return color.NRGBA{}, false
+}
+
+func parse_hex_color(h string) (color.NRGBA, bool) {
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+
+	switch len(h) {
+	case 3:
+		r := (byte(v>>8) & 0xf) * 0x11
+		g := (byte(v>>4) & 0xf) * 0x11
+		b := (byte(v) & 0xf) * 0x11
+		return color.NRGBA{r, g, b, 0xff}, true
+
+	case 4:
+		r := (byte(v>>12) & 0xf) * 0x11
+		g := (byte(v>>8) & 0xf) * 0x11
+		b := (byte(v>>4) & 0xf) * 0x11
+		a := (byte(v) & 0xf) * 0x11
+		return color.NRGBA{r, g, b, a}, true
+
+	case 6:
+		return color.NRGBA{byte(v >> 16), byte(v >> 8), byte(v), 0xff}, true
+
+	case 8:
+		return color.NRGBA{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}, true
+	}
+
+	return color.NRGBA{}, false
+}
+
+// color_args splits the arguments of a color function.
+// Both the legacy comma separated and the space separated
+// syntax with an optional "/ alpha" are accepted.
+// The alpha argument, if present, is the fourth element.
+func color_args(s string) ([]string, bool) {
+	var args []string
+	if strings.Contains(s, ",") {
+		args = strings.Split(s, ",")
+		for i := range args {
+			args[i] = strings.TrimSpace(args[i])
+		}
+	} else {
+		alpha := ""
+		if i := strings.IndexByte(s, '/'); i >= 0 {
+			alpha = strings.TrimSpace(s[i+1:])
+			s = s[:i]
+			if alpha == "" {
+				return nil, false
+			}
+		}
+		args = strings.Fields(s)
+		if alpha != "" {
+			if len(args) != 3 {
+				return nil, false
+			}
+			args = append(args, alpha)
+		}
+	}
+
+	if len(args) != 3 && len(args) != 4 {
+		return nil, false
+	}
+	return args, true
+}
+
+func rgb_color(args []string) (color.NRGBA, bool) {
+	var v [3]float64
+	for i := range v {
+		a := args[i]
+		var err error
+		if strings.HasSuffix(a, "%") {
+			v[i], err = strconv.ParseFloat(a[:len(a)-1], 64)
+			v[i] /= 100
+		} else {
+			v[i], err = strconv.ParseFloat(a, 64)
+			v[i] /= 255
+		}
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+	}
+
+	alpha, ok := color_alpha(args)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+
+	return color.NRGBA{
+		R: color_byte(v[0]),
+		G: color_byte(v[1]),
+		B: color_byte(v[2]),
+		A: color_byte(alpha),
+	}, true
+}
+
+func hsl_color(args []string) (color.NRGBA, bool) {
+	h, ok := parse_hue(args[0])
+	if !ok {
+		return color.NRGBA{}, false
+	}
+
+	var sl [2]float64
+	for i := range sl {
+		a := args[i+1]
+		if !strings.HasSuffix(a, "%") {
+			return color.NRGBA{}, false
+		}
+		v, err := strconv.ParseFloat(a[:len(a)-1], 64)
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+		sl[i] = clamp01(v / 100)
+	}
+
+	alpha, ok := color_alpha(args)
+	if !ok {
+		return color.NRGBA{}, false
+	}
+
+	r, g, b := hsl_to_rgb(h, sl[0], sl[1])
+	return color.NRGBA{
+		R: color_byte(r),
+		G: color_byte(g),
+		B: color_byte(b),
+		A: color_byte(alpha),
+	}, true
+}
+
+// parse_hue parses a CSS hue angle in degrees.
+func parse_hue(s string) (float64, bool) {
+	units := []struct {
+		suffix string
+		deg    float64
+	}{
+		{"deg", 1},
+		{"grad", 360.0 / 400},
+		{"rad", 180 / math.Pi},
+		{"turn", 360},
+	}
+
+	f := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s = s[:len(s)-len(u.suffix)]
+			f = u.deg
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * f, true
+}
+
+// color_alpha returns the optional fourth color function argument.
+func color_alpha(args []string) (float64, bool) {
+	if len(args) < 4 {
+		return 1, true
+	}
+	v, err := parse_opacity(args[3])
+	return v, err == nil
+}
+
+// hsl_to_rgb converts a color with hue h in degrees,
+// saturation s and lightness l in [0, 1] to RGB in [0, 1].
+func hsl_to_rgb(h, s, l float64) (r, g, b float64) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+
+	f := func(n float64) float64 {
+		k := math.Mod(n+h/30, 12)
+		a := s * math.Min(l, 1-l)
+		return l - a*math.Max(-1, math.Min(k-3, math.Min(9-k, 1)))
+	}
+	return f(0), f(8), f(4)
+}
+
+// color_byte converts v in [0, 1] to a color component.
+func color_byte(v float64) uint8 {
+	return uint8(clamp01(v)*0xff + 0.5)
+}
+
+// split_colors splits s into color values separated by
+// spaces, commas or other punctuation outside parentheses.
+func split_colors(s string) []string {
+	var v []string
+	depth := 0
+	start := -1
+	for i, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && !color_rune(r):
+			if start >= 0 {
+				v = append(v, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		v = append(v, s[start:])
+	}
+	return v
+}
+
+func color_rune(r rune) bool {
+	return r == '#' ||
+		('0' <= r && r <= '9') ||
+		('a' <= r && r <= 'z') ||
+		('A' <= r && r <= 'Z')
+}
+
+// namedColors are the SVG color keywords.
+var namedColors = map[string]uint32{
+	"aliceblue":            0xf0f8ff,
+	"antiquewhite":         0xfaebd7,
+	"aqua":                 0x00ffff,
+	"aquamarine":           0x7fffd4,
+	"azure":                0xf0ffff,
+	"beige":                0xf5f5dc,
+	"bisque":               0xffe4c4,
+	"black":                0x000000,
+	"blanchedalmond":       0xffebcd,
+	"blue":                 0x0000ff,
+	"blueviolet":           0x8a2be2,
+	"brown":                0xa52a2a,
+	"burlywood":            0xdeb887,
+	"cadetblue":            0x5f9ea0,
+	"chartreuse":           0x7fff00,
+	"chocolate":            0xd2691e,
+	"coral":                0xff7f50,
+	"cornflowerblue":       0x6495ed,
+	"cornsilk":             0xfff8dc,
+	"crimson":              0xdc143c,
+	"cyan":                 0x00ffff,
+	"darkblue":             0x00008b,
+	"darkcyan":             0x008b8b,
+	"darkgoldenrod":        0xb8860b,
+	"darkgray":             0xa9a9a9,
+	"darkgreen":            0x006400,
+	"darkgrey":             0xa9a9a9,
+	"darkkhaki":            0xbdb76b,
+	"darkmagenta":          0x8b008b,
+	"darkolivegreen":       0x556b2f,
+	"darkorange":           0xff8c00,
+	"darkorchid":           0x9932cc,
+	"darkred":              0x8b0000,
+	"darksalmon":           0xe9967a,
+	"darkseagreen":         0x8fbc8f,
+	"darkslateblue":        0x483d8b,
+	"darkslategray":        0x2f4f4f,
+	"darkslategrey":        0x2f4f4f,
+	"darkturquoise":        0x00ced1,
+	"darkviolet":           0x9400d3,
+	"deeppink":             0xff1493,
+	"deepskyblue":          0x00bfff,
+	"dimgray":              0x696969,
+	"dimgrey":              0x696969,
+	"dodgerblue":           0x1e90ff,
+	"firebrick":            0xb22222,
+	"floralwhite":          0xfffaf0,
+	"forestgreen":          0x228b22,
+	"fuchsia":              0xff00ff,
+	"gainsboro":            0xdcdcdc,
+	"ghostwhite":           0xf8f8ff,
+	"gold":                 0xffd700,
+	"goldenrod":            0xdaa520,
+	"gray":                 0x808080,
+	"grey":                 0x808080,
+	"green":                0x008000,
+	"greenyellow":          0xadff2f,
+	"honeydew":             0xf0fff0,
+	"hotpink":              0xff69b4,
+	"indianred":            0xcd5c5c,
+	"indigo":               0x4b0082,
+	"ivory":                0xfffff0,
+	"khaki":                0xf0e68c,
+	"lavender":             0xe6e6fa,
+	"lavenderblush":        0xfff0f5,
+	"lawngreen":            0x7cfc00,
+	"lemonchiffon":         0xfffacd,
+	"lightblue":            0xadd8e6,
+	"lightcoral":           0xf08080,
+	"lightcyan":            0xe0ffff,
+	"lightgoldenrodyellow": 0xfafad2,
+	"lightgray":            0xd3d3d3,
+	"lightgreen":           0x90ee90,
+	"lightgrey":            0xd3d3d3,
+	"lightpink":            0xffb6c1,
+	"lightsalmon":          0xffa07a,
+	"lightseagreen":        0x20b2aa,
+	"lightskyblue":         0x87cefa,
+	"lightslategray":       0x778899,
+	"lightslategrey":       0x778899,
+	"lightsteelblue":       0xb0c4de,
+	"lightyellow":          0xffffe0,
+	"lime":                 0x00ff00,
+	"limegreen":            0x32cd32,
+	"linen":                0xfaf0e6,
+	"magenta":              0xff00ff,
+	"maroon":               0x800000,
+	"mediumaquamarine":     0x66cdaa,
+	"mediumblue":           0x0000cd,
+	"mediumorchid":         0xba55d3,
+	"mediumpurple":         0x9370db,
+	"mediumseagreen":       0x3cb371,
+	"mediumslateblue":      0x7b68ee,
+	"mediumspringgreen":    0x00fa9a,
+	"mediumturquoise":      0x48d1cc,
+	"mediumvioletred":      0xc71585,
+	"midnightblue":         0x191970,
+	"mintcream":            0xf5fffa,
+	"mistyrose":            0xffe4e1,
+	"moccasin":             0xffe4b5,
+	"navajowhite":          0xffdead,
+	"navy":                 0x000080,
+	"oldlace":              0xfdf5e6,
+	"olive":                0x808000,
+	"olivedrab":            0x6b8e23,
+	"orange":               0xffa500,
+	"orangered":            0xff4500,
+	"orchid":               0xda70d6,
+	"palegoldenrod":        0xeee8aa,
+	"palegreen":            0x98fb98,
+	"paleturquoise":        0xafeeee,
+	"palevioletred":        0xdb7093,
+	"papayawhip":           0xffefd5,
+	"peachpuff":            0xffdab9,
+	"peru":                 0xcd853f,
+	"pink":                 0xffc0cb,
+	"plum":                 0xdda0dd,
+	"powderblue":           0xb0e0e6,
+	"purple":               0x800080,
+	"red":                  0xff0000,
+	"rosybrown":            0xbc8f8f,
+	"royalblue":            0x4169e1,
+	"saddlebrown":          0x8b4513,
+	"salmon":               0xfa8072,
+	"sandybrown":           0xf4a460,
+	"seagreen":             0x2e8b57,
+	"seashell":             0xfff5ee,
+	"sienna":               0xa0522d,
+	"silver":               0xc0c0c0,
+	"skyblue":              0x87ceeb,
+	"slateblue":            0x6a5acd,
+	"slategray":            0x708090,
+	"slategrey":            0x708090,
+	"snow":                 0xfffafa,
+	"springgreen":          0x00ff7f,
+	"steelblue":            0x4682b4,
+	"tan":                  0xd2b48c,
+	"teal":                 0x008080,
+	"thistle":              0xd8bfd8,
+	"tomato":               0xff6347,
+	"turquoise":            0x40e0d0,
+	"violet":               0xee82ee,
+	"wheat":                0xf5deb3,
+	"white":                0xffffff,
+	"whitesmoke":           0xf5f5f5,
+	"yellow":               0xffff00,
+	"yellowgreen":          0x9acd32,
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	current := color.NRGBA{1, 2, 3, 4}
+
+	tests := []struct {
+		s    string
+		want color.NRGBA
+		ok   bool
+	}{
+		{"#f80", color.NRGBA{0xff, 0x88, 0x00, 0xff}, true},
+		{"#f808", color.NRGBA{0xff, 0x88, 0x00, 0x88}, true},
+		{"#FF8000", color.NRGBA{0xff, 0x80, 0x00, 0xff}, true},
+		{"#ff800080", color.NRGBA{0xff, 0x80, 0x00, 0x80}, true},
+		{"#ff80", color.NRGBA{0xff, 0xff, 0x88, 0x00}, true},
+		{"#ff8", color.NRGBA{0xff, 0xff, 0x88, 0xff}, true},
+		{"#ff80000", color.NRGBA{}, false},
+		{"#gggggg", color.NRGBA{}, false},
+		{"red", color.NRGBA{0xff, 0, 0, 0xff}, true},
+		{" CornflowerBlue ", color.NRGBA{0x64, 0x95, 0xed, 0xff}, true},
+		{"transparent", color.NRGBA{}, true},
+		{"currentColor", current, true},
+		{"rgb(255, 128, 0)", color.NRGBA{0xff, 0x80, 0x00, 0xff}, true},
+		{"rgb(100%, 50%, 0%)", color.NRGBA{0xff, 0x80, 0x00, 0xff}, true},
+		{"rgba(255, 0, 0, 0.5)", color.NRGBA{0xff, 0, 0, 0x80}, true},
+		{"rgb(255 0 0 / 50%)", color.NRGBA{0xff, 0, 0, 0x80}, true},
+		{"RGB(300, -10, 0)", color.NRGBA{0xff, 0, 0, 0xff}, true},
+		{"rgb(1, 2)", color.NRGBA{}, false},
+		{"rgb(1 2 / 3)", color.NRGBA{}, false},
+		{"hsl(0, 100%, 50%)", color.NRGBA{0xff, 0, 0, 0xff}, true},
+		{"hsl(120deg 100% 25%)", color.NRGBA{0, 0x80, 0, 0xff}, true},
+		{"hsla(240, 100%, 50%, 0.25)", color.NRGBA{0, 0, 0xff, 0x40}, true},
+		{"hsl(0.5turn, 100%, 50%)", color.NRGBA{0, 0xff, 0xff, 0xff}, true},
+		{"hsl(0, 0%, 100%)", color.NRGBA{0xff, 0xff, 0xff, 0xff}, true},
+		{"hsl(0, 100, 50)", color.NRGBA{}, false},
+		{"none", color.NRGBA{}, false},
+		{"", color.NRGBA{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parse_color(tt.s, current)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%q: got %v %v, want %v %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	if n := len(namedColors); n != 147 {
+		t.Errorf("got %d named colors, want 147", n)
+	}
+}
+
+func TestColorMapUnmarshal(t *testing.T) {
+	var cm ColorMap
+	err := cm.UnmarshalText([]byte("#fff #000, red rgb(0, 0, 255) hsl(0 0% 50%)=navy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ColorMap{
+		{0xff, 0xff, 0xff, 0xff}: {0, 0, 0, 0xff},
+		{0xff, 0, 0, 0xff}:       {0, 0, 0xff, 0xff},
+		{0x80, 0x80, 0x80, 0xff}: {0, 0, 0x80, 0xff},
+	}
+	if len(cm) != len(want) {
+		t.Fatalf("got %v, want %v", cm, want)
+	}
+	for k, v := range want {
+		if cm[k] != v {
+			t.Errorf("%v: got %v, want %v", k, cm[k], v)
+		}
+	}
+
+	var pc ProjectColor
+	if err := pc.UnmarshalText([]byte("currentColor")); err == nil {
+		t.Error("currentColor accepted as project color")
+	}
+}
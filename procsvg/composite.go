@@ -0,0 +1,423 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Group opacity and masks apply to the group of paths painted
+// as a whole. They are converted to per-path alpha and clipping,
+// which is exact only if the paths don't overlap.
+
+// opacityGroup collects the paths painted within an element
+// whose opacity is applied to each path separately.
+type opacityGroup struct {
+	paths []paintedPath
+}
+
+// paintedPath is a painted path in view box coordinates.
+type paintedPath struct {
+	desc string // element description
+
+	sps  [][]Point // flattened subpaths
+	bbox [2]Point  // bounding box including stroke
+	rule byte
+	fill bool
+	hw   float64 // stroke half width, 0 if not stroked
+}
+
+// report prints a construct of n that cannot be represented exactly.
+func (g *svgprog) report(n Node, msg string) {
+	if g.reportIssues {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", g.fn, node_desc(n), msg)
+	}
+}
+
+// node_desc describes n for messages.
+func node_desc(n Node) string {
+	if id := findattr(n, "id"); id != "" {
+		return fmt.Sprintf("<%s id=%q>", n.Name.Local, id)
+	}
+	return "<" + n.Name.Local + ">"
+}
+
+// begin_group starts collecting painted paths for end_group.
+func (g *svgprog) begin_group() {
+	g.groups = append(g.groups, new(opacityGroup))
+}
+
+// end_group reports if the paths painted since begin_group overlap,
+// because the opacity of n is applied to each of them separately.
+func (g *svgprog) end_group(n Node, what string) {
+	k := len(g.groups) - 1
+	gr := g.groups[k]
+	g.groups = g.groups[:k]
+
+	v := gr.paths
+	for i := range v {
+		if v[i].fill && v[i].hw > 0 {
+			g.report(n, fmt.Sprintf("%s applied to fill and stroke of %s separately", what, v[i].desc))
+			return
+		}
+		for j := 0; j < i; j++ {
+			if paths_overlap(&v[j], &v[i]) {
+				g.report(n, fmt.Sprintf("%s applied to overlapping %s and %s separately",
+					what, v[j].desc, v[i].desc))
+				return
+			}
+		}
+	}
+}
+
+// record_path adds the path cmds of n painted
+// with the current style to the open groups.
+func (g *svgprog) record_path(n Node, cmds []PathCmd) {
+	if len(g.groups) == 0 {
+		return
+	}
+
+	p := paintedPath{
+		desc: node_desc(n),
+		rule: g.fillRule,
+		fill: g.fill_color().A != 0 || g.fillGradient != nil && g.fill_alpha() != 0,
+	}
+	vc := transform_cmds(cmds, g.transform())
+	p.sps = flatten_cmds(vc, g.flatness())
+	p.bbox = cmds_bbox(vc)
+	if g.stroke_visible() {
+		m := g.transform()
+		p.hw = g.stroke.width * math.Sqrt(math.Abs(m.Determinant())) / 2
+		p.bbox[0].X, p.bbox[0].Y = p.bbox[0].X-p.hw, p.bbox[0].Y-p.hw
+		p.bbox[1].X, p.bbox[1].Y = p.bbox[1].X+p.hw, p.bbox[1].Y+p.hw
+	}
+
+	for _, gr := range g.groups {
+		gr.paths = append(gr.paths, p)
+	}
+}
+
+// paths_overlap reports if the painted areas of a and b overlap
+// by sampling points in the intersection of their bounding boxes.
+func paths_overlap(a, b *paintedPath) bool {
+	x0, y0 := math.Max(a.bbox[0].X, b.bbox[0].X), math.Max(a.bbox[0].Y, b.bbox[0].Y)
+	x1, y1 := math.Min(a.bbox[1].X, b.bbox[1].X), math.Min(a.bbox[1].Y, b.bbox[1].Y)
+	if !(x1-x0 > 1e-9 && y1-y0 > 1e-9) {
+		return false
+	}
+
+	const n = 32
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			p := Point{
+				x0 + (x1-x0)*(float64(i)+0.5)/n,
+				y0 + (y1-y0)*(float64(j)+0.5)/n,
+			}
+			if a.covers(p) && b.covers(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// covers reports if p is painted by the fill or stroke of pp.
+func (pp *paintedPath) covers(p Point) bool {
+	if pp.fill {
+		w := 0
+		for _, sp := range pp.sps {
+			for i := range sp {
+				a, b := sp[i], sp[(i+1)%len(sp)]
+				switch {
+				case a.Y <= p.Y && p.Y < b.Y && side(a, b, p) > 0:
+					w++
+				case b.Y <= p.Y && p.Y < a.Y && side(a, b, p) < 0:
+					w--
+				}
+			}
+		}
+		if pp.rule == 1 && w%2 != 0 || pp.rule == 0 && w != 0 {
+			return true
+		}
+	}
+
+	if pp.hw > 0 {
+		for _, sp := range pp.sps {
+			for i := 0; i+1 < len(sp); i++ {
+				if segment_dist(sp[i], sp[i+1], p) < pp.hw {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// segment_dist returns the distance of p from the segment a-b.
+func segment_dist(a, b, p Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = clamp01(((p.X-a.X)*dx + (p.Y-a.Y)*dy) / l)
+	}
+	return math.Hypot(a.X+t*dx-p.X, a.Y+t*dy-p.Y)
+}
+
+// maskStyle is the inherited style of mask content.
+type maskStyle struct {
+	fill        color.NRGBA
+	fillOpacity float64
+	opacity     float64
+	rule        byte
+}
+
+// maskContent is the content of a mask painting
+// all its shapes with the same mask value.
+type maskContent struct {
+	alpha     float64 // uniform mask value, or -1 if nothing is painted
+	luminance bool    // mask value is luminance times alpha
+
+	shapes []clipShape
+}
+
+// push_mask applies the mask property value a of n.
+// Masks painting shapes with a uniform mask value are converted
+// to a clip region and opacity. It returns a function restoring
+// the state after n has been painted, or false if n is invisible.
+func (g *svgprog) push_mask(n Node, a string) (func(), bool, error) {
+	nop := func() {}
+
+	id, ok := paint_url(a)
+	ref := g.ids[id]
+	if !ok || ref == nil || ref.Name.Local != "mask" {
+		g.report(n, fmt.Sprintf("invalid mask reference %q, painted unmasked", a))
+		return nop, true, nil
+	}
+
+	var bbox [2]Point
+	if findattr(*ref, "maskUnits") != "userSpaceOnUse" ||
+		findattr(*ref, "maskContentUnits") == "objectBoundingBox" {
+		var err error
+		if bbox, err = node_bbox(n, MatrixIdentity, g.viewport); err != nil {
+			return nil, false, err
+		}
+		if !(bbox[1].X > bbox[0].X && bbox[1].Y > bbox[0].Y) {
+			return nop, false, nil
+		}
+	}
+
+	m := g.transform()
+	if findattr(*ref, "maskContentUnits") == "objectBoundingBox" {
+		m = m.Translate(bbox[0].X, bbox[0].Y).Scale(bbox[1].X-bbox[0].X, bbox[1].Y-bbox[0].Y)
+	}
+	c := maskContent{
+		alpha:     -1,
+		luminance: get_presentation_attr(*ref, "mask-type") != "alpha",
+	}
+	style := maskStyle{
+		fill:        color.NRGBA{0, 0, 0, 0xff},
+		fillOpacity: 1,
+		opacity:     1,
+	}
+	if reason := c.collect(g, *ref, m, style); reason != "" {
+		g.report(n, fmt.Sprintf("mask %q with %s, painted unmasked", id, reason))
+		return nop, true, nil
+	}
+	if c.alpha <= 0 {
+		return nop, false, nil
+	}
+
+	var pops []func()
+	restore := func() {
+		for i := len(pops) - 1; i >= 0; i-- {
+			pops[i]()
+		}
+	}
+	clip := func(shapes []clipShape) (bool, error) {
+		if g.covers_viewport(shapes) {
+			return true, nil
+		}
+		pop, visible, err := g.apply_clip(id, shapes)
+		if err == nil && visible {
+			pops = append(pops, pop)
+		}
+		return visible, err
+	}
+
+	region, ok, err := g.mask_region(ref, bbox)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		if visible, err := clip([]clipShape{{cmds: region}}); err != nil || !visible {
+			restore()
+			return nil, false, err
+		}
+	}
+	if visible, err := clip(c.shapes); err != nil || !visible {
+		restore()
+		return nil, false, err
+	}
+
+	if c.alpha < 1 {
+		oldOpacity := g.opacity
+		g.opacity *= c.alpha
+		g.begin_group()
+		pops = append(pops, func() {
+			g.end_group(n, fmt.Sprintf("mask %q", id))
+			g.opacity = oldOpacity
+		})
+	}
+	return restore, true, nil
+}
+
+// collect adds the shapes within n painted using style and
+// transformation m to c. It returns a description of the first
+// construct that makes the mask value non-uniform.
+func (c *maskContent) collect(g *svgprog, n Node, m Matrix, style maskStyle) string {
+	for _, e := range n.Node {
+		if is_hidden(e) {
+			continue
+		}
+
+		em, es := m, style
+		if hasattr(e, "transform") {
+			mat, err := SvgTransformMatrix(findattr(e, "transform"))
+			if err != nil {
+				return "invalid transform"
+			}
+			em = em.Mul(mat)
+		}
+		switch a := get_presentation_attr(e, "fill"); a {
+		case "":
+		case "none":
+			es.fill = color.NRGBA{}
+		default:
+			fc, ok := parse_color(a, g.currentColor)
+			if !ok {
+				return fmt.Sprintf("fill %q", a)
+			}
+			es.fill = fc
+		}
+		if a := get_presentation_attr(e, "fill-opacity"); a != "" {
+			v, err := parse_opacity(a)
+			if err != nil {
+				return fmt.Sprintf("fill-opacity %q", a)
+			}
+			es.fillOpacity = v
+		}
+		if a := get_presentation_attr(e, "opacity"); a != "" {
+			v, err := parse_opacity(a)
+			if err != nil {
+				return fmt.Sprintf("opacity %q", a)
+			}
+			es.opacity *= v
+		}
+		if rule, ok := get_svg_fill_rule(e); ok {
+			es.rule = rule
+		}
+		if a := get_presentation_attr(e, "stroke"); a != "" && a != "none" {
+			return "stroked " + node_desc(e)
+		}
+
+		if e.Name.Local == "g" {
+			if reason := c.collect(g, e, em, es); reason != "" {
+				return reason
+			}
+			continue
+		}
+
+		cmds, ok, err := element_cmds(e, g.viewport)
+		if err != nil || !ok {
+			return node_desc(e)
+		}
+
+		v := float64(es.fill.A) / 0xff * es.fillOpacity * es.opacity
+		if c.luminance {
+			v *= (0.2125*float64(es.fill.R) + 0.7154*float64(es.fill.G) + 0.0721*float64(es.fill.B)) / 0xff
+		}
+		if v < 0.5/0xff || len(cmds) == 0 {
+			continue
+		}
+		if c.alpha >= 0 && math.Abs(v-c.alpha) > 1.0/0xff {
+			return "non-uniform mask values"
+		}
+		c.alpha = v
+		c.shapes = append(c.shapes, clipShape{transform_cmds(cmds, em), es.rule})
+	}
+	return ""
+}
+
+// mask_region returns the path of the mask region of mask element ref
+// in view box coordinates, or false if ref uses the default region.
+// The bounding box bbox of the masked element is used
+// unless maskUnits is userSpaceOnUse.
+func (g *svgprog) mask_region(ref *Node, bbox [2]Point) ([]PathCmd, bool, error) {
+	if !hasattr(*ref, "x") && !hasattr(*ref, "y") &&
+		!hasattr(*ref, "width") && !hasattr(*ref, "height") {
+		return nil, false, nil
+	}
+
+	user := findattr(*ref, "maskUnits") == "userSpaceOnUse"
+	var v [4]float64
+	for i, name := range []string{"x", "y", "width", "height"} {
+		s := findattr(*ref, name)
+		if s == "" {
+			s = []string{"-10%", "-10%", "120%", "120%"}[i]
+		}
+		f, pct, err := parse_percentage(s)
+		if err != nil {
+			return nil, false, fmt.Errorf("mask %s: %w", name, err)
+		}
+		switch {
+		case user && pct:
+			f *= []float64{g.viewport.X, g.viewport.Y}[i%2]
+		case !user:
+			f *= []float64{bbox[1].X - bbox[0].X, bbox[1].Y - bbox[0].Y}[i%2]
+			if i < 2 {
+				f += bbox[0].X*float64(1-i) + bbox[0].Y*float64(i)
+			}
+		}
+		v[i] = f
+	}
+
+	x0, y0, x1, y1 := v[0], v[1], v[0]+v[2], v[1]+v[3]
+	cmds := []PathCmd{
+		{'M', []Point{{x0, y0}}},
+		{'L', []Point{{x1, y0}, {x1, y1}, {x0, y1}}},
+	}
+	return transform_cmds(cmds, g.transform()), true, nil
+}
+
+// parse_percentage parses a number or a percentage as a fraction.
+func parse_percentage(s string) (float64, bool, error) {
+	s = strings.TrimSpace(s)
+	if t := strings.TrimSuffix(s, "%"); t != s {
+		v, err := strconv.ParseFloat(t, 64)
+		return v / 100, true, err
+	}
+	v, err := parse_length(s)
+	return v, false, err
+}
+
+// covers_viewport reports if shapes is a convex shape
+// containing the view box.
+func (g *svgprog) covers_viewport(shapes []clipShape) bool {
+	poly, ok := convex_polygon(shapes, g.flatness())
+	if !ok {
+		return false
+	}
+	vb := g.viewbox
+	corners := []Point{vb[0], {vb[1].X, vb[0].Y}, vb[1], {vb[0].X, vb[1].Y}}
+	for i := range poly {
+		for _, p := range corners {
+			if side(poly[i], poly[(i+1)%len(poly)], p) < -1e-9 {
+				return false
+			}
+		}
+	}
+	return true
+}
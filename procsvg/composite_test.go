@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestPathsOverlap(t *testing.T) {
+	path := func(d string, fill bool, hw float64) *paintedPath {
+		cmds, err := PathDCmds(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &paintedPath{
+			sps:  flatten_cmds(cmds, 0.01),
+			bbox: cmds_bbox(cmds),
+			fill: fill,
+			hw:   hw,
+		}
+		p.bbox[0].X, p.bbox[0].Y = p.bbox[0].X-hw, p.bbox[0].Y-hw
+		p.bbox[1].X, p.bbox[1].Y = p.bbox[1].X+hw, p.bbox[1].Y+hw
+		return p
+	}
+
+	tests := []struct {
+		a, b *paintedPath
+		want bool
+	}{
+		// adjacent squares
+		{path("M0 0 H4 V4 H0 Z", true, 0), path("M4 0 H8 V4 H4 Z", true, 0), false},
+		// overlapping squares
+		{path("M0 0 H4 V4 H0 Z", true, 0), path("M3 0 H8 V4 H3 Z", true, 0), true},
+		// L shape around a square within its bounding box
+		{path("M0 0 H8 V2 H2 V8 H0 Z", true, 0), path("M3 3 H8 V8 H3 Z", true, 0), false},
+		// stroke touching a square
+		{path("M0 6 H8", false, 1.5), path("M0 0 H8 V5 H0 Z", true, 0), true},
+		{path("M0 6 H8", false, 0.5), path("M0 0 H8 V5 H0 Z", true, 0), false},
+	}
+	for i, tt := range tests {
+		if got := paths_overlap(tt.a, tt.b); got != tt.want {
+			t.Errorf("%d: got %v, want %v", i, got, tt.want)
+		}
+	}
+}
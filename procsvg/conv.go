@@ -5,17 +5,45 @@ import (
 	"fmt"
 	"image/color"
 	"io"
+	"math"
 	"os"
-	"strconv"
 	"strings"
 )
 
 type svgOpts struct {
-	eps float64 // conversion precision
+	eps       float64 // conversion precision
+	pixelPrec float64 // conversion precision in pixels, if nonzero
+
+	// scaleViewBox maps the view box to the image size.
+	scaleViewBox bool
+
+	// fitCurves is the tolerance in pixels for fitting
+	// curves to lines, or zero to keep lines.
+	fitCurves float64
 
 	palette     []color.NRGBA
 	colorMagnet float64
 
+	// currentColor is the palette index used for currentColor,
+	// or -1 to resolve currentColor to the color property.
+	currentColor int
+
+	// clipIntersect intersects paths with convex clip paths
+	// instead of emitting clip ops.
+	clipIntersect bool
+
+	// keepArcs emits elliptical arcs as arc ops
+	// instead of cubic Bézier curves.
+	keepArcs bool
+
+	// inferViewBox and inferSize select how a missing
+	// view box and image size are inferred.
+	inferViewBox string
+	inferSize    string
+
+	// reportIssues reports constructs that cannot be represented exactly.
+	reportIssues bool
+
 	colorCount map[color.NRGBA]int
 }
 
@@ -25,21 +53,56 @@ func ProcSvg(fn string, opts svgOpts) (*ProgImage, error) {
 		return nil, err
 	}
 
+	// The current color entry is used only for currentColor.
 	cm := make(map[color.NRGBA]int)
+	var pal []color.NRGBA
 	for i, c := range opts.palette {
-		cm[c] = i
+		if i != opts.currentColor {
+			cm[c] = i
+			pal = append(pal, c)
+		}
 	}
 
 	g := svgprog{
 		fn:         fn,
-		palette:    opts.palette,
+		palette:    pal,
 		cmsquare:   opts.colorMagnet * opts.colorMagnet,
 		colormap:   cm,
 		colorCount: opts.colorCount,
+		stroke:     defaultStroke,
+		progStroke: defaultStroke,
+
+		solidFillColor: color.NRGBA{0, 0, 0, 0xff},
+		fillOpacity:    1,
+		opacity:        1,
+
+		currentColor: color.NRGBA{0, 0, 0, 0xff},
+		currentIndex: opts.currentColor,
+
+		clipIntersect: opts.clipIntersect,
+		keepArcs:      opts.keepArcs,
+		pixelPrec:     opts.pixelPrec,
+		scaleViewBox:  opts.scaleViewBox,
+		fitCurves:     opts.fitCurves,
+		inferViewBox:  opts.inferViewBox,
+		inferSize:     opts.inferSize,
+		reportIssues:  opts.reportIssues,
 	}
 	g.mem.Precision = opts.eps
 
+	apply_styles(&svg)
+
+	g.ids = make(map[string]*Node)
+	collect_ids(&svg, g.ids)
+
 	err = g.tree(svg)
+	if g.im == nil {
+		// The outermost svg element was not converted.
+		if err == nil {
+			err = fmt.Errorf("missing svg element")
+		}
+		return nil, err
+	}
 
 	return g.finish(), err
 }
@@ -63,6 +126,9 @@ type Node struct {
 	Name xml.Name
 	Attr []xml.Attr
 	Node []Node // child nodes
+
+	Text  string            // character data of style elements
+	Style map[string]string // cascaded style declarations
 }
 
 func xmlTree(r io.Reader) (Node, error) {
@@ -95,6 +161,11 @@ func xmlTree(r io.Reader) (Node, error) {
 			}
 			stack = append(stack, p)
 
+		case xml.CharData:
+			if n := len(stack); n != 0 && stack[n-1].Name.Local == "style" {
+				stack[n-1].Text += string(x)
+			}
+
 		case xml.EndElement:
 			n := len(stack)
 			stack = stack[:n-1]
@@ -125,7 +196,68 @@ type svgprog struct {
 
 	xform []Matrix
 
+	// elements by id
+	ids map[string]*Node
+
+	// elements referenced by use elements being painted
+	using map[*Node]bool
+
+	// view box and its size
+	viewbox  [2]Point
+	viewport Point
+
+	// currentColor is the value of the color property.
+	currentColor color.NRGBA
+
+	// currentIndex is the palette index used for currentColor,
+	// or -1 to resolve currentColor to the color property.
+	// It is not used once colorSet is set by the color property
+	// of the current node or an ancestor.
+	currentIndex int
+	colorSet     bool
+
 	solidFillColor color.NRGBA
+	fillCurrent    bool  // fill uses the current color palette entry
+	fillGradient   *Node // gradient fill, or nil for solid fill
+	fillOpacity    float64
+
+	// opacity is the product of element opacities
+	// of the current node and its ancestors.
+	opacity float64
+
+	// fillRule is the current SVG fill rule,
+	// progFillRule is the fill rule set in the program.
+	fillRule     byte
+	progFillRule byte
+
+	// clipPolys are the convex clip polygons in view box coordinates
+	// when clipIntersect is set.
+	clipIntersect bool
+	clipPolys     [][]Point
+
+	// groups collect painted paths for checking group opacity
+	groups []*opacityGroup
+
+	keepArcs bool
+
+	pixelPrec    float64
+	scaleViewBox bool
+
+	// pixelScale is the size of a program coordinate unit in pixels.
+	pixelScale float64
+
+	// fitCurves is the curve fitting tolerance in pixels.
+	fitCurves float64
+
+	inferViewBox string
+	inferSize    string
+
+	reportIssues bool
+
+	// stroke is the current SVG stroke style,
+	// progStroke is the stroke style set in the program.
+	stroke     strokeStyle
+	progStroke strokeStyle
 
 	// non-palette colors
 	colors []color.NRGBA
@@ -134,6 +266,7 @@ type svgprog struct {
 func (g *svgprog) finish() *ProgImage {
 	g.mem.Stop()
 	g.im.Data = g.mem.Bytes()
+	g.im.Stats = g.mem.Stats
 	return g.im
 }
 
@@ -142,8 +275,8 @@ func (g *svgprog) tree(n Node) error {
 	if is_hidden(n) {
 		return nil
 	}
-	if hasattr(n, "clip-path") {
-		fmt.Fprintf(os.Stderr, "clip-path found in %s\n", g.fn)
+	if is_definition(n) {
+		return nil
 	}
 	if hasattr(n, "transform") {
 		mat, err := SvgTransformMatrix(findattr(n, "transform"))
@@ -153,22 +286,117 @@ func (g *svgprog) tree(n Node) error {
 		g.pushTransform(g.transform().Mul(mat))
 		defer g.popTransform()
 	}
-	if fill, ok := get_svg_solid_fill(n); ok {
-		oldFill := g.solidFillColor
-		g.solidFillColor = fill
+	if a := get_presentation_attr(n, "color"); !is_current_color(a) {
+		if c, ok := parse_color(a, g.currentColor); ok {
+			oldColor, oldSet := g.currentColor, g.colorSet
+			g.currentColor, g.colorSet = c, true
+			defer func() {
+				g.currentColor, g.colorSet = oldColor, oldSet
+			}()
+		}
+	}
+	if fill, grad, ok := g.get_fill(n); ok {
+		oldFill, oldCurrent, oldGrad := g.solidFillColor, g.fillCurrent, g.fillGradient
+		g.solidFillColor, g.fillGradient = fill, grad
+		g.fillCurrent = g.use_current_index(get_presentation_attr(n, "fill"))
 		defer func() {
-			g.solidFillColor = oldFill
+			g.solidFillColor, g.fillCurrent, g.fillGradient = oldFill, oldCurrent, oldGrad
 		}()
 	}
+	if a := get_presentation_attr(n, "fill-opacity"); a != "" {
+		v, err := parse_opacity(a)
+		if err != nil {
+			return fmt.Errorf("fill-opacity: %w", err)
+		}
+		oldOpacity := g.fillOpacity
+		g.fillOpacity = v
+		defer func() {
+			g.fillOpacity = oldOpacity
+		}()
+	}
+	if a := get_presentation_attr(n, "opacity"); a != "" {
+		v, err := parse_opacity(a)
+		if err != nil {
+			return fmt.Errorf("opacity: %w", err)
+		}
+		oldOpacity := g.opacity
+		g.opacity *= v
+		defer func() {
+			g.opacity = oldOpacity
+		}()
+		if v < 1 {
+			g.begin_group()
+			defer g.end_group(n, fmt.Sprintf("opacity %g", v))
+		}
+	}
+	if rule, ok := get_svg_fill_rule(n); ok {
+		oldRule := g.fillRule
+		g.fillRule = rule
+		defer func() {
+			g.fillRule = oldRule
+		}()
+	}
+	oldStroke := g.stroke
+	defer func() {
+		g.stroke = oldStroke
+	}()
+	if err := g.update_stroke(n); err != nil {
+		return err
+	}
+
+	nested := n.Name.Local == "svg" && g.im != nil
+	if n.Name.Local == "svg" && !nested {
+		// The view box precedes clip ops.
+		if err := g.svg(n); err != nil {
+			return err
+		}
+		defer g.popTransform()
+	}
+	if a := get_presentation_attr(n, "clip-path"); a != "" && a != "none" {
+		pop, visible, err := g.push_clip(n, a)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return nil
+		}
+		defer pop()
+	}
+	if a := get_presentation_attr(n, "mask"); a != "" && a != "none" {
+		pop, visible, err := g.push_mask(n, a)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return nil
+		}
+		defer pop()
+	}
+	if a := get_presentation_attr(n, "filter"); a != "" && a != "none" {
+		g.report(n, "filter ignored")
+	}
+	if nested {
+		pop, visible, err := g.inner_svg(n)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return nil
+		}
+		defer pop()
+	}
 
 	// Handle nodes of interest.
 	var err error
 	switch n.Name.Local {
-	case "svg":
-		err = g.svg(n)
-
 	case "path":
 		err = g.path(n)
+
+	case "rect", "circle", "ellipse", "line", "polyline", "polygon":
+		err = g.shape(n)
+
+	case "use":
+		err = g.use(n)
 	}
 	if err != nil {
 		return err
@@ -184,40 +412,276 @@ func (g *svgprog) tree(n Node) error {
 	return nil
 }
 
+// svg sets up the image size and the program view box
+// from the outermost svg element n.
+// The program view box is the viewport in view box coordinates,
+// so that the view box is aligned according to preserveAspectRatio
+// when its aspect ratio differs from that of the image.
 func (g *svgprog) svg(n Node) error {
-	g.im = new(ProgImage)
+	vb, err := g.root_viewbox(n)
+	if err != nil {
+		return err
+	}
 
-	var err error
+	w, h, err := g.root_size(n, vb)
+	if err != nil {
+		return err
+	}
+
+	g.im = &ProgImage{
+		Width:  int(math.Round(w)),
+		Height: int(math.Round(h)),
+	}
+	if g.im.Width <= 0 || g.im.Height <= 0 {
+		return fmt.Errorf("invalid image size %g×%g", w, h)
+	}
 
-	ws := findattr(n, "width")
-	g.im.Width, err = strconv.Atoi(strings.TrimSuffix(ws, "px"))
+	// Align to the rounded size to avoid stretching.
+	w, h = float64(g.im.Width), float64(g.im.Height)
+	vm, err := viewbox_transform(vb, w, h, findattr(n, "preserveAspectRatio"))
 	if err != nil {
-		return fmt.Errorf("error parsing width %q", ws)
+		return err
+	}
+
+	// Program coordinates are pixels if the view box is scaled.
+	m := g.transform()
+	if g.scaleViewBox {
+		m = vm.Mul(m)
+		vm = MatrixIdentity
+	}
+	g.pushTransform(m)
+
+	g.viewbox = [2]Point{{vb[0], vb[1]}, {vb[0] + vb[2], vb[1] + vb[3]}}
+	if inv, ok := vm.Invert(); ok {
+		g.viewbox = [2]Point{inv.Transform(Point{0, 0}), inv.Transform(Point{w, h})}
 	}
+	g.viewport = Point{vb[2], vb[3]}
 
-	hs := findattr(n, "height")
-	g.im.Height, err = strconv.Atoi(strings.TrimSuffix(hs, "px"))
+	// Use the larger pixel dimension in view box coordinates.
+	g.pixelScale = math.Max(math.Hypot(vm[0], vm[1]), math.Hypot(vm[2], vm[3]))
+	if g.pixelPrec != 0 {
+		g.mem.Precision = math.Max(g.mem.Precision, g.pixelPrec/g.pixelScale)
+		g.verbose("precision %g", g.mem.Precision)
+	}
+
+	v := g.viewbox
+	g.mem.ViewBox(v[0].X, v[0].Y, v[1].X, v[1].Y)
+	return nil
+}
+
+// root_viewbox returns the view box of the outermost svg element n,
+// inferring it if n has no viewBox attribute.
+func (g *svgprog) root_viewbox(n Node) ([4]float64, error) {
+	if hasattr(n, "viewBox") {
+		return parse_viewbox(findattr(n, "viewBox"))
+	}
+
+	mode := g.inferViewBox
+	if mode == InferViewBoxSize {
+		w, wpct, werr := parse_percentage(findattr(n, "width"))
+		h, hpct, herr := parse_percentage(findattr(n, "height"))
+		if werr == nil && herr == nil && !wpct && !hpct {
+			vb := [4]float64{0, 0, w, h}
+			g.verbose("view box %g inferred from size", vb)
+			return vb, nil
+		}
+		mode = InferViewBoxBounds
+	}
+	if mode != InferViewBoxBounds {
+		return [4]float64{}, fmt.Errorf("missing viewBox")
+	}
+
+	b, err := node_bbox(n, MatrixIdentity, g.viewport)
 	if err != nil {
-		return fmt.Errorf("error parsing width %q", hs)
+		return [4]float64{}, err
+	}
+	if !(b[0].X <= b[1].X && b[0].Y <= b[1].Y) {
+		return [4]float64{}, fmt.Errorf("missing viewBox of image without geometry")
 	}
+	vb := [4]float64{b[0].X, b[0].Y, b[1].X - b[0].X, b[1].Y - b[0].Y}
+	g.verbose("view box %g inferred from geometry bounds", vb)
+	return vb, nil
+}
+
+// root_size returns the image size of the outermost svg element n
+// with view box vb, inferring it if n has no width or height attribute.
+func (g *svgprog) root_size(n Node, vb [4]float64) (w, h float64, err error) {
+	hasw, hash := hasattr(n, "width"), hasattr(n, "height")
+	if hasw {
+		if w, err = svg_length(n, "width", "", vb[2]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if hash {
+		if h, err = svg_length(n, "height", "", vb[3]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if hasw && hash {
+		return w, h, nil
+	}
+
+	if g.inferSize != InferSizeViewBox {
+		return 0, 0, fmt.Errorf("missing image width or height")
+	}
+	switch {
+	case hasw && vb[2] != 0:
+		h = w * vb[3] / vb[2]
+	case hash && vb[3] != 0:
+		w = h * vb[2] / vb[3]
+	default:
+		w, h = vb[2], vb[3]
+	}
+	g.verbose("image size %g×%g inferred from view box", w, h)
+	return w, h, nil
+}
+
+// verbose prints a message about the conversion in verbose mode.
+func (g *svgprog) verbose(format string, args ...interface{}) {
+	if cli.verbose && g.reportIssues {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", g.fn, fmt.Sprintf(format, args...))
+	}
+}
+
+// inner_svg establishes the viewport of the nested svg element n.
+// It returns a function restoring the outer viewport,
+// or false if the viewport is empty.
+func (g *svgprog) inner_svg(n Node) (func(), bool, error) {
+	var v [4]float64
+	for i, a := range []struct {
+		name, def string
+		ref       float64
+	}{
+		{"x", "0", g.viewport.X},
+		{"y", "0", g.viewport.Y},
+		{"width", "100%", g.viewport.X},
+		{"height", "100%", g.viewport.Y},
+	} {
+		var err error
+		if v[i], err = svg_length(n, a.name, a.def, a.ref); err != nil {
+			return nil, false, err
+		}
+	}
+	x, y, w, h := v[0], v[1], v[2], v[3]
+	if !(w > 0 && h > 0) {
+		return nil, false, nil
+	}
+
+	m := g.transform()
 
-	vb := findattr(n, "viewBox")
-	var minx, miny, width, height float64
-	_, err = fmt.Sscan(vb, &minx, &miny, &width, &height)
+	popClip := func() {}
+	if o := get_presentation_attr(n, "overflow"); o != "visible" && o != "auto" {
+		rect := []PathCmd{
+			{'M', []Point{{x, y}}},
+			{'L', []Point{{x + w, y}, {x + w, y + h}, {x, y + h}}},
+		}
+		shapes := []clipShape{{transform_cmds(rect, m), 0}}
+		if !g.covers_viewport(shapes) {
+			pop, visible, err := g.apply_clip("svg", shapes)
+			if err != nil || !visible {
+				return nil, false, err
+			}
+			popClip = pop
+		}
+	}
+
+	m = m.Translate(x, y)
+	viewport := Point{w, h}
+	if hasattr(n, "viewBox") {
+		vb, err := parse_viewbox(findattr(n, "viewBox"))
+		if err != nil {
+			return nil, false, err
+		}
+		vm, err := viewbox_transform(vb, w, h, findattr(n, "preserveAspectRatio"))
+		if err != nil {
+			return nil, false, err
+		}
+		m = m.Mul(vm)
+		viewport = Point{vb[2], vb[3]}
+	}
+
+	oldViewport := g.viewport
+	g.viewport = viewport
+	g.pushTransform(m)
+	return func() {
+		g.popTransform()
+		g.viewport = oldViewport
+		popClip()
+	}, true, nil
+}
+
+// svg_length parses the length attribute name of svg element n.
+// Percentages are relative to ref, and def is used if n has no such attribute.
+func svg_length(n Node, name, def string, ref float64) (float64, error) {
+	s := findattr(n, name)
+	if !hasattr(n, name) {
+		s = def
+	}
+	v, pct, err := parse_percentage(s)
 	if err != nil {
-		return fmt.Errorf("error parsing viewBox %q", vb)
+		return 0, fmt.Errorf("error parsing %s %q", name, s)
 	}
+	if pct {
+		v *= ref
+	}
+	return v, nil
+}
 
-	g.mem.ViewBox(minx, miny, minx+width, miny+height)
-	return nil
+// use paints the element referenced by the use element n.
+func (g *svgprog) use(n Node) error {
+	id := strings.TrimPrefix(get_href(n), "#")
+	ref := g.ids[id]
+	if ref == nil {
+		fmt.Fprintf(os.Stderr, "invalid use reference %q in %s\n", id, g.fn)
+		return nil
+	}
+	if g.using[ref] {
+		return fmt.Errorf("use: circular reference to %q", id)
+	}
+	if g.using == nil {
+		g.using = make(map[*Node]bool)
+	}
+	g.using[ref] = true
+	defer delete(g.using, ref)
+
+	x, y, w, h, err := shapeattrs(n, g.viewport, "x", "y", "width", "height")
+	if err != nil {
+		return err
+	}
+	m := g.transform().Translate(x, y)
+
+	inst := *ref
+	if ref.Name.Local == "symbol" {
+		if !hasattr(n, "width") {
+			w = g.viewport.X
+		}
+		if !hasattr(n, "height") {
+			h = g.viewport.Y
+		}
+		if hasattr(*ref, "viewBox") {
+			vb, err := parse_viewbox(findattr(*ref, "viewBox"))
+			if err != nil {
+				return err
+			}
+			vm, err := viewbox_transform(vb, w, h, findattr(*ref, "preserveAspectRatio"))
+			if err != nil {
+				return err
+			}
+			m = m.Mul(vm)
+		}
+
+		// Paint symbol content as a group.
+		inst.Name.Local = "g"
+	}
+
+	g.pushTransform(m)
+	defer g.popTransform()
+
+	return g.tree(inst)
 }
 
 func (g *svgprog) path(n Node) error {
-	c := g.solidFillColor
-	if c.A == 0 {
-		if cli.verbose {
-			fmt.Println("skipping invisible path")
-		}
+	if !g.visible() {
 		return nil
 	}
 
@@ -226,6 +690,39 @@ func (g *svgprog) path(n Node) error {
 		return err
 	}
 
+	return g.fill_path(n, cmds)
+}
+
+func (g *svgprog) shape(n Node) error {
+	if !g.visible() {
+		return nil
+	}
+
+	cmds, err := ShapeCmds(n, g.viewport)
+	if err != nil {
+		return err
+	}
+
+	return g.fill_path(n, cmds)
+}
+
+func (g *svgprog) visible() bool {
+	fill := g.fill_color().A != 0 || g.fillGradient != nil && g.fill_alpha() != 0
+	if !fill && !g.stroke_visible() {
+		if cli.verbose {
+			fmt.Println("skipping invisible path")
+		}
+		return false
+	}
+	return true
+}
+
+func (g *svgprog) fill_path(n Node, cmds []PathCmd) error {
+	if !g.stroke_visible() {
+		// Fills close subpaths implicitly.
+		cmds = strip_close(cmds)
+	}
+
 	if len(cmds) == 0 {
 		return nil
 	}
@@ -234,18 +731,72 @@ func (g *svgprog) path(n Node) error {
 		return nil
 	}
 
-	g.handle_fill()
+	if g.fitCurves != 0 {
+		s := g.pixelScale * scale_bound(g.transform())
+		if s != 0 {
+			cmds = fit_curves(cmds, g.fitCurves/s)
+		}
+	}
+
+	// Conversions using the path geometry need arcs as curves.
+	geom := cubic_arcs(cmds)
+	if !g.keepArcs {
+		cmds = geom
+	}
+
+	path, xform := cmds, g.transform()
+	npop := 0
+	if len(g.clipPolys) != 0 {
+		p, m, ok := g.clip_path(geom)
+		switch {
+		case !ok:
+			k, err := g.clip_poly_ops()
+			if err != nil {
+				return err
+			}
+			npop = k
+		case len(p) == 0:
+			return nil
+		default:
+			path, xform = p, m
+		}
+	}
+	g.record_path(n, geom)
+
+	if err := g.handle_fill(geom); err != nil {
+		return err
+	}
+	g.handle_stroke()
 
-	g.mem.BeginPath(g.transform())
-	for _, c := range cmds {
+	g.mem.BeginPath(xform)
+	for _, c := range g.simplify(path, xform) {
 		if err := g.mem.PathCmd(c); err != nil {
 			return err
 		}
 	}
 
+	for ; npop > 0; npop-- {
+		g.mem.Byte(0x21)
+	}
 	return nil
 }
 
+// simplify returns cmds simplified within the coordinate
+// precision of the program after transformation by m.
+func (g *svgprog) simplify(cmds []PathCmd, m Matrix) []PathCmd {
+	s := scale_bound(m)
+	if s == 0 {
+		return cmds
+	}
+	return simplify_path(cmds, g.mem.Precision/s)
+}
+
+// scale_bound returns the Frobenius norm of m,
+// which bounds the scale of m in any direction.
+func scale_bound(m Matrix) float64 {
+	return math.Sqrt(m[0]*m[0] + m[1]*m[1] + m[2]*m[2] + m[3]*m[3])
+}
+
 func (g *svgprog) transform() Matrix {
 	n := len(g.xform)
 	if n == 0 {
@@ -263,15 +814,106 @@ func (g *svgprog) popTransform() {
 	g.xform = g.xform[:n-1]
 }
 
-func (g *svgprog) handle_fill() {
-	c := g.solidFillColor
+func (g *svgprog) handle_fill(cmds []PathCmd) error {
+	switch {
+	case g.fillGradient != nil:
+		gr, err := g.resolve_gradient(g.fillGradient)
+		if err != nil {
+			return err
+		}
+		for i := range gr.stops {
+			gr.stops[i].color = with_alpha(gr.stops[i].color, g.fill_alpha())
+		}
+		if err := g.gradient_fill(gr, cmds); err != nil {
+			return err
+		}
+
+	case g.fill_color().A == 0:
+		g.mem.Byte(0x03)
+		return nil
 
+	default:
+		g.paint_op(g.fill_color(), g.fillCurrent, 0x01, 0x02, 0x07)
+	}
+
+	if g.fillRule != g.progFillRule {
+		g.mem.Byte(0x04)
+		g.mem.Byte(g.fillRule)
+		g.progFillRule = g.fillRule
+	}
+	return nil
+}
+
+// fill_alpha returns the factor applied to fill color alpha values.
+func (g *svgprog) fill_alpha() float64 {
+	return g.fillOpacity * g.opacity
+}
+
+// fill_color returns the solid fill color with effective alpha.
+func (g *svgprog) fill_color() color.NRGBA {
+	return with_alpha(g.solidFillColor, g.fill_alpha())
+}
+
+// with_alpha returns c with its alpha multiplied by f.
+func with_alpha(c color.NRGBA, f float64) color.NRGBA {
+	c.A = uint8(float64(c.A)*f + 0.5)
+	return c
+}
+
+// color_op emits op with color c or paletteOp with the
+// palette index of c if c is in the palette.
+func (g *svgprog) color_op(c color.NRGBA, op, paletteOp byte) {
+	c = g.map_color(c)
+
+	if i, ok := g.colormap[c]; ok {
+		g.mem.Byte(paletteOp)
+		g.mem.Byte(byte(i))
+	} else {
+		g.colors = append(g.colors, c)
+
+		g.mem.Byte(op)
+		g.mem.Color(c)
+	}
+}
+
+// paint_op emits the op for color c like color_op,
+// or alphaOp with the current color palette index
+// and the alpha of c if current is set.
+func (g *svgprog) paint_op(c color.NRGBA, current bool, op, paletteOp, alphaOp byte) {
+	if !current {
+		g.color_op(c, op, paletteOp)
+		return
+	}
+
+	if c.A == 0xff {
+		g.mem.Byte(paletteOp)
+		g.mem.Byte(byte(g.currentIndex))
+	} else {
+		g.mem.Byte(alphaOp)
+		g.mem.Byte(byte(g.currentIndex))
+		g.mem.Byte(c.A)
+	}
+}
+
+// use_current_index reports if the paint value s should use
+// the current color palette entry.
+func (g *svgprog) use_current_index(s string) bool {
+	return g.currentIndex >= 0 && !g.colorSet && is_current_color(s)
+}
+
+func is_current_color(s string) bool {
+	return strings.EqualFold(strings.TrimSpace(s), "currentColor")
+}
+
+// map_color applies the color magnet to c and records its use.
+func (g *svgprog) map_color(c color.NRGBA) color.NRGBA {
 	if g.cmsquare > 0 {
 		for _, x := range g.palette {
 			dr := int(c.R) - int(x.R)
 			dg := int(c.G) - int(x.G)
 			db := int(c.B) - int(x.B)
-			dsquare := float64(dr*dr + dg*dg + db*db)
+			da := int(c.A) - int(x.A)
+			dsquare := float64(dr*dr + dg*dg + db*db + da*da)
 			if dsquare < g.cmsquare {
 				c = x
 				break
@@ -281,20 +923,26 @@ func (g *svgprog) handle_fill() {
 
 	if g.colorCount != nil {
 		if cli.showColor {
-			fmt.Printf("  #%02x%02x%02x\n", c.R, c.G, c.B)
+			if c.A == 0xff {
+				fmt.Printf("  #%02x%02x%02x\n", c.R, c.G, c.B)
+			} else {
+				fmt.Printf("  #%02x%02x%02x%02x\n", c.R, c.G, c.B, c.A)
+			}
 		}
 		g.colorCount[c]++
 	}
 
-	if i, ok := g.colormap[c]; ok {
-		g.mem.Byte(0x02)
-		g.mem.Byte(byte(i))
-	} else {
-		g.colors = append(g.colors, c)
+	return c
+}
 
-		g.mem.Byte(0x01)
-		g.mem.Color(c)
+// get_href returns the href or xlink:href attribute of n.
+func get_href(n Node) string {
+	for _, a := range n.Attr {
+		if a.Name.Local == "href" {
+			return a.Value
+		}
 	}
+	return ""
 }
 
 func hasattr(n Node, name string) bool {
@@ -321,68 +969,83 @@ func findattr(n Node, name string) string {
 	return r
 }
 
+// get_presentation_attr returns the style property attr of n,
+// or the presentation attribute if the property is not set.
+// It returns an empty string for inherit.
 func get_presentation_attr(n Node, attr string) string {
-	style := cssdecode(findattr(n, "style"))
-	if v, ok := style[attr]; ok {
-		return v
+	v, ok := n.Style[attr]
+	if !ok {
+		v = findattr(n, attr)
+	}
+	if v == "inherit" {
+		return ""
+	}
+	return v
+}
+
+// get_fill returns the fill of n if it is specified.
+// The gradient is nil for solid fills.
+func (g *svgprog) get_fill(n Node) (color.NRGBA, *Node, bool) {
+	if id, ok := paint_url(get_presentation_attr(n, "fill")); ok {
+		if ref := g.ids[id]; ref != nil && is_gradient(ref) {
+			return color.NRGBA{}, ref, true
+		}
+		fmt.Fprintf(os.Stderr, "invalid fill reference %q in %s\n", id, g.fn)
+		return color.NRGBA{}, nil, true
 	}
 
-	return findattr(n, attr)
+	c, ok := get_svg_solid_fill(n, g.currentColor)
+	return c, nil, ok
 }
 
-func get_svg_solid_fill(n Node) (color.NRGBA, bool) {
+func get_svg_solid_fill(n Node, current color.NRGBA) (color.NRGBA, bool) {
 	a := get_presentation_attr(n, "fill")
 	if a == "none" {
 		return color.NRGBA{0, 0, 0, 0}, true
 	}
 
-	return colorfromhex(a)
+	return parse_color(a, current)
 }
 
-func is_hidden(n Node) bool {
-	a := get_presentation_attr(n, "display")
-	return a == "none"
-}
-
-func colorfromhex(s string) (color.NRGBA, bool) {
-	if s == "" || s[0] != '#' {
-		return color.NRGBA{}, false
+// get_svg_fill_rule returns the fill rule of n,
+// 0 for nonzero and 1 for evenodd.
+func get_svg_fill_rule(n Node) (byte, bool) {
+	switch get_presentation_attr(n, "fill-rule") {
+	case "nonzero":
+		return 0, true
+	case "evenodd":
+		return 1, true
 	}
+	return 0, false
+}
 
-	v, err := strconv.ParseUint(s[1:], 16, 64)
-	if err != nil {
-		return color.NRGBA{}, false
+// collect_ids records n and its descendants with an id attribute in ids.
+func collect_ids(n *Node, ids map[string]*Node) {
+	if id := findattr(*n, "id"); id != "" {
+		ids[id] = n
 	}
-
-	switch len(s) - 1 {
-	case 3:
-		r := (byte(v>>8) & 0xf) * 0x11
-		g := (byte(v>>4) & 0xf) * 0x11
-		b := (byte(v) & 0xf) * 0x11
-		return color.NRGBA{r, g, b, 0xff}, true
-
-	case 6:
-		r := byte(v >> 16)
-		g := byte(v >> 8)
-		b := byte(v)
-		return color.NRGBA{r, g, b, 0xff}, true
+	for i := range n.Node {
+		collect_ids(&n.Node[i], ids)
 	}
+}
 
-	return color.NRGBA{}, false
+// parse_opacity parses an opacity value clamped to [0, 1].
+func parse_opacity(s string) (float64, error) {
+	v, err := parse_fraction(s)
+	return clamp01(v), err
 }
 
-func cssdecode(css string) map[string]string {
-	if css == "" {
-		return nil
-	}
+func is_hidden(n Node) bool {
+	a := get_presentation_attr(n, "display")
+	return a == "none"
+}
 
-	v := strings.Split(css, ";")
-	m := make(map[string]string)
-	for _, e := range v {
-		colon := strings.Index(e, ":")
-		if colon > 0 {
-			m[strings.TrimSpace(e[:colon])] = strings.TrimSpace(e[colon+1:])
-		}
+// is_definition reports if n is painted only when referenced.
+func is_definition(n Node) bool {
+	switch n.Name.Local {
+	case "defs", "symbol", "clipPath", "mask", "pattern", "marker",
+		"linearGradient", "radialGradient":
+		return true
 	}
-	return m
+	return false
 }
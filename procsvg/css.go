@@ -0,0 +1,363 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// cssRule is a style rule of a stylesheet with a single selector.
+type cssRule struct {
+	sel   cssSelector
+	decl  []cssDecl
+	order int // source order
+}
+
+type cssDecl struct {
+	name, value string
+	important   bool
+}
+
+// cssSelector is a sequence of compound selectors separated
+// by descendant or child combinators.
+type cssSelector []cssCompound
+
+// cssCompound is a compound selector such as rect.a#b.
+type cssCompound struct {
+	typ     string // element name, or empty for any element
+	id      string
+	classes []string
+	child   bool // combinator before this compound is '>'
+}
+
+// apply_styles resolves the stylesheets of <style> elements
+// and the style attributes within root, and records the
+// cascaded declarations of each element in Node.Style.
+func apply_styles(root *Node) {
+	var sheet []cssRule
+	collect_styles(root, &sheet)
+
+	var path []*Node
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		path = append(path, n)
+		n.Style = cascade(sheet, path)
+		for i := range n.Node {
+			walk(&n.Node[i])
+		}
+		path = path[:len(path)-1]
+	}
+	walk(root)
+}
+
+func collect_styles(n *Node, sheet *[]cssRule) {
+	if n.Name.Local == "style" {
+		*sheet = append(*sheet, parse_stylesheet(n.Text, len(*sheet))...)
+	}
+	for i := range n.Node {
+		collect_styles(&n.Node[i], sheet)
+	}
+}
+
+// cascade returns the declarations for the last element of path.
+// Stylesheet rules are ordered by specificity and source order,
+// and are overridden by the style attribute. Important
+// declarations override normal ones.
+func cascade(sheet []cssRule, path []*Node) map[string]string {
+	type match struct {
+		spec, order int
+		decl        []cssDecl
+	}
+	var mv []match
+	for _, r := range sheet {
+		if r.sel.match(path) {
+			mv = append(mv, match{r.sel.specificity(), r.order, r.decl})
+		}
+	}
+	sort.SliceStable(mv, func(i, j int) bool {
+		if mv[i].spec != mv[j].spec {
+			return mv[i].spec < mv[j].spec
+		}
+		return mv[i].order < mv[j].order
+	})
+
+	n := path[len(path)-1]
+	inline := parse_declarations(findattr(*n, "style"))
+	if len(mv) == 0 && len(inline) == 0 {
+		return nil
+	}
+
+	m := make(map[string]string)
+	for _, important := range []bool{false, true} {
+		for _, x := range mv {
+			for _, d := range x.decl {
+				if d.important == important {
+					m[d.name] = d.value
+				}
+			}
+		}
+		for _, d := range inline {
+			if d.important == important {
+				m[d.name] = d.value
+			}
+		}
+	}
+	return m
+}
+
+// parse_stylesheet parses the style rules in css.
+// At-rules and rules with unsupported selectors are ignored.
+func parse_stylesheet(css string, order int) []cssRule {
+	css = strip_css_comments(css)
+
+	var rules []cssRule
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			return rules
+		}
+
+		if css[0] == '@' {
+			css = skip_at_rule(css)
+			continue
+		}
+
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return rules
+		}
+		end := strings.IndexByte(css[open:], '}')
+		if end < 0 {
+			end = len(css) - open
+		}
+		prelude, block := css[:open], css[open+1:open+end]
+		if open+end < len(css) {
+			css = css[open+end+1:]
+		} else {
+			css = ""
+		}
+
+		decl := parse_declarations(block)
+		for _, s := range strings.Split(prelude, ",") {
+			sel, ok := parse_selector(s)
+			if !ok {
+				continue
+			}
+			rules = append(rules, cssRule{sel, decl, order})
+			order++
+		}
+	}
+}
+
+// skip_at_rule returns css after the at-rule at its start.
+func skip_at_rule(css string) string {
+	depth := 0
+	for i := 0; i < len(css); i++ {
+		switch css[i] {
+		case ';':
+			if depth == 0 {
+				return css[i+1:]
+			}
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth <= 0 {
+				return css[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+func strip_css_comments(css string) string {
+	var sb strings.Builder
+	for {
+		i := strings.Index(css, "/*")
+		if i < 0 {
+			sb.WriteString(css)
+			return sb.String()
+		}
+		sb.WriteString(css[:i])
+		j := strings.Index(css[i+2:], "*/")
+		if j < 0 {
+			return sb.String()
+		}
+		sb.WriteByte(' ')
+		css = css[i+2+j+2:]
+	}
+}
+
+// parse_declarations parses a declaration block
+// or the value of a style attribute.
+func parse_declarations(css string) []cssDecl {
+	var v []cssDecl
+	for _, e := range strings.Split(css, ";") {
+		colon := strings.Index(e, ":")
+		if colon <= 0 {
+			continue
+		}
+		d := cssDecl{
+			name:  strings.ToLower(strings.TrimSpace(e[:colon])),
+			value: strings.TrimSpace(e[colon+1:]),
+		}
+		if i := strings.LastIndexByte(d.value, '!'); i >= 0 &&
+			strings.EqualFold(strings.TrimSpace(d.value[i+1:]), "important") {
+			d.value = strings.TrimSpace(d.value[:i])
+			d.important = true
+		}
+		v = append(v, d)
+	}
+	return v
+}
+
+// parse_selector parses a selector of type, class, id and
+// universal selectors with descendant and child combinators.
+func parse_selector(s string) (cssSelector, bool) {
+	s = strings.ReplaceAll(s, ">", " > ")
+
+	var sel cssSelector
+	child := false
+	for _, f := range strings.Fields(s) {
+		if f == ">" {
+			if child || len(sel) == 0 {
+				return nil, false
+			}
+			child = true
+			continue
+		}
+		c, ok := parse_compound(f)
+		if !ok {
+			return nil, false
+		}
+		c.child = child
+		child = false
+		sel = append(sel, c)
+	}
+	if len(sel) == 0 || child {
+		return nil, false
+	}
+	return sel, true
+}
+
+func parse_compound(s string) (cssCompound, bool) {
+	var c cssCompound
+	i := strings.IndexAny(s, ".#")
+	if i < 0 {
+		i = len(s)
+	}
+	c.typ = s[:i]
+	if c.typ == "*" {
+		c.typ = ""
+	} else if c.typ != "" && !is_css_ident(c.typ) {
+		return c, false
+	}
+
+	for s = s[i:]; s != ""; {
+		kind := s[0]
+		s = s[1:]
+		e := strings.IndexAny(s, ".#")
+		if e < 0 {
+			e = len(s)
+		}
+		name := s[:e]
+		s = s[e:]
+		if !is_css_ident(name) {
+			return c, false
+		}
+		if kind == '#' {
+			if c.id != "" && c.id != name {
+				return c, false
+			}
+			c.id = name
+		} else {
+			c.classes = append(c.classes, name)
+		}
+	}
+	return c, true
+}
+
+func is_css_ident(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '-' || r == '_' || r >= 0x80 ||
+			('0' <= r && r <= '9') ||
+			('a' <= r && r <= 'z') ||
+			('A' <= r && r <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity returns the selector specificity
+// as ids×10000 + classes×100 + types.
+func (sel cssSelector) specificity() int {
+	n := 0
+	for _, c := range sel {
+		if c.id != "" {
+			n += 10000
+		}
+		n += 100 * len(c.classes)
+		if c.typ != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// match reports if sel matches the last element of path,
+// the elements from the root to the element.
+func (sel cssSelector) match(path []*Node) bool {
+	k := len(sel) - 1
+	if len(path) == 0 || !sel[k].match(path[len(path)-1]) {
+		return false
+	}
+	return sel[:k].matchAncestors(path[:len(path)-1], sel[k].child)
+}
+
+// matchAncestors matches sel against the ancestors in path.
+// If child is set, the last compound must match the parent.
+func (sel cssSelector) matchAncestors(path []*Node, child bool) bool {
+	if len(sel) == 0 {
+		return true
+	}
+	k := len(sel) - 1
+	for i := len(path) - 1; i >= 0; i-- {
+		if sel[k].match(path[i]) && sel[:k].matchAncestors(path[:i], sel[k].child) {
+			return true
+		}
+		if child {
+			return false
+		}
+	}
+	return false
+}
+
+func (c cssCompound) match(n *Node) bool {
+	if c.typ != "" && c.typ != n.Name.Local {
+		return false
+	}
+	if c.id != "" && findattr(*n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) != 0 {
+		cl := strings.Fields(findattr(*n, "class"))
+		for _, x := range c.classes {
+			if !contains_string(cl, x) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains_string(v []string, s string) bool {
+	for _, x := range v {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
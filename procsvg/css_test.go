@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyStyles(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg">
+<style><![CDATA[
+/* Illustrator style export */
+.cls-1{fill:#e33}
+.cls-2, #b { fill: #00f; stroke: red }
+@media print { rect { fill: black } }
+g rect { stroke-width: 2 }
+g > .cls-1 { stroke-width: 3 }
+rect.cls-1.cls-2 { fill: lime }
+path { fill: gray !important }
+a:hover { fill: pink }
+]]>
+</style>
+<rect id="a" class="cls-1"/>
+<rect id="b" class="cls-2" fill="#fff"/>
+<g><rect id="c" class="cls-1 cls-2" style="fill: #123"/></g>
+<g><a><rect id="d" class="cls-1"/></a></g>
+<path id="e" style="fill: #456"/>
+<path id="f" style="fill: #456 !important"/>
+<circle id="g" fill="inherit"/>
+</svg>`
+
+	root, err := xmlTree(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply_styles(&root)
+
+	ids := make(map[string]*Node)
+	collect_ids(&root, ids)
+
+	tests := []struct {
+		id, attr, want string
+	}{
+		{"a", "fill", "#e33"},
+		{"a", "stroke", ""},
+		{"a", "stroke-width", ""},
+		{"b", "fill", "#00f"},
+		{"b", "stroke", "red"},
+		{"c", "fill", "#123"},
+		{"c", "stroke-width", "3"},
+		{"d", "fill", "#e33"},
+		{"d", "stroke-width", "2"},
+		{"e", "fill", "gray"},
+		{"f", "fill", "#456"},
+		{"g", "fill", ""},
+	}
+	for _, tt := range tests {
+		n := ids[tt.id]
+		if n == nil {
+			t.Fatalf("missing element %q", tt.id)
+		}
+		if got := get_presentation_attr(*n, tt.attr); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.id, tt.attr, got, tt.want)
+		}
+	}
+}
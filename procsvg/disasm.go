@@ -4,43 +4,44 @@ import (
 	"fmt"
 	"image/color"
 	"io"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
 )
 
 func DumpPack(r io.Reader, w io.Writer) {
-	var header [8]byte
-	_, err := io.ReadFull(r, header[:])
-	if err != nil {
-		fmt.Fprintf(w, "# I/O ERROR %s", err)
-		return
-	}
+	// Drain r so that writers of a pipe are not blocked on errors.
+	defer io.Copy(io.Discard, r)
 
-	if string(header[:4]) != PackMagic {
-		fmt.Fprintf(w, "# invalid header %02x\n", header[:4])
+	sc, err := iconpack.NewScanner(r)
+	if err != nil {
+		fmt.Fprintf(w, "# ERROR %s\n", err)
 		return
 	}
+	fmt.Fprintf(w, "# %d icons\n", sc.NumIcons)
 
-	nicons := int(byteOrder.Uint32(header[4:]))
-	fmt.Fprintf(w, "# %d icons\n", nicons)
-
-	var pal0 []color.NRGBA
-
+	// Sections are dumped as they are decoded,
+	// so that invalid packs are dumped up to the error.
+	var pal0 iconpack.Palette
+	nicons := 0
 	for {
-		magic, data, err := readSection(r)
+		sec, err := sc.Next()
 		if err == io.EOF {
+			if err := sc.Check(nicons); err != nil {
+				fmt.Fprintf(w, "# ERROR %s\n", err)
+			}
 			fmt.Fprintln(w, "# EOF")
 			return
 		}
 		if err != nil {
-			fmt.Fprintf(w, "# I/O ERROR %s", err)
+			fmt.Fprintf(w, "# ERROR %s\n", err)
 			return
 		}
 
-		switch magic {
-
-		case PaletteMagic:
-			pal, idx, err := parsePalette(data)
+		switch sec.Magic {
+		case iconpack.PaletteMagic:
+			pal, idx, err := sec.Palette()
 			if err != nil {
-				fmt.Fprintf(w, "# palette data ERROR %s", err)
+				fmt.Fprintf(w, "# palette data ERROR %s\n", err)
 				return
 			}
 			fmt.Fprintf(w, "PALETTE %d # %d entries\n", idx, len(pal))
@@ -53,117 +54,31 @@ func DumpPack(r io.Reader, w io.Writer) {
 			}
 			fmt.Fprintln(w)
 
-		case IconMagic:
-			pe, err := parseIcon(data)
+		case iconpack.CurrentColorMagic:
+			i, err := sec.CurrentColor()
 			if err != nil {
-				fmt.Fprintf(w, "# icon data ERROR %s", err)
+				fmt.Fprintf(w, "# current color ERROR %s\n", err)
 				return
 			}
+			fmt.Fprintf(w, "# currentColor: palette index %d\n\n", i)
 
-			for _, m := range pe.Image {
-				fmt.Fprintf(w, "ICON %q %d×%d\n", pe.Name, m.Width, m.Height)
+		case iconpack.IconMagic:
+			ic, err := sec.Icon()
+			if err != nil {
+				fmt.Fprintf(w, "# icon data ERROR %s\n", err)
+				return
+			}
+			nicons++
+			for _, m := range ic.Variants {
+				fmt.Fprintf(w, "ICON %q %d×%d\n", ic.Name, m.Width, m.Height)
 				disasm(w, pal0, m.Data)
 				fmt.Fprintln(w)
 			}
 
 		default:
-			fmt.Fprintf(w, "# unrecognised section '%s'\n\n", magic)
-		}
-	}
-}
-
-func readSection(r io.Reader) (magic string, data []byte, err error) {
-	var header [8]byte
-	_, err = io.ReadFull(r, header[:])
-	if err != nil {
-		return "", nil, err
-	}
-
-	nbytes := int(byteOrder.Uint32(header[4:]))
-	if nbytes > 1<<20 {
-		return "", nil, fmt.Errorf("Section size too large")
-	}
-
-	data = make([]byte, int(nbytes))
-	if _, err := io.ReadFull(r, data); err != nil {
-		if err == io.EOF {
-			err = io.ErrUnexpectedEOF
-		}
-
-		return "", nil, err
-	}
-
-	return string(header[:4]), data, nil
-}
-
-func parsePalette(data []byte) (pal []color.NRGBA, idx int, err error) {
-	n := len(data)
-	if n < 2 || n != 2+4*int(data[1]) {
-		return nil, 0, fmt.Errorf("invalid palette size %d", n)
-	}
-
-	idx = int(data[0])
-	for i := 2; i < n; i += 4 {
-		c := data[i:]
-		pal = append(pal, color.NRGBA{c[0], c[1], c[2], c[3]})
-	}
-	return pal, idx, nil
-}
-
-var errInvalidIconHeader = fmt.Errorf("Invalid icon header")
-
-func parseIcon(data []byte) (PackElem, error) {
-	e := int(data[0]) + 1
-	if e+1 > len(data) {
-		return PackElem{}, errInvalidIconHeader
-	}
-
-	name := string(data[1:e])
-
-	numimages := int(data[e])
-	data = data[e+1:]
-
-	const ihbytes = 8
-	if len(data) < numimages*ihbytes {
-		return PackElem{}, errInvalidIconHeader
-	}
-
-	type imageInfo struct {
-		dx, dy   uint16
-		bytesize int
-	}
-
-	var ii []imageInfo
-	for i := 0; i < numimages; i++ {
-		dx := byteOrder.Uint16(data[0:])
-		dy := byteOrder.Uint16(data[2:])
-		bs := int(byteOrder.Uint32(data[4:]))
-
-		data = data[8:]
-
-		ii = append(ii, imageInfo{dx, dy, bs})
-	}
-
-	pe := PackElem{Name: name}
-	for _, inf := range ii {
-		if len(data) < inf.bytesize {
-			return PackElem{}, fmt.Errorf("Image data invalid")
+			fmt.Fprintf(w, "# unrecognised section '%s'\n\n", sec.Magic)
 		}
-
-		pe.Image = append(pe.Image, &ProgImage{
-			Width:  int(inf.dx),
-			Height: int(inf.dy),
-			Data:   data[:inf.bytesize],
-		})
-
-		data = data[inf.bytesize:]
 	}
-
-	if len(data) != 0 {
-		return PackElem{}, fmt.Errorf("Garbage after image data")
-	}
-
-	return pe, nil
 }
 
 type ProgReader struct {
@@ -192,8 +107,15 @@ func (r *ProgReader) Point() {
 	fmt.Fprintf(r.out, "%-24s   %8.4f  %8.4f\n", dump, x, y)
 }
 
+func (r *ProgReader) Value() {
+	s := r.pos
+	v := r.Coord()
+	dump := fmt.Sprintf("% 02x", r.data[s:r.pos])
+	fmt.Fprintf(r.out, "%-24s   %8.4f\n", dump, v)
+}
+
 func (r *ProgReader) Coord() float64 {
-	c, n := CoordFromBytes(r.data[r.pos:])
+	c, n := iconpack.CoordFromBytes(r.data[r.pos:])
 	r.pos += n
 	return c
 }
@@ -231,11 +153,36 @@ func colorstr(c color.NRGBA) string {
 	}
 }
 
+// palcolor reads a palette index and formats it with its color.
+func (pr *ProgReader) palcolor() string {
+	i := int(pr.Byte())
+	var c color.NRGBA
+	if i < len(pr.pal) {
+		c = pr.pal[i]
+	} else {
+		fmt.Fprintln(pr.out, "# INVALID palette index")
+	}
+	return fmt.Sprintf("%d → %s", i, colorstr(c))
+}
+
+// palalpha reads a palette index and alpha and formats them.
+func (pr *ProgReader) palalpha() string {
+	c := pr.palcolor()
+	return c + fmt.Sprintf(" α %.4f", float64(pr.Byte())/255)
+}
+
+func modestr(m byte, names ...string) string {
+	if int(m) < len(names) {
+		return names[m]
+	}
+	return fmt.Sprintf("INVALID(%d)", m)
+}
+
 func (pr *ProgReader) stepCmd() {
 	s := pr.pos
 	op := pr.Byte()
 	var cmd string
-	var ncoords int
+	var nvalues, ncoords, narcs int
 	switch op & 0xf0 {
 
 	case 0x00:
@@ -249,14 +196,63 @@ func (pr *ProgReader) stepCmd() {
 			cmd = fmt.Sprintf("SOLIDFILL-rgba %s", colorstr(c))
 
 		case 0x02:
-			i := int(pr.Byte())
-			var c color.NRGBA
-			if i < len(pr.pal) {
-				c = pr.pal[i]
-			} else {
-				fmt.Fprintln(pr.out, "# INVALID palette index")
-			}
-			cmd = fmt.Sprintf("SOLIDFILL-idx %d → %s", i, colorstr(c))
+			cmd = "SOLIDFILL-idx " + pr.palcolor()
+
+		case 0x03:
+			cmd = "NOFILL"
+
+		case 0x04:
+			cmd = fmt.Sprintf("FILLRULE %s", modestr(pr.Byte(), "nonzero", "evenodd"))
+
+		case 0x05:
+			cmd = "LINEARGRADIENT"
+			ncoords = 2
+
+		case 0x06:
+			cmd = "RADIALGRADIENT"
+			ncoords = 4
+
+		case 0x07:
+			cmd = "SOLIDFILL-idx " + pr.palalpha()
+		}
+
+	case 0x10:
+		switch op {
+
+		case 0x10:
+			cmd = "NOSTROKE"
+
+		case 0x11:
+			c := color.NRGBA{pr.Byte(), pr.Byte(), pr.Byte(), pr.Byte()}
+			cmd = fmt.Sprintf("STROKE-rgba %s", colorstr(c))
+
+		case 0x12:
+			cmd = "STROKE-idx " + pr.palcolor()
+
+		case 0x13:
+			cmd = fmt.Sprintf("STROKEWIDTH %.4f", pr.Coord())
+
+		case 0x14:
+			cmd = fmt.Sprintf("LINECAP %s", modestr(pr.Byte(), "butt", "round", "square"))
+
+		case 0x15:
+			cmd = fmt.Sprintf("LINEJOIN %s", modestr(pr.Byte(), "miter", "round", "bevel"))
+
+		case 0x16:
+			cmd = fmt.Sprintf("MITERLIMIT %.4f", pr.Coord())
+
+		case 0x17:
+			cmd = "STROKE-idx " + pr.palalpha()
+		}
+
+	case 0x20:
+		switch op {
+
+		case 0x20:
+			cmd = fmt.Sprintf("PUSHCLIP %s", modestr(pr.Byte(), "nonzero", "evenodd"))
+
+		case 0x21:
+			cmd = "POPCLIP"
 		}
 
 	case 0x70:
@@ -268,6 +264,9 @@ func (pr *ProgReader) stepCmd() {
 			ncoords = 1
 			cmd = "M-cont"
 		}
+		if op == 0x72 {
+			cmd = "Z"
+		}
 
 	case 0x80, 0x90:
 		ncoords = int(op-0x80) + 1
@@ -282,6 +281,31 @@ func (pr *ProgReader) stepCmd() {
 		nseg := int(op-0xb0) + 1
 		ncoords = 2 * nseg
 		cmd = fmt.Sprintf("Q %d", nseg)
+
+	case 0xc0:
+		narcs = int(op-0xc0) + 1
+		cmd = fmt.Sprintf("A %d", narcs)
+
+	case 0xd0:
+		ncoords = int(op-0xd0) + 1
+		cmd = fmt.Sprintf("l %d", ncoords)
+
+	case 0xe0:
+		if op < 0xe8 {
+			nseg := int(op-0xe0) + 1
+			ncoords = 3 * nseg
+			cmd = fmt.Sprintf("c %d", nseg)
+		} else {
+			nseg := int(op-0xe8) + 1
+			ncoords = 2 * nseg
+			cmd = fmt.Sprintf("q %d", nseg)
+		}
+
+	case 0xf0:
+		if op <= 0xf3 {
+			nvalues = 1
+			cmd = [...]string{"H", "V", "h", "v"}[op-0xf0]
+		}
 	}
 
 	if cmd == "" {
@@ -292,13 +316,66 @@ func (pr *ProgReader) stepCmd() {
 	e := pr.pos
 	dump := fmt.Sprintf("% 02x", pr.data[s:e])
 	fmt.Fprintf(pr.out, "%-24s  %s\n", dump, cmd)
+	for i := 0; i < nvalues; i++ {
+		pr.Value()
+	}
 	for i := 0; i < ncoords; i++ {
 		pr.Point()
 	}
+	for i := 0; i < narcs; i++ {
+		pr.arc()
+	}
+
+	if op == 0x05 || op == 0x06 {
+		pr.gradient()
+	}
 
 	return
 }
 
+// arc prints the ellipse parameters and end point of an arc op segment.
+func (pr *ProgReader) arc() {
+	s := pr.pos
+	rx, ry, rot := pr.Coord(), pr.Coord(), pr.Coord()
+	flags := pr.Byte()
+	dump := fmt.Sprintf("% 02x", pr.data[s:pr.pos])
+	fmt.Fprintf(pr.out, "%-24s   r %.4f %.4f  rot %.4f  large %d sweep %d\n",
+		dump, rx, ry, rot, flags&1, flags>>1&1)
+	if flags > 0x03 {
+		fmt.Fprintln(pr.out, "# INVALID arc flags")
+	}
+	pr.Point()
+}
+
+// gradient prints the spread method and stops of a gradient op.
+func (pr *ProgReader) gradient() {
+	s := pr.pos
+	spread := modestr(pr.Byte(), "pad", "reflect", "repeat")
+	n := int(pr.Byte())
+	fmt.Fprintf(pr.out, "%-24s  spread %s, %d stops\n", fmt.Sprintf("% 02x", pr.data[s:pr.pos]), spread, n)
+
+	for i := 0; i < n && pr.pos < len(pr.data); i++ {
+		s := pr.pos
+		offset := float64(pr.Byte()) / 255
+		var stop string
+		switch pr.Byte() {
+		case 0:
+			c := color.NRGBA{pr.Byte(), pr.Byte(), pr.Byte(), pr.Byte()}
+			stop = colorstr(c)
+		case 1:
+			stop = "idx " + pr.palalpha()
+		default:
+			stop = "INVALID"
+			pr.invalid = true
+		}
+		dump := fmt.Sprintf("% 02x", pr.data[s:pr.pos])
+		fmt.Fprintf(pr.out, "%-24s    stop %.4f %s\n", dump, offset, stop)
+		if pr.invalid {
+			return
+		}
+	}
+}
+
 func disasm(w io.Writer, pal []color.NRGBA, data []byte) {
 	r := ProgReader{
 		out:  w,
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestFillRule(t *testing.T) {
+	const r = `<rect width="4" height="4"/>`
+
+	tests := []struct {
+		elem string
+		want string
+	}{
+		{r + r, "path path"},
+		{r + `<rect width="4" height="4" fill-rule="nonzero"/>`, "path path"},
+		{`<rect width="4" height="4" fill-rule="evenodd"/><rect width="4" height="4" fill-rule="evenodd"/>`,
+			"SetFillRule 1 path path"},
+		{`<g fill-rule="evenodd">` + r + r + `</g>`,
+			"SetFillRule 1 path path"},
+		{`<g fill-rule="evenodd"><g>` + r + `</g>` + r + `</g>`,
+			"SetFillRule 1 path path"},
+		{`<g style="fill-rule: evenodd">` + r + `</g>`,
+			"SetFillRule 1 path"},
+		{`<g fill-rule="evenodd">` + r + `<rect width="4" height="4" fill-rule="nonzero"/>` + r + `</g>`,
+			"SetFillRule 1 path SetFillRule 0 path SetFillRule 1 path"},
+		{`<g fill-rule="evenodd">` + r + `</g>` + r,
+			"SetFillRule 1 path SetFillRule 0 path"},
+		{`<g fill-rule="evenodd"><rect width="4" height="4" fill-rule="inherit"/></g>`,
+			"SetFillRule 1 path"},
+	}
+
+	for _, tt := range tests {
+		doc := `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">` +
+			tt.elem + `</svg>`
+		prog := procTestSvg(t, doc, svgOpts{currentColor: -1})
+
+		var v []string
+		for _, op := range prog.Ops {
+			switch op.Code {
+			case iconpack.OpFillRule:
+				v = append(v, fmt.Sprintf("%v %d", op.Code, op.Mode))
+			case iconpack.OpBeginMoveTo:
+				v = append(v, "path")
+			}
+		}
+		if got := strings.Join(v, " "); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.elem, got, tt.want)
+		}
+	}
+}
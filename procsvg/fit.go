@@ -0,0 +1,217 @@
+package main
+
+const (
+	// fitMinLines is the number of line segments
+	// in a run needed for fitting curves.
+	fitMinLines = 3
+
+	// fitCornerCos is the cosine of the angle between
+	// line segments above which their joint is a corner.
+	fitCornerCos = 0.5 // 60°
+)
+
+// fit_curves returns cmds with runs of line segments replaced
+// by cubic Bézier curves passing within tol of their points,
+// using Schneider's algorithm. Runs are split at corners,
+// and are replaced only if the curves have fewer points.
+func fit_curves(cmds []PathCmd, tol float64) []PathCmd {
+	if !(tol > 0) {
+		return cmds
+	}
+	return map_segments(cmds, func(segs []pathSeg) []pathSeg {
+		var r []pathSeg
+		for i := 0; i < len(segs); {
+			if segs[i].cmd != 'L' {
+				r = append(r, segs[i])
+				i++
+				continue
+			}
+			pts := []Point{segs[i].pt[0]}
+			for ; i < len(segs) && segs[i].cmd == 'L'; i++ {
+				if p := segs[i].end(); p != pts[len(pts)-1] {
+					pts = append(pts, p)
+				}
+			}
+			for _, run := range split_corners(pts) {
+				r = append(r, fit_run(run, tol)...)
+			}
+		}
+		return r
+	})
+}
+
+// split_corners splits the polyline pts at its corners.
+// The polylines returned share their end points.
+func split_corners(pts []Point) [][]Point {
+	var v [][]Point
+	k := 0
+	for i := 1; i+1 < len(pts); i++ {
+		a, b := unit(pts[i-1], pts[i]), unit(pts[i], pts[i+1])
+		if a.X*b.X+a.Y*b.Y < fitCornerCos {
+			v = append(v, pts[k:i+1])
+			k = i
+		}
+	}
+	return append(v, pts[k:])
+}
+
+// fit_run returns the segments of the polyline pts,
+// fitting curves to it if that needs fewer points.
+func fit_run(pts []Point, tol float64) []pathSeg {
+	var r []pathSeg
+	if len(pts) > fitMinLines {
+		tl := unit(pts[0], pts[1])
+		tr := unit(pts[len(pts)-1], pts[len(pts)-2])
+		curves := fit_cubic(nil, pts, tl, tr, tol)
+		if 3*len(curves) < len(pts)-1 {
+			for _, b := range curves {
+				r = append(r, pathSeg{'C', b})
+			}
+			return r
+		}
+	}
+	for i := 1; i < len(pts); i++ {
+		r = append(r, pathSeg{'L', []Point{pts[i-1], pts[i]}})
+	}
+	return r
+}
+
+// fit_cubic appends cubic curves fitted to the points d to v.
+// The curves start in the direction tl and end from direction tr.
+func fit_cubic(v []bezier, d []Point, tl, tr Point, tol float64) []bezier {
+	if len(d) == 2 {
+		l := dist(d[0], d[1]) / 3
+		return append(v, bezier{d[0], add(d[0], tl, l), add(d[1], tr, l), d[1]})
+	}
+
+	const maxIterations = 4
+	u := chord_params(d)
+	b := generate_bezier(d, u, tl, tr)
+	e, split := max_fit_error(d, b, u)
+	if e <= tol {
+		return append(v, b)
+	}
+	if e <= 4*tol {
+		for i := 0; i < maxIterations; i++ {
+			u = reparameterize(d, b, u)
+			b = generate_bezier(d, u, tl, tr)
+			if e, split = max_fit_error(d, b, u); e <= tol {
+				return append(v, b)
+			}
+		}
+	}
+
+	// Split at the point of the largest error.
+	tc := unit(d[split+1], d[split-1])
+	if tc == (Point{}) {
+		tc = unit(d[split], d[split-1])
+	}
+	v = fit_cubic(v, d[:split+1], tl, tc, tol)
+	return fit_cubic(v, d[split:], Point{-tc.X, -tc.Y}, tr, tol)
+}
+
+// chord_params returns the parameters of the points d
+// proportional to the polyline length up to them.
+func chord_params(d []Point) []float64 {
+	u := make([]float64, len(d))
+	for i := 1; i < len(d); i++ {
+		u[i] = u[i-1] + dist(d[i-1], d[i])
+	}
+	for i := range u {
+		u[i] /= u[len(u)-1]
+	}
+	return u
+}
+
+// generate_bezier returns the least squares fit of a cubic
+// curve to d at parameters u with the end tangents tl and tr.
+func generate_bezier(d []Point, u []float64, tl, tr Point) bezier {
+	p0, p3 := d[0], d[len(d)-1]
+
+	var c [2][2]float64
+	var x [2]float64
+	for i, t := range u {
+		s := 1 - t
+		b0, b1, b2, b3 := s*s*s, 3*t*s*s, 3*t*t*s, t*t*t
+		a0 := Point{tl.X * b1, tl.Y * b1}
+		a1 := Point{tr.X * b2, tr.Y * b2}
+		c[0][0] += dot(a0, a0)
+		c[0][1] += dot(a0, a1)
+		c[1][1] += dot(a1, a1)
+		tmp := Point{
+			d[i].X - p0.X*(b0+b1) - p3.X*(b2+b3),
+			d[i].Y - p0.Y*(b0+b1) - p3.Y*(b2+b3),
+		}
+		x[0] += dot(a0, tmp)
+		x[1] += dot(a1, tmp)
+	}
+	c[1][0] = c[0][1]
+
+	var al, ar float64
+	if det := c[0][0]*c[1][1] - c[1][0]*c[0][1]; det != 0 {
+		al = (x[0]*c[1][1] - x[1]*c[0][1]) / det
+		ar = (c[0][0]*x[1] - c[1][0]*x[0]) / det
+	}
+
+	// Fall back to a heuristic for degenerate fits.
+	l := dist(p0, p3)
+	if eps := 1e-6 * l; al < eps || ar < eps {
+		al, ar = l/3, l/3
+	}
+	return bezier{p0, add(p0, tl, al), add(p3, tr, ar), p3}
+}
+
+// reparameterize returns u improved with a Newton-Raphson step
+// to parameters of the points of b nearest to d.
+func reparameterize(d []Point, b bezier, u []float64) []float64 {
+	r := make([]float64, len(u))
+	q1 := bezier{
+		{3 * (b[1].X - b[0].X), 3 * (b[1].Y - b[0].Y)},
+		{3 * (b[2].X - b[1].X), 3 * (b[2].Y - b[1].Y)},
+		{3 * (b[3].X - b[2].X), 3 * (b[3].Y - b[2].Y)},
+	}
+	q2 := bezier{
+		{2 * (q1[1].X - q1[0].X), 2 * (q1[1].Y - q1[0].Y)},
+		{2 * (q1[2].X - q1[1].X), 2 * (q1[2].Y - q1[1].Y)},
+	}
+	for i, t := range u {
+		p, p1, p2 := b.at(t), q1.at(t), q2.at(t)
+		dp := Point{p.X - d[i].X, p.Y - d[i].Y}
+		num := dot(dp, p1)
+		den := dot(p1, p1) + dot(dp, p2)
+		r[i] = t
+		if den != 0 {
+			r[i] = t - num/den
+		}
+	}
+	return r
+}
+
+// max_fit_error returns the largest distance of the points d
+// from b at parameters u, and the index of its point.
+func max_fit_error(d []Point, b bezier, u []float64) (float64, int) {
+	e, split := 0.0, len(d)/2
+	for i := 1; i < len(d)-1; i++ {
+		if x := dist(b.at(u[i]), d[i]); x > e {
+			e, split = x, i
+		}
+	}
+	return e, split
+}
+
+// unit returns the unit vector from a to b, or zero if a equals b.
+func unit(a, b Point) Point {
+	l := dist(a, b)
+	if l == 0 {
+		return Point{}
+	}
+	return Point{(b.X - a.X) / l, (b.Y - a.Y) / l}
+}
+
+func add(p, v Point, f float64) Point {
+	return Point{p.X + v.X*f, p.Y + v.Y*f}
+}
+
+func dot(a, b Point) float64 {
+	return a.X*b.X + a.Y*b.Y
+}
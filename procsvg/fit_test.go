@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitCurves(t *testing.T) {
+	// Half circles meeting at a corner at (20, 0).
+	var pts []Point
+	for i := 0; i <= 32; i++ {
+		a := math.Pi * float64(i) / 32
+		pts = append(pts, Point{10 - 10*math.Cos(a), -10 * math.Sin(a)})
+	}
+	for i := 1; i <= 32; i++ {
+		a := math.Pi * float64(i) / 32
+		pts = append(pts, Point{30 - 10*math.Cos(a), -10 * math.Sin(a)})
+	}
+	cmds := []PathCmd{{'M', pts[:1]}, {'L', pts[1:]}, {'Z', nil}}
+
+	const tol = 0.05
+	got := fit_curves(cmds, tol)
+	if len(got) != 3 || got[1].Cmd != 'C' || got[2].Cmd != 'Z' {
+		t.Fatalf("got %s", fmtCmds(got))
+	}
+	if n := len(got[1].Pt); n >= len(pts)-1 {
+		t.Errorf("got %d curve points for %d line points", n, len(pts)-1)
+	}
+
+	var curves []bezier
+	cur := got[0].Pt[0]
+	for i := 0; i < len(got[1].Pt); i += 3 {
+		b := append(bezier{cur}, got[1].Pt[i:i+3]...)
+		curves = append(curves, b)
+		cur = b[3]
+	}
+	corner := false
+	for _, b := range curves {
+		corner = corner || math.Hypot(b[3].X-20, b[3].Y) < 1e-9
+	}
+	if !corner {
+		t.Error("corner not kept")
+	}
+	for _, p := range pts {
+		d := math.Inf(1)
+		for _, b := range curves {
+			for i := 0; i < 100; i++ {
+				q0, q1 := b.at(float64(i)/100), b.at(float64(i+1)/100)
+				d = math.Min(d, segment_dist(q0, q1, p))
+			}
+		}
+		if d > tol {
+			t.Errorf("point %v at distance %g", p, d)
+		}
+	}
+
+	square := []PathCmd{{'M', []Point{{0, 0}}}, {'L', []Point{{10, 0}, {10, 10}, {0, 10}}}, {'Z', nil}}
+	if got, want := fmtCmds(fit_curves(square, tol)), fmtCmds(square); got != want {
+		t.Errorf("square:\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html/template"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+// gallery_main runs the gallery subcommand that writes
+// self-contained HTML contact sheets of icon packs.
+func gallery_main(args []string) error {
+	fs := flag.NewFlagSet("gallery", flag.ExitOnError)
+	out := fs.String("o", "", "output file (default: icon pack name with .html extension)")
+	prefix := fs.String("prefix", "", "ID prefix for generated IDs")
+	base := fs.Int("base", 0, "index of the first icon")
+	scale := fs.Int("scale", 2, "image scale factor for high DPI displays")
+	fs.BoolVar(&cli.verbose, "v", false, "verbose operation")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: procsvg gallery [flags] iconpack...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("No icon pack files")
+	}
+	if *out != "" && fs.NArg() > 1 {
+		return fmt.Errorf("Output file specified for multiple icon packs")
+	}
+	if *scale <= 0 {
+		return fmt.Errorf("Invalid scale factor %d", *scale)
+	}
+
+	for _, fn := range fs.Args() {
+		pack, err := iconpack.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %w", fn, err)
+		}
+
+		target := *out
+		if target == "" {
+			target = strings.TrimSuffix(fn, filepath.Ext(fn)) + ".html"
+		}
+
+		if cli.verbose {
+			fmt.Printf("Gallery %s\n", target)
+		}
+
+		data := gallery_data(pack, filepath.Base(fn), *prefix, *base, *scale)
+		if err := write_gallery(target, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type galleryData struct {
+	Title    string
+	Palettes []galleryPalette
+	Icons    []galleryIcon
+}
+
+type galleryPalette struct {
+	Index  int
+	Colors []string
+}
+
+type galleryIcon struct {
+	Index    int
+	Name     string
+	ID       string
+	Variants []galleryVariant
+}
+
+type galleryVariant struct {
+	Width  int
+	Height int
+	Bytes  int
+
+	Images []template.URL // PNG data for each palette
+	Err    string
+}
+
+func gallery_data(pack *iconpack.Pack, title, prefix string, base, scale int) galleryData {
+	data := galleryData{Title: title}
+
+	pals := pack.Palettes()
+	for i, pal := range pals {
+		gp := galleryPalette{Index: i}
+		for _, c := range pal {
+			gp.Colors = append(gp.Colors, fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A))
+		}
+		data.Palettes = append(data.Palettes, gp)
+	}
+	if len(pals) == 0 {
+		pals = []iconpack.Palette{nil}
+		data.Palettes = []galleryPalette{{Index: 0}}
+	}
+
+	for _, ic := range pack.Icons() {
+		gi := galleryIcon{
+			Index: base + ic.Index,
+			Name:  ic.Name,
+			ID:    makeid(prefix, ic.Name),
+		}
+
+		for _, v := range ic.Variants {
+			gv := galleryVariant{
+				Width:  v.Width,
+				Height: v.Height,
+				Bytes:  len(v.Data),
+			}
+
+			for _, pal := range pals {
+				u, err := png_data_url(v, v.Width*scale, v.Height*scale, pal)
+				if err != nil {
+					gv.Images = nil
+					gv.Err = err.Error()
+					break
+				}
+				gv.Images = append(gv.Images, u)
+			}
+
+			gi.Variants = append(gi.Variants, gv)
+		}
+
+		data.Icons = append(data.Icons, gi)
+	}
+
+	return data
+}
+
+func png_data_url(v *iconpack.Variant, dx, dy int, pal iconpack.Palette) (template.URL, error) {
+	m, err := render_variant(v, dx, dy, pal)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		return "", err
+	}
+
+	return template.URL("data:image/png;base64," +
+		base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+func write_gallery(fn string, data galleryData) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+
+	err = galleryTemplate.Execute(f, data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #fff; color: #222; }
+body.dark { background: #333; color: #ddd; }
+.toolbar { position: sticky; top: 0; padding: .5em 0; background: inherit; }
+.toolbar label { margin-right: 1em; }
+.swatch { display: inline-block; width: .8em; height: .8em; border: 1px solid #888; }
+.icons { display: flex; flex-wrap: wrap; gap: .5em; }
+.icon { border: 1px solid #8888; border-radius: 4px; padding: .5em; min-width: 10em; }
+.icon .name { font-weight: bold; }
+.icon .id, .icon .info { font-family: monospace; font-size: smaller; }
+.variant { display: inline-block; margin: .5em .5em 0 0; text-align: center; vertical-align: bottom; }
+.variant img { display: none; }
+.error { color: #c00; font-size: smaller; }
+{{range .Palettes}}body.pal{{.Index}} .variant img.pal{{.Index}} { display: inline; }
+{{end -}}
+</style>
+</head>
+<body class="pal0">
+<h1>{{.Title}}</h1>
+<div class="toolbar">
+Palette:
+{{range .Palettes -}}
+<label><input type="radio" name="palette" value="{{.Index}}"{{if eq .Index 0}} checked{{end}}
+ onclick="setPalette({{.Index}})"> {{.Index}}
+{{range .Colors}}<span class="swatch" style="background: {{.}}"></span>{{end}}</label>
+{{end -}}
+<label><input type="checkbox" onclick="document.body.classList.toggle('dark', this.checked)"> dark background</label>
+</div>
+<div class="icons">
+{{range .Icons -}}
+<div class="icon">
+<div class="name">{{.Name}}</div>
+<div class="id">{{.ID}}</div>
+<div class="info">index {{.Index}}</div>
+{{range .Variants -}}
+<div class="variant">
+{{if .Err}}<div class="error">{{.Err}}</div>{{end -}}
+{{$v := .}}{{range $i, $u := .Images}}<img class="pal{{$i}}" src="{{$u}}" width="{{$v.Width}}" height="{{$v.Height}}">{{end}}
+<div class="info">{{.Width}}×{{.Height}}<br>{{.Bytes}} bytes</div>
+</div>
+{{end -}}
+</div>
+{{end -}}
+</div>
+<script>
+function setPalette(i) {
+	var dark = document.body.classList.contains('dark');
+	document.body.className = 'pal' + i;
+	document.body.classList.toggle('dark', dark);
+}
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGallery(t *testing.T) {
+	const square = `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 16 16">
+<rect width="16" height="16" fill="#00f"/></svg>`
+	pack := testPack(t, map[string][]string{
+		"arrow-left": {fmt.Sprintf(square, 16, 16)},
+		"home":       {fmt.Sprintf(square, 16, 16), fmt.Sprintf(square, 32, 24)},
+	})
+
+	data := gallery_data(pack, "test.icpk", "ICON_", 100, 2)
+
+	var got []string
+	for _, gi := range data.Icons {
+		s := fmt.Sprintf("%d %s %s", gi.Index, gi.Name, gi.ID)
+		for _, gv := range gi.Variants {
+			s += fmt.Sprintf(" %dx%d/%d", gv.Width, gv.Height, len(gv.Images))
+			if gv.Err != "" {
+				t.Errorf("%s %dx%d: %s", gi.Name, gv.Width, gv.Height, gv.Err)
+			}
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"100 arrow-left ICON_arrow_left 16x16/1",
+		"101 home ICON_home 32x24/1 16x16/1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got icons\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if len(data.Palettes) != 1 || strings.Join(data.Palettes[0].Colors, " ") != "#ff0000ff #0000ffff" {
+		t.Errorf("got palettes %v", data.Palettes)
+	}
+
+	// Images are rendered at the gallery scale.
+	const urlPrefix = "data:image/png;base64,"
+	v := data.Icons[1].Variants[0]
+	u := string(v.Images[0])
+	if !strings.HasPrefix(u, urlPrefix) {
+		t.Fatalf("got image URL %.40q", u)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(u, urlPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 64 || cfg.Height != 48 {
+		t.Errorf("got image size %dx%d, want 64x48", cfg.Width, cfg.Height)
+	}
+
+	fn := filepath.Join(t.TempDir(), "test.html")
+	if err := write_gallery(fn, data); err != nil {
+		t.Fatal(err)
+	}
+	html, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<title>test.icpk</title>",
+		`<div class="name">arrow-left</div>`,
+		`<div class="id">ICON_home</div>`,
+		`<div class="info">index 101</div>`,
+		`<img class="pal0" src="` + u + `" width="32" height="24">`,
+		"32×24<br>",
+	} {
+		if !bytes.Contains(html, []byte(s)) {
+			t.Errorf("gallery missing %.80q", s)
+		}
+	}
+	if n := bytes.Count(html, []byte(`src="`+urlPrefix)); n != 3 {
+		t.Errorf("got %d images, want 3", n)
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// gradient is a linearGradient or radialGradient
+// with its xlink:href references resolved.
+type gradient struct {
+	radial bool
+	attr   map[string]string
+	stops  []gradientStop
+}
+
+type gradientStop struct {
+	offset float64
+	color  color.NRGBA // stop-color with stop-opacity
+
+	// current is set if stop-color is the current color palette entry
+	current bool
+}
+
+func is_gradient(n *Node) bool {
+	return n.Name.Local == "linearGradient" || n.Name.Local == "radialGradient"
+}
+
+// paint_url returns the element id of the paint server reference
+// in the fill or stroke property value s.
+func paint_url(s string) (string, bool) {
+	if !strings.HasPrefix(s, "url(") {
+		return "", false
+	}
+	end := strings.Index(s, ")")
+	if end < 0 {
+		return "", false
+	}
+	ref := strings.Trim(strings.TrimSpace(s[4:end]), `"'`)
+	if !strings.HasPrefix(ref, "#") {
+		return "", false
+	}
+	return ref[1:], true
+}
+
+// resolve_gradient resolves gradient attributes and stops of n,
+// following the xlink:href chain of template gradients.
+func (g *svgprog) resolve_gradient(n *Node) (*gradient, error) {
+	gr := &gradient{
+		radial: n.Name.Local == "radialGradient",
+		attr:   make(map[string]string),
+	}
+
+	seen := make(map[*Node]bool)
+	hasStops := false
+	for n != nil && is_gradient(n) && !seen[n] {
+		seen[n] = true
+
+		for _, a := range n.Attr {
+			if _, ok := gr.attr[a.Name.Local]; !ok {
+				gr.attr[a.Name.Local] = a.Value
+			}
+		}
+
+		if !hasStops {
+			for _, c := range n.Node {
+				if c.Name.Local != "stop" {
+					continue
+				}
+				s, err := parse_gradient_stop(c, g.currentColor)
+				if err != nil {
+					return nil, err
+				}
+				s.current = g.use_current_index(get_presentation_attr(c, "stop-color"))
+				if k := len(gr.stops); k != 0 && s.offset < gr.stops[k-1].offset {
+					s.offset = gr.stops[k-1].offset
+				}
+				gr.stops = append(gr.stops, s)
+				hasStops = true
+			}
+		}
+
+		href := strings.TrimPrefix(get_href(*n), "#")
+		n = g.ids[href]
+	}
+
+	return gr, nil
+}
+
+func parse_gradient_stop(n Node, current color.NRGBA) (gradientStop, error) {
+	var s gradientStop
+
+	if a := findattr(n, "offset"); a != "" {
+		v, err := parse_fraction(a)
+		if err != nil {
+			return s, fmt.Errorf("stop offset: %w", err)
+		}
+		s.offset = clamp01(v)
+	}
+
+	s.color = color.NRGBA{0, 0, 0, 0xff}
+	if a := get_presentation_attr(n, "stop-color"); a != "" {
+		if c, ok := parse_color(a, current); ok {
+			s.color = c
+		}
+	}
+
+	if a := get_presentation_attr(n, "stop-opacity"); a != "" {
+		v, err := parse_opacity(a)
+		if err != nil {
+			return s, fmt.Errorf("stop-opacity: %w", err)
+		}
+		s.color = with_alpha(s.color, v)
+	}
+
+	return s, nil
+}
+
+// parse_fraction parses a number or percentage.
+func parse_fraction(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		v, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		return v / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// coord returns the gradient coordinate attribute name.
+// Percentages are relative to ref in user space.
+func (gr *gradient) coord(name, def string, ref float64) (float64, error) {
+	s, ok := gr.attr[name]
+	if !ok {
+		s = def
+	}
+
+	var v float64
+	var err error
+	if gr.attr["gradientUnits"] == "userSpaceOnUse" {
+		if strings.HasSuffix(strings.TrimSpace(s), "%") {
+			v, err = parse_fraction(s)
+			v *= ref
+		} else {
+			v, err = parse_length(s)
+		}
+	} else {
+		v, err = parse_fraction(s)
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("gradient %s: %w", name, err)
+	}
+	return v, nil
+}
+
+// matrix returns the gradient to user space transformation
+// for an element with bounding box bbox.
+// It returns false if the gradient is not rendered.
+func (gr *gradient) matrix(bbox [2]Point) (Matrix, bool, error) {
+	m := MatrixIdentity
+
+	if gr.attr["gradientUnits"] != "userSpaceOnUse" {
+		w := bbox[1].X - bbox[0].X
+		h := bbox[1].Y - bbox[0].Y
+		if w <= 0 || h <= 0 {
+			return m, false, nil
+		}
+		m = Matrix{w, 0, 0, h, bbox[0].X, bbox[0].Y}
+	}
+
+	if s, ok := gr.attr["gradientTransform"]; ok {
+		t, err := SvgTransformMatrix(s)
+		if err != nil {
+			return m, false, fmt.Errorf("gradientTransform: %w", err)
+		}
+		m = m.Mul(t)
+	}
+
+	return m, true, nil
+}
+
+func (gr *gradient) spread() byte {
+	switch gr.attr["spreadMethod"] {
+	case "reflect":
+		return 1
+	case "repeat":
+		return 2
+	}
+	return 0
+}
+
+// gradient_fill emits the fill op for gradient gr painting cmds.
+// It emits SetNoFill if the gradient paints nothing.
+func (g *svgprog) gradient_fill(gr *gradient, cmds []PathCmd) error {
+	switch len(gr.stops) {
+	case 0:
+		g.mem.Byte(0x03)
+		return nil
+	case 1:
+		s := gr.stops[0]
+		g.paint_op(s.color, s.current, 0x01, 0x02, 0x07)
+		return nil
+	}
+
+	gm, ok, err := gr.matrix(cmds_bbox(cmds))
+	if err != nil || !ok {
+		g.mem.Byte(0x03)
+		return err
+	}
+	m := g.transform().Mul(gm)
+
+	vw, vh := g.viewport.X, g.viewport.Y
+	last := gr.stops[len(gr.stops)-1]
+
+	if !gr.radial {
+		var v [4]float64
+		for i, a := range []struct {
+			name, def string
+			ref       float64
+		}{
+			{"x1", "0%", vw},
+			{"y1", "0%", vh},
+			{"x2", "100%", vw},
+			{"y2", "0%", vh},
+		} {
+			if v[i], err = gr.coord(a.name, a.def, a.ref); err != nil {
+				return err
+			}
+		}
+
+		// Transform the gradient vector so that
+		// the offsets remain perpendicular projections in view space.
+		d := Point{v[2] - v[0], v[3] - v[1]}
+		dd := d.X*d.X + d.Y*d.Y
+		det := m.Determinant()
+		if dd == 0 || det == 0 {
+			g.paint_op(last.color, last.current, 0x01, 0x02, 0x07)
+			return nil
+		}
+		gx := (m[3]*d.X - m[1]*d.Y) / (det * dd)
+		gy := (m[0]*d.Y - m[2]*d.X) / (det * dd)
+		gg := gx*gx + gy*gy
+		p1 := m.Transform(Point{v[0], v[1]})
+		p2 := Point{p1.X + gx/gg, p1.Y + gy/gg}
+
+		g.mem.Byte(0x05)
+		g.mem.Coord(p1.X)
+		g.mem.Coord(p1.Y)
+		g.mem.Coord(p2.X)
+		g.mem.Coord(p2.Y)
+	} else {
+		diag := math.Sqrt((vw*vw + vh*vh) / 2)
+		cx, err := gr.coord("cx", "50%", vw)
+		if err != nil {
+			return err
+		}
+		cy, err := gr.coord("cy", "50%", vh)
+		if err != nil {
+			return err
+		}
+		r, err := gr.coord("r", "50%", diag)
+		if err != nil {
+			return err
+		}
+		fx, fy := cx, cy
+		if _, ok := gr.attr["fx"]; ok {
+			if fx, err = gr.coord("fx", "", vw); err != nil {
+				return err
+			}
+		}
+		if _, ok := gr.attr["fy"]; ok {
+			if fy, err = gr.coord("fy", "", vh); err != nil {
+				return err
+			}
+		}
+
+		if r <= 0 {
+			g.paint_op(last.color, last.current, 0x01, 0x02, 0x07)
+			return nil
+		}
+
+		// Move the focal point inside the circle.
+		if d := math.Hypot(fx-cx, fy-cy); d > r*0.999 {
+			f := r * 0.999 / d
+			fx = cx + (fx-cx)*f
+			fy = cy + (fy-cy)*f
+		}
+
+		rm := m.Mul(Matrix{r, 0, 0, r, cx, cy})
+		if rm.Determinant() == 0 {
+			g.mem.Byte(0x03)
+			return nil
+		}
+		focal := m.Transform(Point{fx, fy})
+
+		g.mem.Byte(0x06)
+		for _, v := range rm {
+			g.mem.Coord(v)
+		}
+		g.mem.Coord(focal.X)
+		g.mem.Coord(focal.Y)
+	}
+
+	g.mem.Byte(gr.spread())
+
+	stops := gr.stops
+	if len(stops) > 0xff {
+		stops = stops[:0xff]
+	}
+	g.mem.Byte(byte(len(stops)))
+	for _, s := range stops {
+		g.mem.Byte(byte(s.offset*0xff + 0.5))
+
+		c := s.color
+		if s.current {
+			g.mem.Byte(1)
+			g.mem.Byte(byte(g.currentIndex))
+			g.mem.Byte(c.A)
+			continue
+		}
+
+		rgb := g.map_color(color.NRGBA{c.R, c.G, c.B, 0xff})
+		if i, ok := g.colormap[rgb]; ok {
+			g.mem.Byte(1)
+			g.mem.Byte(byte(i))
+			g.mem.Byte(c.A)
+		} else {
+			rgb.A = c.A
+			g.colors = append(g.colors, rgb)
+
+			g.mem.Byte(0)
+			g.mem.Color(rgb)
+		}
+	}
+
+	return nil
+}
+
+// cmds_bbox returns the bounding box of the path cmds.
+func cmds_bbox(cmds []PathCmd) [2]Point {
+	inf := math.Inf(1)
+	b := [2]Point{{inf, inf}, {-inf, -inf}}
+	add := func(p Point) {
+		b[0].X = math.Min(b[0].X, p.X)
+		b[0].Y = math.Min(b[0].Y, p.Y)
+		b[1].X = math.Max(b[1].X, p.X)
+		b[1].Y = math.Max(b[1].Y, p.Y)
+	}
+
+	var cur Point
+	for _, c := range cmds {
+		switch c.Cmd {
+		case 'M', 'L':
+			for _, p := range c.Pt {
+				add(p)
+			}
+
+		case 'C':
+			for i := 0; i+2 < len(c.Pt); i += 3 {
+				p1, p2, p3 := c.Pt[i], c.Pt[i+1], c.Pt[i+2]
+				for _, t := range cubicExtrema(cur, p1, p2, p3) {
+					add(cubicAt(cur, p1, p2, p3, t))
+				}
+				add(p3)
+				cur = p3
+			}
+			continue
+
+		case 'Q':
+			for i := 0; i+1 < len(c.Pt); i += 2 {
+				p1, p2 := c.Pt[i], c.Pt[i+1]
+				// quadratic as cubic
+				c1 := Point{cur.X + 2*(p1.X-cur.X)/3, cur.Y + 2*(p1.Y-cur.Y)/3}
+				c2 := Point{p2.X + 2*(p1.X-p2.X)/3, p2.Y + 2*(p1.Y-p2.Y)/3}
+				for _, t := range cubicExtrema(cur, c1, c2, p2) {
+					add(cubicAt(cur, c1, c2, p2, t))
+				}
+				add(p2)
+				cur = p2
+			}
+			continue
+		}
+
+		if n := len(c.Pt); n != 0 {
+			cur = c.Pt[n-1]
+		}
+	}
+
+	return b
+}
+
+func cubicAt(p0, p1, p2, p3 Point, t float64) Point {
+	u := 1 - t
+	a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+	return Point{
+		a*p0.X + b*p1.X + c*p2.X + d*p3.X,
+		a*p0.Y + b*p1.Y + c*p2.Y + d*p3.Y,
+	}
+}
+
+// cubicExtrema returns the parameters in (0, 1)
+// where the cubic curve has horizontal or vertical tangents.
+func cubicExtrema(p0, p1, p2, p3 Point) []float64 {
+	var ts []float64
+	axis := func(a, b, c, d float64) {
+		// derivative coefficients / 3
+		qa := -a + 3*b - 3*c + d
+		qb := 2 * (a - 2*b + c)
+		qc := b - a
+		if math.Abs(qa) < 1e-12 {
+			if qb != 0 {
+				ts = append(ts, -qc/qb)
+			}
+			return
+		}
+		disc := qb*qb - 4*qa*qc
+		if disc < 0 {
+			return
+		}
+		sq := math.Sqrt(disc)
+		ts = append(ts, (-qb+sq)/(2*qa), (-qb-sq)/(2*qa))
+	}
+	axis(p0.X, p1.X, p2.X, p3.X)
+	axis(p0.Y, p1.Y, p2.Y, p3.Y)
+
+	n := 0
+	for _, t := range ts {
+		if t > 0 && t < 1 {
+			ts[n] = t
+			n++
+		}
+	}
+	return ts[:n]
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestGradientFill(t *testing.T) {
+	const stops = `<stop offset="0" stop-color="#f00"/><stop offset="1" stop-color="#00f"/>`
+	const rect = `<rect x="2" y="4" width="8" height="4" fill="url(#a)"/>`
+
+	tests := []struct {
+		elem string
+		want string
+	}{
+		// objectBoundingBox units map to the bounding box
+		{`<linearGradient id="a">` + stops + `</linearGradient>` + rect,
+			"Linear 2,4 10,4 pad 0:#ff0000ff 255:#0000ffff"},
+		{`<linearGradient id="a" x1="25%" x2="0.75">` + stops + `</linearGradient>` + rect,
+			"Linear 4,4 8,4 pad 0:#ff0000ff 255:#0000ffff"},
+		{`<linearGradient id="a" gradientUnits="userSpaceOnUse" x1="1" x2="5">` + stops + `</linearGradient>` + rect,
+			"Linear 1,0 5,0 pad 0:#ff0000ff 255:#0000ffff"},
+		{`<linearGradient id="a" gradientUnits="userSpaceOnUse" x2="50%">` + stops + `</linearGradient>` + rect,
+			"Linear 0,0 8,0 pad 0:#ff0000ff 255:#0000ffff"},
+
+		// the gradient vector is mapped so that offsets
+		// remain perpendicular projections
+		{`<linearGradient id="a" x2="1" y2="1">` + stops + `</linearGradient>` + rect,
+			"Linear 2,4 5.2,10.4 pad 0:#ff0000ff 255:#0000ffff"},
+
+		// gradientTransform and the element transform
+		{`<linearGradient id="a" gradientUnits="userSpaceOnUse" x2="4" gradientTransform="rotate(90)">` +
+			stops + `</linearGradient>` + rect,
+			"Linear 0,0 0,4 pad 0:#ff0000ff 255:#0000ffff"},
+		{`<linearGradient id="a" gradientUnits="userSpaceOnUse" x2="4" gradientTransform="scale(2,1)">` +
+			stops + `</linearGradient><g transform="translate(1,2)">` + rect + `</g>`,
+			"Linear 1,2 9,2 pad 0:#ff0000ff 255:#0000ffff"},
+
+		// href chains inherit stops and attributes
+		{`<linearGradient id="c" spreadMethod="reflect" x2="2">` + stops + `</linearGradient>
+<linearGradient id="b" href="#c" gradientUnits="userSpaceOnUse" x1="1"/>
+<linearGradient id="a" xlink:href="#b" x2="3"/>` + rect,
+			"Linear 1,0 3,0 reflect 0:#ff0000ff 255:#0000ffff"},
+		{`<linearGradient id="b" spreadMethod="repeat"><stop offset="0.5" stop-color="#0f0"/>` +
+			`<stop offset="1" stop-color="#0f0" stop-opacity="0.5"/></linearGradient>
+<linearGradient id="a" href="#b">` + stops + `</linearGradient>` + rect,
+			"Linear 2,4 10,4 repeat 0:#ff0000ff 255:#0000ffff"},
+		{`<linearGradient id="b"><stop offset="0.5" stop-color="#0f0"/>` +
+			`<stop offset="1" stop-color="#0f0" stop-opacity="0.5"/></linearGradient>
+<radialGradient id="a" href="#b"/>` + rect,
+			"Radial 4,0 0,2 6,6 f 6,6 pad 128:#00ff00ff 255:#00ff0080"},
+
+		// radial gradients
+		{`<radialGradient id="a">` + stops + `</radialGradient>` + rect,
+			"Radial 4,0 0,2 6,6 f 6,6 pad 0:#ff0000ff 255:#0000ffff"},
+		{`<radialGradient id="a" gradientUnits="userSpaceOnUse" cx="8" cy="8" r="4" fx="6">` +
+			stops + `</radialGradient>` + rect,
+			"Radial 4,0 0,4 8,8 f 6,8 pad 0:#ff0000ff 255:#0000ffff"},
+		{`<radialGradient id="a" gradientUnits="userSpaceOnUse" cx="8" cy="8" r="4" fx="20">` +
+			stops + `</radialGradient>` + rect,
+			"Radial 4,0 0,4 8,8 f 11.996,8 pad 0:#ff0000ff 255:#0000ffff"},
+		{`<radialGradient id="a" gradientTransform="translate(0.5) scale(0.5)">` +
+			stops + `</radialGradient>` + rect,
+			"Radial 2,0 0,1 8,5 f 8,5 pad 0:#ff0000ff 255:#0000ffff"},
+
+		// degenerate gradients
+		{`<linearGradient id="a" x2="0">` + stops + `</linearGradient>` + rect,
+			"SetSolidFill #0000ffff"},
+		{`<linearGradient id="a"><stop stop-color="#0f0"/></linearGradient>` + rect,
+			"SetSolidFill #00ff00ff"},
+		{`<linearGradient id="a"/>` + rect,
+			"SetNoFill"},
+	}
+
+	for _, tt := range tests {
+		doc := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"` +
+			` width="16" height="16" viewBox="0 0 16 16">` + tt.elem + `</svg>`
+		prog := procTestSvg(t, doc, svgOpts{currentColor: -1})
+		if got := fmtFillOps(prog); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.elem, got, tt.want)
+		}
+	}
+}
+
+// fmtFillOps formats the fill ops of prog. Linear gradients
+// are shown with the points at offsets 0 and 1.
+func fmtFillOps(prog *iconpack.Program) string {
+	round := func(v float64) float64 {
+		return math.Round(v*1e4) / 1e4
+	}
+	spread := []string{"pad", "reflect", "repeat"}
+
+	var v []string
+	for _, op := range prog.Ops {
+		switch op.Code {
+		case iconpack.OpSolidFill:
+			c := op.Color
+			v = append(v, fmt.Sprintf("%v #%02x%02x%02x%02x", op.Code, c.R, c.G, c.B, c.A))
+		case iconpack.OpNoFill:
+			v = append(v, op.Code.String())
+		case iconpack.OpLinearGradient, iconpack.OpRadialGradient:
+			gr := op.Gradient
+			m := gr.Matrix
+			if op.Code == iconpack.OpLinearGradient {
+				v = append(v, fmt.Sprintf("Linear %v,%v %v,%v",
+					round(m[4]), round(m[5]), round(m[4]+m[0]), round(m[5]+m[1])))
+			} else {
+				v = append(v, fmt.Sprintf("Radial %v,%v %v,%v %v,%v f %v,%v",
+					round(m[0]), round(m[1]), round(m[2]), round(m[3]), round(m[4]), round(m[5]),
+					round(gr.Focal.X), round(gr.Focal.Y)))
+			}
+			v = append(v, spread[gr.Spread])
+			for _, s := range gr.Stops {
+				c := s.Color
+				v = append(v, fmt.Sprintf("%d:#%02x%02x%02x%02x",
+					int(s.Offset*255+0.5), c.R, c.G, c.B, c.A))
+			}
+		}
+	}
+	return strings.Join(v, " ")
+}
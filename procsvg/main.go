@@ -12,15 +12,32 @@ var cli struct {
 	verbose   bool
 	showColor bool
 	disasm    bool
+	stats     bool
 
 	inkscape string
 }
 
+var subcommands = map[string]func(args []string) error{
+	"render":  render_main,
+	"gallery": gallery_main,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if sub, ok := subcommands[os.Args[1]]; ok {
+			if err := sub(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	flag.BoolVar(&cli.rebuild, "r", false, "rebuild intermediate icons")
 	flag.BoolVar(&cli.verbose, "v", false, "verbose operation")
 	flag.BoolVar(&cli.showColor, "showcolor", false, "show icon colors")
 	flag.BoolVar(&cli.disasm, "disasm", false, "write disassembly")
+	flag.BoolVar(&cli.stats, "stats", false, "show path data size statistics")
 	flag.StringVar(&cli.inkscape, "inkscape", "", "inkscape path (default: $PROCSVG_INKSCAPE or $PATH)")
 	flag.Parse()
 
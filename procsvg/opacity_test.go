@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestOpacity(t *testing.T) {
+	tests := []struct {
+		elem string
+		want string
+	}{
+		{`<rect width="4" height="4" fill="#f00" fill-opacity="0.5"/>`,
+			"SetSolidFill #ff000080"},
+		{`<rect width="4" height="4" fill="#ff000080"/>`,
+			"SetSolidFill #ff000080"},
+		{`<rect width="4" height="4" fill="#ff000080" fill-opacity="0.5"/>`,
+			"SetSolidFill #ff000040"},
+		{`<path d="M0 0 H4" fill="none" stroke="#00f" stroke-opacity="0.25"/>`,
+			"SetNoFill SetSolidStroke #0000ff40"},
+		{`<g opacity="0.5"><rect width="4" height="4" fill="#f00"/></g>`,
+			"SetSolidFill #ff000080"},
+		{`<g opacity="0.5"><g opacity="0.5"><rect width="4" height="4" fill="#f00" fill-opacity="0.5"/></g></g>`,
+			"SetSolidFill #ff000020"},
+		{`<g opacity="0.5" fill="none" stroke="#00f"><path d="M0 0 H4" stroke-opacity="0.5"/></g>`,
+			"SetNoFill SetSolidStroke #0000ff40"},
+		{`<rect width="4" height="4" fill="#f00" opacity="0"/>`,
+			""},
+	}
+
+	for _, tt := range tests {
+		doc := `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">` +
+			tt.elem + `</svg>`
+		prog := procTestSvg(t, doc, svgOpts{currentColor: -1})
+		if got := fmtPaintOps(prog); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.elem, got, tt.want)
+		}
+	}
+}
+
+func TestAlphaPalette(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">
+<rect width="4" height="4" fill="#f00"/>
+<rect width="4" height="4" fill="#ff000080"/>
+<rect width="4" height="4" fill="#fa000080"/>
+<rect width="4" height="4" fill="#ff000070"/>
+</svg>`
+
+	opts := svgOpts{
+		palette:      []color.NRGBA{{0xff, 0, 0, 0xff}, {0xff, 0, 0, 0x80}},
+		colorMagnet:  10,
+		currentColor: -1,
+	}
+	prog := procTestSvg(t, doc, opts)
+	want := "SetSolidFill 0 SetSolidFill 1 SetSolidFill 1 SetSolidFill #ff000070"
+	if got := fmtPaintOps(prog); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	g := svgprog{palette: opts.palette, cmsquare: 10 * 10}
+	for _, tt := range []struct{ c, want color.NRGBA }{
+		{color.NRGBA{0xfa, 0, 0, 0xff}, color.NRGBA{0xff, 0, 0, 0xff}},
+		{color.NRGBA{0xff, 0, 0, 0x84}, color.NRGBA{0xff, 0, 0, 0x80}},
+		{color.NRGBA{0xff, 0, 0, 0xc0}, color.NRGBA{0xff, 0, 0, 0xc0}},
+	} {
+		if got := g.map_color(tt.c); got != tt.want {
+			t.Errorf("map_color(%v): got %v, want %v", tt.c, got, tt.want)
+		}
+	}
+}
+
+// fmtPaintOps formats the fill and stroke paint ops of prog.
+func fmtPaintOps(prog *iconpack.Program) string {
+	var v []string
+	for _, op := range prog.Ops {
+		switch op.Code {
+		case iconpack.OpSolidFill, iconpack.OpSolidStroke:
+			c := op.Color
+			v = append(v, fmt.Sprintf("%v #%02x%02x%02x%02x", op.Code, c.R, c.G, c.B, c.A))
+		case iconpack.OpPaletteFill, iconpack.OpPaletteStroke:
+			v = append(v, fmt.Sprintf("%v %d", op.Code, op.Index))
+		case iconpack.OpNoFill, iconpack.OpNoStroke:
+			v = append(v, op.Code.String())
+		}
+	}
+	return strings.Join(v, " ")
+}
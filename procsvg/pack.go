@@ -11,6 +11,8 @@ import (
 	"sort"
 	"strings"
 	"text/template"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
 )
 
 var byteOrder = binary.LittleEndian
@@ -21,13 +23,59 @@ func pack_project(project Project) error {
 		return err
 	}
 
+	if project.CurrentColor > len(project.Palette) || project.CurrentColor > 0xff {
+		return fmt.Errorf("CurrentColor %d outside palette", project.CurrentColor)
+	}
+
+	var clipIntersect bool
+	switch project.ClipPaths {
+	case ClipOps:
+	case ClipIntersect:
+		clipIntersect = true
+	default:
+		return fmt.Errorf("Unknown ClipPaths %q", project.ClipPaths)
+	}
+
+	switch project.InferViewBox {
+	case InferViewBoxSize, InferViewBoxBounds, InferError:
+	default:
+		return fmt.Errorf("Unknown InferViewBox %q", project.InferViewBox)
+	}
+	switch project.InferSize {
+	case InferSizeViewBox, InferError:
+	default:
+		return fmt.Errorf("Unknown InferSize %q", project.InferSize)
+	}
+	if project.PixelPrecision < 0 {
+		return fmt.Errorf("Invalid PixelPrecision %g", project.PixelPrecision)
+	}
+	if project.FitCurves < 0 {
+		return fmt.Errorf("Invalid FitCurves %g", project.FitCurves)
+	}
+	for name, tol := range project.IconFitCurves {
+		if !has_icon(icons, name) {
+			return fmt.Errorf("Unknown icon %q in IconFitCurves", name)
+		}
+		if tol < 0 {
+			return fmt.Errorf("Invalid IconFitCurves %g for %q", tol, name)
+		}
+	}
+
 	// Collect SVG colors
 	colorStats := make(map[color.NRGBA]int)
 	collectOpts := svgOpts{
-		eps:         project.Epsilon,
-		palette:     project_src_colors(project),
-		colorMagnet: project.ColorMagnet,
-		colorCount:  colorStats,
+		eps:          project.Epsilon,
+		pixelPrec:    project.PixelPrecision,
+		scaleViewBox: project.ScaleViewBox,
+		palette:      project_src_colors(project),
+		colorMagnet:  project.ColorMagnet,
+		currentColor: project.CurrentColor,
+		colorCount:   colorStats,
+
+		clipIntersect: clipIntersect,
+		keepArcs:      project.KeepArcs,
+		inferViewBox:  project.InferViewBox,
+		inferSize:     project.InferSize,
 	}
 	for _, icon := range icons {
 		for _, fn := range icon.path {
@@ -47,28 +95,53 @@ func pack_project(project Project) error {
 	}
 
 	convertOpts := svgOpts{
-		eps:         project.Epsilon,
-		palette:     pal0,
-		colorMagnet: project.ColorMagnet,
+		eps:          project.Epsilon,
+		pixelPrec:    project.PixelPrecision,
+		scaleViewBox: project.ScaleViewBox,
+		palette:      pal0,
+		colorMagnet:  project.ColorMagnet,
+		currentColor: project.CurrentColor,
+
+		clipIntersect: clipIntersect,
+		keepArcs:      project.KeepArcs,
+		inferViewBox:  project.InferViewBox,
+		inferSize:     project.InferSize,
+		reportIssues:  true,
 	}
 	var pev []PackElem
 	for _, icon := range icons {
 		pe := PackElem{Name: icon.name}
+		opts := convertOpts
+		opts.fitCurves = project.FitCurves
+		if tol, ok := project.IconFitCurves[icon.name]; ok {
+			opts.fitCurves = tol
+		}
 		for _, fn := range icon.path {
 			if cli.verbose {
 				fmt.Fprintf(os.Stderr, "Packing %s\n", fn)
 			}
-			x, err := ProcSvg(fn, convertOpts)
+			x, err := ProcSvg(fn, opts)
 			if err != nil {
 				return fmt.Errorf("error converting %s: %w", fn, err)
 			}
+			if cli.stats && opts.fitCurves != 0 {
+				// Convert again for the size without fitted curves.
+				o := opts
+				o.fitCurves, o.reportIssues = 0, false
+				y, err := ProcSvg(fn, o)
+				if err != nil {
+					return fmt.Errorf("error converting %s: %w", fn, err)
+				}
+				x.Unfitted = len(y.Data)
+			}
 			pe.Image = append(pe.Image, x)
 		}
 		pev = append(pev, pe)
 	}
 
 	k := IconPack{
-		palette: vpal,
+		palette:      vpal,
+		currentColor: project.CurrentColor,
 	}
 	for _, pe := range pev {
 		k.Add(pe)
@@ -78,6 +151,10 @@ func pack_project(project Project) error {
 		return err
 	}
 
+	if cli.stats {
+		print_path_stats(project.Target, pev)
+	}
+
 	for _, gs := range project.GenerateSource {
 		if err := do_gen_src(gs, k); err != nil {
 			return err
@@ -87,15 +164,28 @@ func pack_project(project Project) error {
 	return nil
 }
 
-func project_src_colors(project Project) []color.NRGBA {
+// project_palette returns the default palette colors
+// including the current color entry.
+func project_palette(project Project) []color.NRGBA {
 	var p []color.NRGBA
+	for _, c := range project.Palette {
+		p = append(p, color.NRGBA(c))
+	}
+	if project.CurrentColor == len(p) {
+		p = append(p, color.NRGBA{0, 0, 0, 0xff})
+	}
+	return p
+}
+
+func project_src_colors(project Project) []color.NRGBA {
+	p := project_palette(project)
 	pm := make(map[color.NRGBA]struct{})
 
 	// Record palette colors.
-	for _, c0 := range project.Palette {
-		c := color.NRGBA(c0)
-		p = append(p, c)
-		pm[c] = struct{}{}
+	for i, c := range p {
+		if i != project.CurrentColor {
+			pm[c] = struct{}{}
+		}
 	}
 
 	// Record color transform src colors.
@@ -146,16 +236,21 @@ func do_pack_disasm(project Project, k IconPack,
 		if len(vcol) != 0 {
 			fmt.Fprintln(fa, "# non-palette image colors:")
 			for _, c := range vcol {
-				fmt.Fprintf(fa, "# %02x%02x%02x\n", c.R, c.G, c.B)
+				fmt.Fprintf(fa, "# %02x%02x%02x%02x\n", c.R, c.G, c.B, c.A)
 			}
 			fmt.Fprintln(fa)
 		}
 
 		pr, pw := io.Pipe()
+		done := make(chan struct{})
 		go func() {
 			DumpPack(pr, fa)
+			close(done)
+		}()
+		defer func() {
+			pw.Close()
+			<-done
 		}()
-		defer pw.Close()
 
 		w = io.MultiWriter(f, pw)
 	} else {
@@ -166,6 +261,49 @@ func do_pack_disasm(project Project, k IconPack,
 	return err
 }
 
+// print_path_stats prints the path data sizes of a pack
+// and the savings of relative coordinates.
+func print_path_stats(target string, pev []PackElem) {
+	var st PathStats
+	size, nimage := 0, 0
+	for _, pe := range pev {
+		for _, im := range pe.Image {
+			st.Add(im.Stats)
+			size += len(im.Data)
+			nimage++
+		}
+	}
+
+	saved := 0.0
+	if st.AbsBytes != 0 {
+		saved = 100 * float64(st.AbsBytes-st.Bytes) / float64(st.AbsBytes)
+	}
+	fmt.Printf("%s: %d images, %d bytes of image data\n", target, nimage, size)
+	fmt.Printf("  path data %d bytes, %d with absolute coordinates only, %.1f%% saved\n",
+		st.Bytes, st.AbsBytes, saved)
+	fmt.Printf("  segments: %d absolute, %d relative, %d horizontal or vertical\n",
+		st.Abs, st.Rel, st.HV)
+
+	header := false
+	for _, pe := range pev {
+		size, unfitted := 0, 0
+		for _, im := range pe.Image {
+			if im.Unfitted != 0 {
+				size += len(im.Data)
+				unfitted += im.Unfitted
+			}
+		}
+		if unfitted != 0 {
+			if !header {
+				fmt.Println("  fitted curves:")
+				header = true
+			}
+			fmt.Printf("    %s: %d bytes, %d without fitted curves, %d bytes saved\n",
+				pe.Name, size, unfitted, unfitted-size)
+		}
+	}
+}
+
 func do_gen_src(gs GenSrc, k IconPack) error {
 	tpl, err := template.New("src").Parse(gs.Template)
 	if err != nil {
@@ -258,6 +396,15 @@ type iconFile struct {
 	path []string
 }
 
+func has_icon(icons []iconFile, name string) bool {
+	for _, ic := range icons {
+		if ic.name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func findIcons(project Project) ([]iconFile, error) {
 	m := make(map[string][]string)
 	for _, sub := range project.SizeDir {
@@ -296,12 +443,11 @@ func findIcons(project Project) ([]iconFile, error) {
 
 func getpalv(project Project, colorStats map[color.NRGBA]int) [][]color.NRGBA {
 
-	var p0 []color.NRGBA
+	p0 := project_palette(project)
 	defaultColors := make(map[color.NRGBA]struct{})
-	if len(project.Palette) != 0 {
-		for _, c := range project.Palette {
-			p0 = append(p0, color.NRGBA(c))
-			defaultColors[color.NRGBA(c)] = struct{}{}
+	for i, c := range p0 {
+		if i != project.CurrentColor {
+			defaultColors[c] = struct{}{}
 		}
 	}
 
@@ -342,7 +488,10 @@ func lessColor(ci, cj color.NRGBA) bool {
 	if ci.G != cj.G {
 		return ci.G < cj.G
 	}
-	return ci.B < cj.B
+	if ci.B != cj.B {
+		return ci.B < cj.B
+	}
+	return ci.A < cj.A
 }
 
 func applyTransforms(project Project, p0 []color.NRGBA) [][]color.NRGBA {
@@ -369,8 +518,9 @@ func applyTransforms(project Project, p0 []color.NRGBA) [][]color.NRGBA {
 }
 
 type IconPack struct {
-	palette [][]color.NRGBA
-	elem    []PackElem
+	palette      [][]color.NRGBA
+	currentColor int // palette index of currentColor, or -1
+	elem         []PackElem
 }
 
 type PackElem struct {
@@ -427,14 +577,10 @@ func (k *IconPack) Add(pe PackElem) {
 	k.elem = append(k.elem, pe)
 }
 
-const PackMagic = "icpk"
-const PaletteMagic = "PALT"
-const IconMagic = "ICON"
-
 func (k *IconPack) WriteTo(w0 io.Writer) (n int64, err error) {
 	w := &countWriter{w: w0}
 
-	fmt.Fprint(w, PackMagic)
+	fmt.Fprint(w, iconpack.PackMagic)
 	if _, err := writeUint32(w, uint32(len(k.elem))); err != nil {
 		return w.n, err
 	}
@@ -445,8 +591,18 @@ func (k *IconPack) WriteTo(w0 io.Writer) (n int64, err error) {
 		}
 	}
 
+	if k.currentColor >= 0 {
+		fmt.Fprint(w, iconpack.CurrentColorMagic)
+		if _, err := writeUint32(w, 1); err != nil {
+			return w.n, err
+		}
+		if _, err := w.Write([]byte{byte(k.currentColor)}); err != nil {
+			return w.n, err
+		}
+	}
+
 	for _, e := range k.elem {
-		fmt.Fprint(w, IconMagic)
+		fmt.Fprint(w, iconpack.IconMagic)
 		err := e.writeTo(w)
 		if err != nil {
 			return w.n, err
@@ -457,7 +613,7 @@ func (k *IconPack) WriteTo(w0 io.Writer) (n int64, err error) {
 }
 
 func writePalette(w io.Writer, idx int, pal []color.NRGBA) error {
-	fmt.Fprint(w, PaletteMagic)
+	fmt.Fprint(w, iconpack.PaletteMagic)
 
 	buf := new(bytes.Buffer)
 	buf.WriteByte(byte(idx))
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -25,7 +26,11 @@ type Point struct {
 }
 
 type PathCmd struct {
-	// path command, one of 'M', 'L', 'C' or 'Q'
+	// path command, one of 'M', 'L', 'C', 'Q', 'A' or 'Z'.
+	// Commands after 'Z' always begin with 'M'.
+	// Elliptical arcs have three points per segment: the radii,
+	// the x-axis rotation in degrees with the flags as Y
+	// (1 for large-arc and 2 for sweep), and the end point.
 	Cmd byte
 
 	// command coords (always absolute)
@@ -43,6 +48,26 @@ func (c PathCmd) String() string {
 	return sb.String()
 }
 
+// strip_close returns cmds without 'Z' commands.
+func strip_close(cmds []PathCmd) []PathCmd {
+	var r []PathCmd
+	for i, c := range cmds {
+		if c.Cmd == 'Z' {
+			if r == nil {
+				r = append(make([]PathCmd, 0, len(cmds)), cmds[:i]...)
+			}
+			continue
+		}
+		if r != nil {
+			r = append(r, c)
+		}
+	}
+	if r == nil {
+		return cmds
+	}
+	return r
+}
+
 type pathdecoder struct {
 	data string
 	pos  int
@@ -161,44 +186,44 @@ func (d *pathdecoder) step() {
 	case 'A':
 		startp := d.pos
 		v := d.numbers()
-		if len(v) == 0 && len(v)%7 != 0 {
+		if len(v) == 0 || len(v)%7 != 0 {
 			d.seterrf("Invalid arc at %d", startp)
 			return
 		}
 
 		for i := 0; i < len(v); i += 7 {
 			w := v[i : i+7]
-			r := Point{w[0], w[1]}
-			angle := w[2]
-			var largeArc, sweep bool
-			if w[3] != 0 {
-				largeArc = true
+			r := Point{math.Abs(w[0]), math.Abs(w[1])}
+			p := rel(Point{w[5], w[6]})
+			switch {
+			case p == d.last:
+				// omitted, but smooth curves that follow
+				// reflect no control point
+				d.lastc, d.lastq = d.last, d.last
+			case r.X == 0 || r.Y == 0:
+				d.addcmd('L', p)
+			default:
+				d.addcmd('A', arc_pts(r, w[2], w[3] != 0, w[4] != 0, p)...)
 			}
-			if w[4] != 0 {
-				sweep = true
-			}
-			c := rel(Point{w[5], w[6]})
-			pts := arcToBezier(d.last, c, r, angle, largeArc, sweep)
-			d.addcmd('C', pts...)
-			d.lastc = d.last
 		}
 
 	case 'Z':
+		if n := len(d.cmd); n != 0 && d.cmd[n-1].Cmd != 'Z' {
+			d.cmd = append(d.cmd, PathCmd{Cmd: 'Z'})
+		}
 		d.last = d.first
 		d.lastc = d.last
 		d.lastq = d.last
 	}
 }
 
-func (d *pathdecoder) ellipticArc(rx, ry, angle float64, largeArc, sweep bool, p2 Point) {
-	p1 := d.last
-	if p1 == p2 {
-		return
-	}
-}
-
 func (d *pathdecoder) addcmd(cmd byte, v ...Point) {
 	previ := len(d.cmd) - 1
+	if cmd != 'M' && previ >= 0 && d.cmd[previ].Cmd == 'Z' {
+		// next subpath starts at the start of the closed one
+		d.cmd = append(d.cmd, PathCmd{Cmd: 'M', Pt: []Point{d.first}})
+		previ++
+	}
 	if cmd != 'M' && previ >= 0 && d.cmd[previ].Cmd == cmd {
 		// append coords to last command
 		prevc := &d.cmd[previ]
@@ -272,7 +297,7 @@ func (d *pathdecoder) quadraticBézier(startp int,
 }
 
 func (d *pathdecoder) skipspace() {
-	for d.pos < len(d.data) && d.data[d.pos] == ' ' {
+	for d.pos < len(d.data) && strings.IndexByte(" \t\n\r\f", d.data[d.pos]) >= 0 {
 		d.pos++
 	}
 }
@@ -336,11 +361,7 @@ func (d *pathdecoder) number() float64 {
 	d.skipspace()
 
 	s := d.pos
-	e := s
-
-	for e < len(d.data) && isnumbyte(d.data[e]) {
-		e++
-	}
+	e := d.numend()
 
 	if s == e {
 		d.seterrf("Expected number at position %d", s)
@@ -384,6 +405,35 @@ func (d *pathdecoder) seterr(err error) {
 	}
 }
 
+// numend returns the end of the number at the current position.
+// A sign or a second decimal point starts the next number.
+func (d *pathdecoder) numend() int {
+	e := d.pos
+	sign := func() {
+		if e < len(d.data) && (d.data[e] == '-' || d.data[e] == '+') {
+			e++
+		}
+	}
+	digits := func() {
+		for e < len(d.data) && '0' <= d.data[e] && d.data[e] <= '9' {
+			e++
+		}
+	}
+
+	sign()
+	digits()
+	if e < len(d.data) && d.data[e] == '.' {
+		e++
+		digits()
+	}
+	if e < len(d.data) && (d.data[e] == 'e' || d.data[e] == 'E') {
+		e++
+		sign()
+		digits()
+	}
+	return e
+}
+
 func isnumbyte(c byte) bool {
-	return c == '.' || c == '-' || ('0' <= c && c <= '9') || c == 'e' || c == 'E'
+	return c == '.' || c == '-' || c == '+' || ('0' <= c && c <= '9')
 }
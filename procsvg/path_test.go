@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestPathDCmds(t *testing.T) {
+	tests := []struct {
+		d    string
+		want string
+	}{
+		{"M0 0 L10 0 10 10", "{M 0,0} {L 10,0 10,10}"},
+		{"M0 0 L10 0 10 10 Z", "{M 0,0} {L 10,0 10,10} {Z}"},
+		{"M0 0 L10 0 10 10 Z L5 5", "{M 0,0} {L 10,0 10,10} {Z} {M 0,0} {L 5,5}"},
+		{"m1 1 h2 z m3 3 v1 z z", "{M 1,1} {L 3,1} {Z} {M 4,4} {L 4,5} {Z}"},
+		{"M1 1 Z", "{M 1,1} {Z}"},
+		{"M0 0 A5 5 0 0 1 10 0 a5,4 30 1 0 -10 0", "{M 0,0} {A 5,5 0,2 10,0 5,4 30,1 0,0}"},
+		{"M0 0 a0 5 0 1 0 10 0 A1 1 0 0 0 10 0", "{M 0,0} {L 10,0}"},
+		{"M0 0 C1 1 2 1 3 0 A1 1 0 0 1 3 0 S5 1 6 0", "{M 0,0} {C 1,1 2,1 3,0 3,0 5,1 6,0}"},
+		{"M0 0 Q1 1 2 0 A1 1 0 0 1 2 0 T4 0", "{M 0,0} {Q 1,1 2,0 2,0 4,0}"},
+		{"M10-5L3-2.5.5.5\n\tl+1e1-1E-1", "{M 10,-5} {L 3,-2.5 0.5,0.5 10.5,0.4}"},
+	}
+
+	for _, tt := range tests {
+		cmds, err := PathDCmds(tt.d)
+		if err != nil {
+			t.Errorf("%q: %v", tt.d, err)
+			continue
+		}
+		if got := fmtCmds(cmds); got != tt.want {
+			t.Errorf("%q:\ngot  %s\nwant %s", tt.d, got, tt.want)
+		}
+	}
+}
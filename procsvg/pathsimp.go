@@ -0,0 +1,301 @@
+package main
+
+import "math"
+
+// pathSeg is a segment of a subpath. Its points begin with
+// the start point of the segment followed by the points
+// of the path command, three for elliptical arcs.
+type pathSeg struct {
+	cmd byte
+	pt  []Point
+}
+
+func (s pathSeg) end() Point {
+	return s.pt[len(s.pt)-1]
+}
+
+// simplify_path returns cmds simplified within tolerance tol.
+// It removes zero-length segments, merges cubic curves joining
+// smoothly, demotes cubic curves that are lines or quadratic
+// curves, and drops line points collinear with their neighbors.
+// Each of the steps uses a third of tol.
+func simplify_path(cmds []PathCmd, tol float64) []PathCmd {
+	if !(tol > 0) {
+		return cmds
+	}
+	e := tol / 3
+	return map_segments(cmds, func(segs []pathSeg) []pathSeg {
+		if v := drop_zero_length(segs, e); len(v) != 0 {
+			segs = v
+		}
+		segs = merge_cubics(segs, e)
+		for i := range segs {
+			segs[i] = demote_curve(segs[i], e)
+		}
+		return drop_collinear(segs, e)
+	})
+}
+
+// map_segments returns cmds with the segments of each subpath
+// replaced by the result of f. Paths not starting with a move
+// are returned unchanged.
+func map_segments(cmds []PathCmd, f func(segs []pathSeg) []pathSeg) []PathCmd {
+	if len(cmds) == 0 || cmds[0].Cmd != 'M' {
+		return cmds
+	}
+
+	var r []PathCmd
+	var start Point
+	var segs []pathSeg
+	flush := func(closed bool) {
+		r = append(r, PathCmd{'M', []Point{start}})
+		for _, s := range f(segs) {
+			pt := s.pt[1:]
+			if last := &r[len(r)-1]; last.Cmd == s.cmd {
+				last.Pt = append(last.Pt, pt...)
+			} else {
+				r = append(r, PathCmd{s.cmd, append([]Point(nil), pt...)})
+			}
+		}
+		if closed {
+			r = append(r, PathCmd{'Z', nil})
+		}
+		segs = nil
+	}
+
+	cur := start
+	inPath := false
+	for _, c := range cmds {
+		k := 1
+		switch c.Cmd {
+		case 'M':
+			if inPath {
+				flush(false)
+			}
+			start, cur = c.Pt[0], c.Pt[0]
+			inPath = true
+			continue
+		case 'Z':
+			if inPath {
+				flush(true)
+			}
+			cur, inPath = start, false
+			continue
+		case 'Q':
+			k = 2
+		case 'C', 'A':
+			k = 3
+		}
+		for i := 0; i+k <= len(c.Pt); i += k {
+			s := pathSeg{c.Cmd, append([]Point{cur}, c.Pt[i:i+k]...)}
+			segs = append(segs, s)
+			cur = s.end()
+		}
+	}
+	if inPath {
+		flush(false)
+	}
+	return r
+}
+
+// drop_zero_length removes segments of segs ending within tol
+// of the current point and having their control points or
+// radii within tol, too. Segments following removed ones
+// start at the current point.
+func drop_zero_length(segs []pathSeg, tol float64) []pathSeg {
+	var r []pathSeg
+	if len(segs) == 0 {
+		return nil
+	}
+	cur := segs[0].pt[0]
+	for _, s := range segs {
+		s.pt = append([]Point(nil), s.pt...)
+		s.pt[0] = cur
+		if s.cmd == 'A' {
+			if dist(cur, s.end()) <= tol && 2*math.Max(math.Abs(s.pt[1].X), math.Abs(s.pt[1].Y)) <= tol {
+				continue
+			}
+		} else if is_zero_length(s.pt, tol) {
+			continue
+		}
+		r = append(r, s)
+		cur = s.end()
+	}
+	return r
+}
+
+func is_zero_length(pt []Point, tol float64) bool {
+	for _, p := range pt[1:] {
+		if dist(pt[0], p) > tol {
+			return false
+		}
+	}
+	return true
+}
+
+// merge_cubics replaces runs of cubic and quadratic curves
+// in segs joining smoothly with single cubic curves within tol.
+func merge_cubics(segs []pathSeg, tol float64) []pathSeg {
+	var r []pathSeg
+	for i := 0; i < len(segs); {
+		s := segs[i]
+		j := i + 1
+		if is_curve(s) {
+			run := []bezier{cubic(s)}
+			for ; j < len(segs) && is_curve(segs[j]); j++ {
+				m, ok := merge_run(append(run, cubic(segs[j])), tol)
+				if !ok {
+					break
+				}
+				run = append(run, cubic(segs[j]))
+				s = pathSeg{'C', m}
+			}
+		}
+		r = append(r, s)
+		i = j
+	}
+	return r
+}
+
+func is_curve(s pathSeg) bool {
+	return s.cmd == 'C' || s.cmd == 'Q'
+}
+
+// cubic returns the cubic curve of the curve segment s.
+func cubic(s pathSeg) bezier {
+	if s.cmd == 'C' {
+		return bezier(s.pt)
+	}
+	p0, c, p1 := s.pt[0], s.pt[1], s.pt[2]
+	return bezier{p0, lerp(p0, c, 2.0/3), lerp(p1, c, 2.0/3), p1}
+}
+
+// merge_run returns the cubic curve approximating the cubic
+// curves in run within tol, or false if there is none.
+// The curves are assumed to be pieces of the merged curve
+// split at parameters keeping their derivatives continuous.
+func merge_run(run []bezier, tol float64) (bezier, bool) {
+	// Parameter lengths of the pieces relative to the first.
+	d := make([]float64, len(run))
+	d[0] = 1
+	for i := 1; i < len(run); i++ {
+		a, b := run[i-1], run[i]
+		ax, ay := a[3].X-a[2].X, a[3].Y-a[2].Y
+		bx, by := b[1].X-b[0].X, b[1].Y-b[0].Y
+		la, lb := math.Hypot(ax, ay), math.Hypot(bx, by)
+		if la == 0 || lb == 0 || ax*bx+ay*by <= 0 {
+			return nil, false
+		}
+		d[i] = d[i-1] * lb / la
+	}
+	total := 0.0
+	for _, x := range d {
+		total += x
+	}
+
+	first, last := run[0], run[len(run)-1]
+	p0, p3 := first[0], last[3]
+	f0, f1 := total/d[0], total/d[len(d)-1]
+	m := bezier{
+		p0,
+		{p0.X + (first[1].X-p0.X)*f0, p0.Y + (first[1].Y-p0.Y)*f0},
+		{p3.X + (last[2].X-p3.X)*f1, p3.Y + (last[2].Y-p3.Y)*f1},
+		p3,
+	}
+
+	// Compare the pieces of m with the curves of the run.
+	t0 := 0.0
+	for i, b := range run {
+		t1 := t0 + d[i]/total
+		if i == len(run)-1 {
+			t1 = 1
+		}
+		l, _ := m.split(t1)
+		_, piece := l.split(t0 / t1)
+		for k := range piece {
+			if dist(piece[k], b[k]) > tol {
+				return nil, false
+			}
+		}
+		t0 = t1
+	}
+	return m, true
+}
+
+// demote_curve returns the curve segment s as a line if its
+// control points are within tol of the line, or the cubic
+// curve s as a quadratic curve if it is within tol of it.
+func demote_curve(s pathSeg, tol float64) pathSeg {
+	if !is_curve(s) {
+		return s
+	}
+	p0, p1 := s.pt[0], s.end()
+	line := true
+	for _, c := range s.pt[1 : len(s.pt)-1] {
+		if segment_dist(p0, p1, c) > tol {
+			line = false
+		}
+	}
+	if line {
+		return pathSeg{'L', []Point{p0, p1}}
+	}
+	if s.cmd == 'C' {
+		// The difference of s and the degree elevated quadratic
+		// curve is 3t(1-t)(1-2t)·d with |d| = |p3-3p2+3p1-p0|/6.
+		c1, c2 := s.pt[1], s.pt[2]
+		dx := p1.X - 3*c2.X + 3*c1.X - p0.X
+		dy := p1.Y - 3*c2.Y + 3*c1.Y - p0.Y
+		if math.Sqrt(3)/36*math.Hypot(dx, dy) <= tol {
+			q := Point{
+				(3*(c1.X+c2.X) - p0.X - p1.X) / 4,
+				(3*(c1.Y+c2.Y) - p0.Y - p1.Y) / 4,
+			}
+			return pathSeg{'Q', []Point{p0, q, p1}}
+		}
+	}
+	return s
+}
+
+// drop_collinear removes line points within tol of
+// the line between the points kept before and after them.
+func drop_collinear(segs []pathSeg, tol float64) []pathSeg {
+	var r []pathSeg
+	for i := 0; i < len(segs); {
+		s := segs[i]
+		if s.cmd != 'L' {
+			r = append(r, s)
+			i++
+			continue
+		}
+
+		// Extend the line from the start of s over the points
+		// of the segments i..j while the dropped points fit.
+		a := s.pt[0]
+		j := i
+		for k := i + 1; k < len(segs) && segs[k].cmd == 'L'; k++ {
+			e := segs[k].end()
+			fit := true
+			for _, x := range segs[i:k] {
+				if segment_dist(a, e, x.end()) > tol {
+					fit = false
+					break
+				}
+			}
+			if !fit {
+				break
+			}
+			j = k
+		}
+		r = append(r, pathSeg{'L', []Point{a, segs[j].end()}})
+		i = j + 1
+	}
+	return r
+}
+
+func dist(a, b Point) float64 {
+	return math.Hypot(b.X-a.X, b.Y-a.Y)
+}
+
+func lerp(a, b Point, t float64) Point {
+	return Point{a.X + (b.X-a.X)*t, a.Y + (b.Y-a.Y)*t}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestSimplifyPath(t *testing.T) {
+	tests := []struct {
+		d    string
+		want string
+	}{
+		{"M0 0 L5 0 10 0 10 10 Z", "{M 0,0} {L 10,0 10,10} {Z}"},
+		{"M0 0 L5 0.001 10 0 L5 0", "{M 0,0} {L 10,0 5,0}"},
+		{"M0 0 L0.001 0 L10 0 M1 1 L1 1", "{M 0,0} {L 10,0} {M 1,1} {L 1,1}"},
+		{"M0 0 C3 0.001 6 0 10 0", "{M 0,0} {L 10,0}"},
+		{"M0 0 C3.33333 6.66667 6.66667 6.66667 10 0", "{M 0,0} {Q 5,10 10,0}"},
+		{"M0 0 Q5 10 10 0 Q15 -10 20 0", "{M 0,0} {Q 5,10 10,0 15,-10 20,0}"},
+		{"M0 0 C0 5 2.5 7.5 5 7.5 7.5 7.5 10 5 10 0", "{M 0,0} {C 0,10 10,10 10,0}"},
+		{"M0 0 C0 5 5 5 5 0 C5 5 10 5 10 0", "{M 0,0} {C 0,5 5,5 5,0 5,5 10,5 10,0}"},
+		{"M0 0 A5 5 0 0 1 10 0 L10 5 10 10", "{M 0,0} {A 5,5 0,2 10,0} {L 10,10}"},
+	}
+
+	for _, tt := range tests {
+		cmds, err := PathDCmds(tt.d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmtCmds(simplify_path(cmds, 0.01)); got != tt.want {
+			t.Errorf("%q:\ngot  %s\nwant %s", tt.d, got, tt.want)
+		}
+	}
+
+	// Pieces of a cubic curve split at uneven parameters.
+	b := bezier{{0, 0}, {2, 12}, {14, 9}, {16, 1}}
+	l, r := b.split(0.7)
+	a, m := l.split(0.2 / 0.7)
+	var cmds []PathCmd
+	cmds = append(cmds, PathCmd{'M', a[:1]})
+	for _, x := range []bezier{a, m, r} {
+		cmds = append(cmds, PathCmd{'C', x[1:]})
+	}
+	if got, want := fmtCmds(simplify_path(cmds, 0.01)), "{M 0,0} {C 2,12 14,9 16,1}"; got != want {
+		t.Errorf("split curve:\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+)
+
+// Preprocessor simplifies source SVG files before conversion.
+type Preprocessor interface {
+	// Process writes the simplified version of SVG file src to dst.
+	Process(src, dst string) error
+
+	// Close releases resources used by the preprocessor.
+	Close() error
+}
+
+// Preprocessor names used in project files.
+const (
+	PreprocessInkscape = "inkscape"
+	PreprocessNative   = "native"
+	PreprocessCommand  = "command"
+)
+
+// NewPreprocessor returns the preprocessor selected by the project.
+func NewPreprocessor(project Project) (Preprocessor, error) {
+	switch project.Preprocessor {
+	case "", PreprocessInkscape:
+		return &inkscapePreprocessor{
+			is:          NewInkscapeShell(),
+			keepStrokes: project.KeepStrokes,
+		}, nil
+
+	case PreprocessNative:
+		return nativePreprocessor{}, nil
+
+	case PreprocessCommand:
+		return newCommandPreprocessor(project.PreprocessCommand)
+	}
+
+	return nil, fmt.Errorf("Unknown preprocessor %q", project.Preprocessor)
+}
+
+// inkscapePreprocessor converts objects and strokes to paths using Inkscape.
+type inkscapePreprocessor struct {
+	is *InkscapeShell
+
+	keepStrokes bool
+}
+
+func (p *inkscapePreprocessor) Process(src, dst string) error {
+	is := p.is
+	is.Cmdf("file-open:%s", filepath.ToSlash(src))
+	is.Cmd("select-all")
+	is.Cmd("object-to-path")
+	if !p.keepStrokes {
+		is.Cmd("object-stroke-to-path")
+	}
+	is.Cmd("export-overwrite:true")
+	is.Cmd("export-plain-svg:true")
+	is.Cmdf("export-filename:%s", filepath.ToSlash(dst))
+	is.Cmd("export-do")
+	is.Cmd("file-close")
+
+	return is.Err()
+}
+
+func (p *inkscapePreprocessor) Close() error {
+	return p.is.Close()
+}
+
+// nativePreprocessor copies source files unchanged,
+// leaving shapes to be converted by procsvg itself.
+type nativePreprocessor struct{}
+
+func (nativePreprocessor) Process(src, dst string) error {
+	return copy_file(src, dst)
+}
+
+func (nativePreprocessor) Close() error { return nil }
+
+// commandPreprocessor runs an external command for each file.
+type commandPreprocessor struct {
+	args []*template.Template
+}
+
+// PreprocessFile is the template data used by Project.PreprocessCommand.
+type PreprocessFile struct {
+	Src string // source file path
+	Dst string // target file path
+}
+
+func newCommandPreprocessor(cmdline []string) (*commandPreprocessor, error) {
+	if len(cmdline) == 0 {
+		return nil, fmt.Errorf("Empty preprocess command")
+	}
+
+	p := new(commandPreprocessor)
+	for i, s := range cmdline {
+		t, err := template.New(fmt.Sprint("arg", i)).Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid preprocess command: %w", err)
+		}
+		p.args = append(p.args, t)
+	}
+	return p, nil
+}
+
+func (p *commandPreprocessor) Process(src, dst string) error {
+	data := PreprocessFile{
+		Src: filepath.ToSlash(src),
+		Dst: filepath.ToSlash(dst),
+	}
+
+	var args []string
+	for _, t := range p.args {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return err
+		}
+		args = append(args, buf.String())
+	}
+
+	c := exec.Command(args[0], args[1:]...)
+	c.Stderr = os.Stderr
+	if cli.verbose {
+		c.Stdout = os.Stdout
+	}
+
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("Error preprocessing %s: %w", src, err)
+	}
+	return nil
+}
+
+func (p *commandPreprocessor) Close() error { return nil }
+
+func copy_file(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -5,12 +5,20 @@ import (
 	"fmt"
 	"image/color"
 	"math"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
 )
 
 type ProgImage struct {
 	Width  int
 	Height int
 	Data   []byte // Icon variant image
+
+	Stats PathStats // path data statistics of Data
+
+	// Unfitted is the size of Data without fitted curves,
+	// if it was measured.
+	Unfitted int
 }
 
 type ProgMem struct {
@@ -19,8 +27,32 @@ type ProgMem struct {
 	// coordinate precision
 	Precision float64
 
+	// Stats holds the sizes of path data written.
+	Stats PathStats
+
 	inPath bool
 	xform  Matrix
+
+	// start of the current subpath and the current point
+	// as decoded by renderers
+	start, cur Point
+}
+
+// PathStats holds path data statistics of programs.
+type PathStats struct {
+	Bytes    int // size of path ops
+	AbsBytes int // size of path ops using only absolute coordinates
+
+	// Segments counts line and curve segments by encoding.
+	Abs, Rel, HV int
+}
+
+func (s *PathStats) Add(t PathStats) {
+	s.Bytes += t.Bytes
+	s.AbsBytes += t.AbsBytes
+	s.Abs += t.Abs
+	s.Rel += t.Rel
+	s.HV += t.HV
 }
 
 func NewProgMem(prec float64) *ProgMem {
@@ -63,10 +95,24 @@ func (m *ProgMem) BeginPath(xform Matrix) {
 }
 
 func (m *ProgMem) PathCmd(c PathCmd) error {
+	n0 := m.buf.Len()
+	abs, err := m.pathCmd(c)
+	n := m.buf.Len() - n0
+	m.Stats.Bytes += n
+	if abs == 0 {
+		abs = n
+	}
+	m.Stats.AbsBytes += abs
+	return err
+}
+
+// pathCmd writes c, and returns the size c would have
+// using only absolute coordinates, or 0 if it is the size written.
+func (m *ProgMem) pathCmd(c PathCmd) (int, error) {
 	switch c.Cmd {
 	case 'M':
 		if len(c.Pt) != 1 {
-			return fmt.Errorf("Move op with %d points", len(c.Pt))
+			return 0, fmt.Errorf("Move op with %d points", len(c.Pt))
 		}
 		if !m.inPath {
 			m.Byte(0x70)
@@ -74,59 +120,262 @@ func (m *ProgMem) PathCmd(c PathCmd) error {
 		} else {
 			m.Byte(0x71)
 		}
-		m.Pts(c.Pt)
-		return nil
+		m.start = m.point(c.Pt[0])
+		m.cur = m.start
+		return 0, nil
+
+	case 'Z':
+		if len(c.Pt) != 0 {
+			return 0, fmt.Errorf("Close op with %d points", len(c.Pt))
+		}
+		if !m.inPath {
+			return 0, fmt.Errorf("Close op outside path")
+		}
+		m.Byte(0x72)
+		m.cur = m.start
+		return 0, nil
 
 	case 'L':
 		if len(c.Pt) == 0 {
-			return fmt.Errorf("Empty line op")
+			return 0, fmt.Errorf("Empty line op")
 		}
-		return m.addOp(c.Cmd, 0x80, 0x20, 1, c.Pt)
+		return m.addOp(c.Cmd, c.Pt)
 
 	case 'C':
-		mul := 3
-		if n := len(c.Pt); n == 0 || n%mul != 0 {
-			return fmt.Errorf("Empty or invalid cubic Bézier op length %d", n)
+		if n := len(c.Pt); n == 0 || n%3 != 0 {
+			return 0, fmt.Errorf("Empty or invalid cubic Bézier op length %d", n)
 		}
-		return m.addOp(c.Cmd, 0xa0, 0x10, mul, c.Pt)
+		return m.addOp(c.Cmd, c.Pt)
 
 	case 'Q':
-		mul := 2
-		if n := len(c.Pt); n == 0 || n%mul != 0 {
-			return fmt.Errorf("Empty or invalid quadratic Bézier op length %d", n)
+		if n := len(c.Pt); n == 0 || n%2 != 0 {
+			return 0, fmt.Errorf("Empty or invalid quadratic Bézier op length %d", n)
+		}
+		return m.addOp(c.Cmd, c.Pt)
+
+	case 'A':
+		if n := len(c.Pt); n == 0 || n%3 != 0 {
+			return 0, fmt.Errorf("Empty or invalid arc op length %d", n)
 		}
-		return m.addOp(c.Cmd, 0xb0, 0x10, mul, c.Pt)
+		m.arcOp(c.Pt)
+		return 0, nil
 	}
 
-	return fmt.Errorf("Unknown path cmd %q", c.Cmd)
+	return 0, fmt.Errorf("Unknown path cmd %q", c.Cmd)
 }
 
-func (m *ProgMem) addOp(cmd byte, baseop byte, maxrep, mod int, pts []Point) error {
-	n := len(pts)
-	if n == 0 {
-		return fmt.Errorf("Empty %c op", cmd)
+// segForm is the encoding of a line or curve segment.
+type segForm int
+
+const (
+	segAbs  segForm = iota // absolute coordinates
+	segRel                 // coordinates relative to the current point
+	segH                   // horizontal line to absolute x
+	segV                   // vertical line to absolute y
+	segRelH                // horizontal line by dx
+	segRelV                // vertical line by dy
+)
+
+// pathOps holds the base opcodes and maximum repeat counts
+// of line and curve ops by segment form.
+var pathOps = map[byte][]struct {
+	op     byte
+	maxrep int
+}{
+	'L': {{0x80, 0x20}, {0xd0, 0x10}, {0xf0, 1}, {0xf1, 1}, {0xf2, 1}, {0xf3, 1}},
+	'C': {{0xa0, 0x10}, {0xe0, 0x08}},
+	'Q': {{0xb0, 0x10}, {0xe8, 0x08}},
+}
+
+// segEnc is an encoded segment.
+type segEnc struct {
+	form segForm
+	data []byte
+	end  Point // end point as decoded
+}
+
+// addOp writes the line or curve segments of cmd.
+// The encoding of each segment is chosen to minimize
+// the size of the coordinates and op codes.
+func (m *ProgMem) addOp(cmd byte, pts []Point) (int, error) {
+	ops := pathOps[cmd]
+	mod := 1
+	switch cmd {
+	case 'C':
+		mod = 3
+	case 'Q':
+		mod = 2
 	}
-	if n%mod != 0 {
-		return fmt.Errorf("Invalid %c op, length %d must be mod %d", cmd, n, mod)
+
+	var pend bytes.Buffer
+	form, nrep := segAbs, 0
+	flush := func() {
+		if nrep != 0 {
+			m.Byte(ops[form].op + byte(nrep-1))
+			m.buf.Write(pend.Bytes())
+			pend.Reset()
+			nrep = 0
+		}
 	}
 
-	rng := mod * maxrep
-	for len(pts) > rng {
-		m.Byte(baseop + byte(maxrep-1))
-		m.Pts(pts[:rng])
-		pts = pts[rng:]
+	absSize, nseg := 0, 0
+	for i := 0; i < len(pts); i += mod {
+		seg := make([]Point, mod)
+		for j := range seg {
+			seg[j] = m.xform.Transform(pts[i+j])
+		}
+
+		var best segEnc
+		bestSize := -1
+		for _, e := range m.segment_forms(cmd, seg) {
+			size := len(e.data)
+			if e.form != form || nrep == 0 || nrep == ops[form].maxrep {
+				size++
+			}
+			if e.form == segAbs {
+				absSize += len(e.data)
+			}
+			if bestSize < 0 || size < bestSize {
+				best, bestSize = e, size
+			}
+		}
+
+		if best.form != form || nrep == ops[form].maxrep {
+			flush()
+			form = best.form
+		}
+		pend.Write(best.data)
+		nrep++
+		nseg++
+		m.cur = best.end
+
+		switch best.form {
+		case segAbs:
+			m.Stats.Abs++
+		case segRel:
+			m.Stats.Rel++
+		default:
+			m.Stats.HV++
+		}
 	}
-	m.Byte(baseop + byte(len(pts)/mod-1))
-	m.Pts(pts)
-	return nil
+	flush()
+
+	maxrep := ops[segAbs].maxrep
+	return absSize + (nseg+maxrep-1)/maxrep, nil
 }
 
-func (m *ProgMem) Pts(v []Point) {
-	for _, p := range v {
-		q := m.xform.Transform(p)
-		m.Coord(q.X)
-		m.Coord(q.Y)
+// segment_forms returns the possible encodings of segment seg
+// of cmd starting at the current point.
+func (m *ProgMem) segment_forms(cmd byte, seg []Point) []segEnc {
+	abs := segEnc{form: segAbs}
+	rel := segEnc{form: segRel}
+	for _, p := range seg {
+		var x, y float64
+		abs.data, x = m.coordBytes(abs.data, p.X)
+		abs.data, y = m.coordBytes(abs.data, p.Y)
+		abs.end = Point{x, y}
+
+		rel.data, x = m.coordBytes(rel.data, p.X-m.cur.X)
+		rel.data, y = m.coordBytes(rel.data, p.Y-m.cur.Y)
+		rel.end = Point{m.cur.X + x, m.cur.Y + y}
 	}
+	v := []segEnc{abs, rel}
+	if cmd != 'L' {
+		return v
+	}
+
+	p := seg[0]
+	if math.Abs(p.Y-m.cur.Y) <= m.Precision {
+		h := segEnc{form: segH}
+		var x float64
+		h.data, x = m.coordBytes(nil, p.X)
+		h.end = Point{x, m.cur.Y}
+		rh := segEnc{form: segRelH}
+		rh.data, x = m.coordBytes(nil, p.X-m.cur.X)
+		rh.end = Point{m.cur.X + x, m.cur.Y}
+		v = append(v, h, rh)
+	}
+	if math.Abs(p.X-m.cur.X) <= m.Precision {
+		vv := segEnc{form: segV}
+		var y float64
+		vv.data, y = m.coordBytes(nil, p.Y)
+		vv.end = Point{m.cur.X, y}
+		rv := segEnc{form: segRelV}
+		rv.data, y = m.coordBytes(nil, p.Y-m.cur.Y)
+		rv.end = Point{m.cur.X, m.cur.Y + y}
+		v = append(v, vv, rv)
+	}
+	return v
+}
+
+// coordBytes appends the encoding of coord v to p,
+// and returns it with the value decoded by renderers.
+func (m *ProgMem) coordBytes(p []byte, v float64) ([]byte, float64) {
+	var buf [4]byte
+	n := CoordBytes(buf[:], v, m.Precision)
+	x, _ := iconpack.CoordFromBytes(buf[:n])
+	return append(p, buf[:n]...), x
+}
+
+// point writes p transformed by m.xform,
+// and returns it as decoded by renderers.
+func (m *ProgMem) point(p Point) Point {
+	q := m.xform.Transform(p)
+	var b []byte
+	b, q.X = m.coordBytes(b, q.X)
+	b, q.Y = m.coordBytes(b, q.Y)
+	m.buf.Write(b)
+	return q
+}
+
+// arcOp adds the arcs in pts with their
+// ellipse parameters transformed by m.xform.
+func (m *ProgMem) arcOp(pts []Point) {
+	const maxrep = 0x10
+	for i := 0; i < len(pts); i += 3 {
+		if k := i / 3 % maxrep; k == 0 {
+			n := (len(pts) - i) / 3
+			if n > maxrep {
+				n = maxrep
+			}
+			m.Byte(0xc0 + byte(n-1))
+		}
+		rot, largeArc, sweep := arc_params(pts[i+1])
+		r, rot, sweep := transform_arc(m.xform, pts[i], rot, sweep)
+		var flags byte
+		if largeArc {
+			flags |= 0x01
+		}
+		if sweep {
+			flags |= 0x02
+		}
+		m.Coord(r.X)
+		m.Coord(r.Y)
+		rot, prec := arc_rotation(r, rot, m.Precision)
+		var buf [4]byte
+		m.buf.Write(buf[:CoordBytes(buf[:], rot, prec)])
+		m.Byte(flags)
+		m.cur = m.point(pts[i+2])
+	}
+}
+
+// arc_rotation returns the x-axis rotation rot in degrees of an
+// ellipse with radii r normalized to (-90, 90], and the precision
+// of the rotation keeping the ellipse within the coordinate
+// precision prec. Circles have zero rotation.
+func arc_rotation(r Point, rot, prec float64) (float64, float64) {
+	if math.Abs(r.X-r.Y) <= prec {
+		return 0, prec
+	}
+	rot = math.Mod(rot, 180)
+	switch {
+	case rot <= -90:
+		rot += 180
+	case rot > 90:
+		rot -= 180
+	}
+	// Rotating by a radians moves the ellipse by at most a·max(rx, ry).
+	return rot, prec / math.Max(r.X, r.Y) * 360 / τ
 }
 
 func (m *ProgMem) Coord(v float64) {
@@ -175,38 +424,3 @@ func CoordBytes(p []byte, v, prec float64) int {
 func rd64(v float64) float64 {
 	return math.Round(v*64) / 64
 }
-
-// CoordBytes reads coord v from p,
-// and returns the number of bytes consumed.
-// It returns n == 0 if p doesn't contain a full number.
-func CoordFromBytes(p []byte) (v float64, n int) {
-	if len(p) == 0 {
-		return 0, 0
-	}
-
-	if (p[0] & 0x01) != 0 {
-		return float64(int(p[0]>>1) - 64), 1
-	}
-
-	if len(p) < 2 {
-		return 0, 0
-	}
-
-	if (p[0] & 0x02) != 0 {
-		u := uint16(p[0]) | (uint16(p[1]) << 8)
-		x := int(u>>2) - (128 * 64)
-		return float64(x) / 64, 2
-	}
-
-	if len(p) < 4 {
-		return 0, 0
-	}
-
-	var bits uint32
-	bits |= uint32(p[0]) << 0
-	bits |= uint32(p[1]) << 8
-	bits |= uint32(p[2]) << 16
-	bits |= uint32(p[3]) << 24
-
-	return float64(math.Float32frombits(bits)), 4
-}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestProgMemRelative(t *testing.T) {
+	cmds := []PathCmd{
+		{'M', []Point{{100, 100}}},
+		{'L', []Point{{110, 100}, {110, 112.5}, {101, 113}, {150.3, 90.7}}},
+		{'C', []Point{{151, 91}, {152, 92}, {153, 90}, {20, 30}, {40, 50}, {60, 70}}},
+		{'Q', []Point{{61, 71}, {62, 70}}},
+		{'Z', nil},
+		{'L', []Point{{100, 90}}},
+	}
+
+	m := NewProgMem(1.0 / 128)
+	m.ViewBox(0, 0, 200, 200)
+	m.BeginPath(MatrixIdentity)
+	for _, c := range cmds {
+		if err := m.PathCmd(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Stop()
+
+	prog, err := iconpack.DecodeProgram(m.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Point
+	codes := make(map[iconpack.Opcode]bool)
+	for _, op := range prog.Ops {
+		codes[op.Code] = true
+		for _, p := range op.Pt {
+			got = append(got, Point{p.X, p.Y})
+		}
+	}
+	var want []Point
+	for _, c := range cmds {
+		want = append(want, c.Pt...)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d points, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if math.Abs(got[i].X-want[i].X) > m.Precision || math.Abs(got[i].Y-want[i].Y) > m.Precision {
+			t.Errorf("point %d: got %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	for _, op := range []iconpack.Opcode{
+		iconpack.OpRelHLineTo, iconpack.OpRelVLineTo, iconpack.OpRelLineTo,
+		iconpack.OpRelCubicBezierTo, iconpack.OpRelQuadraticBezierTo,
+	} {
+		if !codes[op] {
+			t.Errorf("%v not used", op)
+		}
+	}
+
+	st := m.Stats
+	if st.Bytes >= st.AbsBytes || st.Abs+st.Rel+st.HV != 8 {
+		t.Errorf("got stats %+v", st)
+	}
+}
+
+func TestArcRotation(t *testing.T) {
+	tests := []struct {
+		r    Point
+		rot  float64
+		want float64
+	}{
+		{Point{10, 5}, 30.3, 30},
+		{Point{10, 5}, 210, 30},
+		{Point{10, 5}, -135, 45},
+		{Point{10, 5}, 90, 90},
+		{Point{10, 5}, -90, 90},
+		{Point{1000, 5}, 30.3, 30.3},
+		{Point{10, 10}, 30.3, 0},
+		{Point{10, 10.01}, -45, 0},
+	}
+
+	for _, tt := range tests {
+		m := NewProgMem(1.0 / 16)
+		m.ViewBox(0, 0, 16, 16)
+		m.BeginPath(MatrixIdentity)
+		cmds := []PathCmd{
+			{'M', []Point{{0, 0}}},
+			{'A', arc_pts(tt.r, tt.rot, false, true, Point{8, 8})},
+		}
+		for _, c := range cmds {
+			if err := m.PathCmd(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m.Stop()
+
+		prog, err := iconpack.DecodeProgram(m.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var arcs []iconpack.Arc
+		for _, op := range prog.Ops {
+			arcs = append(arcs, op.Arc...)
+		}
+		if len(arcs) != 1 {
+			t.Fatalf("%v %g: got arcs %v", tt.r, tt.rot, arcs)
+		}
+		if got := arcs[0].Rotation; math.Abs(got-tt.want) > 1.0/64 {
+			t.Errorf("%v %g: got rotation %g, want %g", tt.r, tt.rot, got, tt.want)
+		}
+	}
+}
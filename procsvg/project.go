@@ -21,18 +21,102 @@ type Project struct {
 	// SVG files using inkcape.
 	IntermediateDir string
 
+	// Preprocessor selects how SVG files are simplified
+	// into IntermediateDir:
+	//   "inkscape" converts objects and strokes to paths using Inkscape,
+	//   "native" copies files unchanged,
+	//   "command" runs PreprocessCommand for each file.
+	// Its default value is "inkscape".
+	Preprocessor string
+
+	// PreprocessCommand is the command line used by the "command"
+	// preprocessor. Each element is a text/template template
+	// executed with PreprocessFile, for example:
+	//   ["svgo", "{{.Src}}", "-o", "{{.Dst}}"]
+	PreprocessCommand []string
+
+	// KeepStrokes keeps strokes as native program stroke ops
+	// instead of converting them to filled paths with Inkscape.
+	KeepStrokes bool
+
+	// KeepArcs keeps elliptical arcs as native program arc ops
+	// instead of approximating them with cubic Bézier curves.
+	KeepArcs bool
+
+	// ClipPaths selects how clip-path properties are converted:
+	//   "ops" emits clip ops for renderers to clip painting,
+	//   "intersect" intersects filled paths with convex clip paths,
+	//   and uses clip ops for other clip paths and stroked paths
+	//   crossing the clip path boundary.
+	// Its default value is "ops".
+	ClipPaths string
+
+	// InferViewBox selects how the view box of icons
+	// without a viewBox attribute is inferred:
+	//   "size" uses the width and height of the image,
+	//   or the geometry bounds if either is missing,
+	//   "bounds" uses the bounds of the icon geometry,
+	//   "error" rejects such icons.
+	// Its default value is "size".
+	InferViewBox string
+
+	// InferSize selects how the image size of icons
+	// without width or height attributes is inferred:
+	//   "viewbox" uses the view box size, keeping its aspect
+	//   ratio if either width or height is specified,
+	//   "error" rejects such icons.
+	// Its default value is "viewbox".
+	InferSize string
+
 	// NameFormat is an optional fmt.Printf format to generate
 	// process icon names and ID strings from the file name.
 	NameFormat string
 
 	// Epsilon is the icon conversion precision.
+	// Coordinates are encoded and paths are simplified
+	// within Epsilon in view box units.
 	Epsilon float64
 
+	// PixelPrecision is the conversion precision in pixels.
+	// When nonzero, the precision of each icon variant is derived
+	// from its image size and view box, so that small variants
+	// use coarser coordinates, and Epsilon is used only when it
+	// is larger. A value of 1/16 is usually indistinguishable
+	// from exact coordinates.
+	PixelPrecision float64
+
+	// ScaleViewBox rescales the view box of each icon variant
+	// to its image size, so that program coordinates are pixels.
+	// Coordinates of small icons then fit the shortest encodings.
+	ScaleViewBox bool
+
+	// FitCurves is the tolerance in pixels for replacing runs of
+	// line segments with cubic Bézier curves, such as polylines
+	// of traced bitmaps. Runs are split at corners, and are
+	// replaced only by fewer curve points. Its default value
+	// is 0, which keeps lines.
+	FitCurves float64
+
+	// IconFitCurves overrides FitCurves for icons by name.
+	IconFitCurves map[string]float64
+
 	// Palette defines a default palette.
 	// When colors are specified, they appear
 	// at the beginning of the icon pack palette.
+	// Colors may use hex, rgb(), hsl() or named CSS colors.
 	Palette []ProjectColor
 
+	// CurrentColor is the palette index reserved for currentColor.
+	// Fills, strokes and gradient stops using currentColor refer to
+	// this palette entry, so that renderers may substitute it with
+	// the color of the surrounding text. The entry holds the Palette
+	// color at this index, or opaque black if CurrentColor equals
+	// the number of Palette colors.
+	// Elements within an element having a color property are
+	// painted with the color property value instead.
+	// Its default value is -1, which disables the reserved entry.
+	CurrentColor int
+
 	// AutoPalette generates the palette automatically or
 	// extends the default palette with colors used by the icons.
 	AutoPalette bool
@@ -58,8 +142,13 @@ type Project struct {
 var DefaultProject = Project{
 	IconDir:         "icons",
 	IntermediateDir: "intermediate",
+	Preprocessor:    PreprocessInkscape,
+	ClipPaths:       ClipOps,
+	InferViewBox:    InferViewBoxSize,
+	InferSize:       InferSizeViewBox,
 	SizeDir:         []string{"."},
 	Epsilon:         1e-4,
+	CurrentColor:    -1,
 	Target:          "icons.iconpk",
 }
 
@@ -102,17 +191,26 @@ func (i TemplateIcon) Padding(n int) string {
 	return ""
 }
 
+// ProjectColor is a color in a project file.
+// It may be specified using any CSS color syntax except currentColor.
 type ProjectColor color.NRGBA
 
 func (c *ProjectColor) UnmarshalText(p []byte) error {
-	s := string(p)
-
-	if x, ok := colorfromhex(s); ok {
-		*c = ProjectColor(x)
-		return nil
+	x, err := project_color(string(p))
+	if err != nil {
+		return err
 	}
+	*c = ProjectColor(x)
+	return nil
+}
 
-	return fmt.Errorf("Invalid color %s", s)
+func project_color(s string) (color.NRGBA, error) {
+	if !strings.EqualFold(strings.TrimSpace(s), "currentColor") {
+		if c, ok := parse_color(s, color.NRGBA{}); ok {
+			return c, nil
+		}
+	}
+	return color.NRGBA{}, fmt.Errorf("Invalid color %s", s)
 }
 
 type ColorTransform struct {
@@ -127,22 +225,20 @@ type ColorTransform struct {
 type ColorMap map[color.NRGBA]color.NRGBA
 
 func (cm *ColorMap) UnmarshalText(p []byte) error {
-	v := strings.FieldsFunc(string(p), func(r rune) bool {
-		return !hexColorRune(r)
-	})
+	v := split_colors(string(p))
 	if len(v)%2 != 0 {
 		return fmt.Errorf("invalid number of colormap colors: %d", len(v))
 	}
 
 	m := make(ColorMap)
 	for i := 0; i < len(v); i += 2 {
-		c0, ok := colorfromhex(v[i])
-		if !ok {
-			return fmt.Errorf("invalid color %s", v[i])
+		c0, err := project_color(v[i])
+		if err != nil {
+			return err
 		}
-		c1, ok := colorfromhex(v[i+1])
-		if !ok {
-			return fmt.Errorf("invalid color %s", v[i+1])
+		c1, err := project_color(v[i+1])
+		if err != nil {
+			return err
 		}
 		m[c0] = c1
 	}
@@ -150,13 +246,6 @@ func (cm *ColorMap) UnmarshalText(p []byte) error {
 	return nil
 }
 
-func hexColorRune(r rune) bool {
-	return r == '#' ||
-		('0' <= r && r <= '9') ||
-		('a' <= r && r <= 'f') ||
-		('A' <= r && r <= 'F')
-}
-
 func LoadProject(fn string) (Project, error) {
 	p := DefaultProject
 
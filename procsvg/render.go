@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+	"github.com/tajtiattila/vector-icon/raster"
+)
+
+// render_main runs the render subcommand that writes PNG previews
+// of icon packs.
+func render_main(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	outdir := fs.String("o", "render", "output directory")
+	scales := fs.String("scale", "1", "comma separated list of scale factors")
+	pattern := fs.String("icon", "", "render only icons with names matching `pattern`")
+	current := fs.String("color", "", "paint currentColor with `color` instead of its palette color")
+	fs.BoolVar(&cli.verbose, "v", false, "verbose operation")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: procsvg render [flags] iconpack...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("No icon pack files")
+	}
+
+	sv, err := parse_scales(*scales)
+	if err != nil {
+		return err
+	}
+
+	if *pattern != "" {
+		if _, err := filepath.Match(*pattern, ""); err != nil {
+			return fmt.Errorf("Invalid icon pattern %q: %w", *pattern, err)
+		}
+	}
+
+	var tint *color.NRGBA
+	if *current != "" {
+		c, err := project_color(*current)
+		if err != nil {
+			return err
+		}
+		tint = &c
+	}
+
+	for _, fn := range fs.Args() {
+		pack, err := iconpack.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %w", fn, err)
+		}
+
+		dir := *outdir
+		if fs.NArg() > 1 {
+			dir = filepath.Join(dir, strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn)))
+		}
+		if err := render_pack(pack, dir, sv, *pattern, tint); err != nil {
+			return fmt.Errorf("Error rendering %s: %w", fn, err)
+		}
+	}
+
+	return nil
+}
+
+func parse_scales(s string) ([]int, error) {
+	var v []int
+	seen := make(map[int]bool)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSuffix(strings.TrimSpace(f), "x")
+		n, err := strconv.Atoi(f)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("Invalid scale factor %q", f)
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("Duplicate scale factor %d", n)
+		}
+		seen[n] = true
+		v = append(v, n)
+	}
+	return v, nil
+}
+
+func render_pack(pack *iconpack.Pack, dir string, scales []int, pattern string, tint *color.NRGBA) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	pals := pack.Palettes()
+	if len(pals) == 0 {
+		pals = []iconpack.Palette{nil}
+	} else if tint != nil {
+		v := make([]iconpack.Palette, len(pals))
+		for i := range pals {
+			v[i] = pack.CurrentColorPalette(i, *tint)
+		}
+		pals = v
+	}
+
+	for _, ic := range pack.Icons() {
+		if pattern != "" {
+			if m, _ := filepath.Match(pattern, ic.Name); !m {
+				continue
+			}
+		}
+
+		for _, v := range ic.Variants {
+			for _, scale := range scales {
+				for pi, pal := range pals {
+					dx, dy := v.Width*scale, v.Height*scale
+					fn := filepath.Join(dir, render_filename(ic.Name, v, scale, pi))
+					if cli.verbose {
+						fmt.Printf("Render %s\n", fn)
+					}
+					if err := render_png(fn, v, dx, dy, pal); err != nil {
+						return fmt.Errorf("icon %q: %w", ic.Name, err)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// render_filename returns the file name for an icon variant
+// rendered with the specified scale and palette.
+func render_filename(name string, v *iconpack.Variant, scale, palidx int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return fmt.Sprintf("%s_%dx%d@%dx_p%d.png", name, v.Width, v.Height, scale, palidx)
+}
+
+func render_png(fn string, v *iconpack.Variant, dx, dy int, pal iconpack.Palette) error {
+	m, err := render_variant(v, dx, dy, pal)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(f, m)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// render_variant renders v into a new dx×dy image.
+func render_variant(v *iconpack.Variant, dx, dy int, pal iconpack.Palette) (*image.RGBA, error) {
+	prog, err := v.Program()
+	if err != nil {
+		return nil, err
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, dx, dy))
+	err = raster.Draw(m, m.Bounds(), prog, &raster.Options{Palette: pal})
+	return m, err
+}
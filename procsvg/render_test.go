@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestParseScales(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []int
+	}{
+		{"1", []int{1}},
+		{"1,2", []int{1, 2}},
+		{" 1x, 2x ,4", []int{1, 2, 4}},
+	}
+	for _, tt := range tests {
+		got, err := parse_scales(tt.s)
+		if err != nil {
+			t.Errorf("%q: %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.s, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "0", "-1", "1,,2", "1.5", "x", "2xx", "1,2,1x"} {
+		if _, err := parse_scales(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+func TestRenderFilename(t *testing.T) {
+	tests := []struct {
+		name         string
+		dx, dy       int
+		scale, palix int
+		want         string
+	}{
+		{"home", 16, 16, 1, 0, "home_16x16@1x_p0.png"},
+		{"arrow-left", 24, 16, 2, 1, "arrow-left_24x16@2x_p1.png"},
+		{`a/b\c:d*e?f"g<h>i|j`, 8, 8, 1, 0, "a_b_c_d_e_f_g_h_i_j_8x8@1x_p0.png"},
+	}
+	for _, tt := range tests {
+		v := &iconpack.Variant{Width: tt.dx, Height: tt.dy}
+		if got := render_filename(tt.name, v, tt.scale, tt.palix); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPack(t *testing.T) {
+	pack := testPack(t, map[string][]string{
+		"square": {
+			`<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">
+<rect width="16" height="16" fill="#f00"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg" width="24" height="12" viewBox="0 0 24 12">
+<rect width="24" height="12" fill="#f00"/></svg>`,
+		},
+	})
+
+	dir := t.TempDir()
+	if err := render_pack(pack, dir, []int{1, 2}, "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fn     string
+		dx, dy int
+	}{
+		{"square_16x16@1x_p0.png", 16, 16},
+		{"square_16x16@2x_p0.png", 32, 32},
+		{"square_24x12@1x_p0.png", 24, 12},
+		{"square_24x12@2x_p0.png", 48, 24},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(filepath.Join(dir, tt.fn))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		m, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.fn, err)
+			continue
+		}
+		if b := m.Bounds(); b.Dx() != tt.dx || b.Dy() != tt.dy {
+			t.Errorf("%s: got size %v, want %dx%d", tt.fn, b.Size(), tt.dx, tt.dy)
+		}
+		want := color.NRGBA{0xff, 0, 0, 0xff}
+		if got := color.NRGBAModel.Convert(m.At(tt.dx/2, tt.dy/2)); got != want {
+			t.Errorf("%s: got center color %v, want %v", tt.fn, got, want)
+		}
+	}
+}
+
+// testPack converts the svg documents of the icons into an icon pack
+// with a palette of red and blue. Icons are sorted by name.
+func testPack(t *testing.T, icons map[string][]string) *iconpack.Pack {
+	t.Helper()
+	pal := []color.NRGBA{{0xff, 0, 0, 0xff}, {0, 0, 0xff, 0xff}}
+	k := IconPack{
+		palette:      [][]color.NRGBA{pal},
+		currentColor: -1,
+	}
+
+	var names []string
+	for name := range icons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dir := t.TempDir()
+	for _, name := range names {
+		pe := PackElem{Name: name}
+		for _, doc := range icons[name] {
+			fn := filepath.Join(dir, "icon.svg")
+			if err := os.WriteFile(fn, []byte(doc), 0666); err != nil {
+				t.Fatal(err)
+			}
+			im, err := ProcSvg(fn, svgOpts{palette: pal, currentColor: -1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pe.Image = append(pe.Image, im)
+		}
+		k.Add(pe)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := k.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	pack, err := iconpack.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pack
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ShapeCmds converts SVG basic shape elements
+// (rect, circle, ellipse, line, polyline and polygon) to path commands.
+// Percentage lengths are relative to the viewport size vp.
+// It returns nil if the shape is not rendered.
+func ShapeCmds(n Node, vp Point) ([]PathCmd, error) {
+	switch n.Name.Local {
+	case "rect":
+		return rectCmds(n, vp)
+	case "circle":
+		return ellipseCmds(n, vp, "r", "r")
+	case "ellipse":
+		return ellipseCmds(n, vp, "rx", "ry")
+	case "line":
+		return lineCmds(n, vp)
+	case "polyline", "polygon":
+		return polyCmds(n)
+	}
+	return nil, fmt.Errorf("unknown shape %s", n.Name.Local)
+}
+
+func rectCmds(n Node, vp Point) ([]PathCmd, error) {
+	x, y, w, h, err := shapeattrs(n, vp, "x", "y", "width", "height")
+	if err != nil {
+		return nil, err
+	}
+
+	if w <= 0 || h <= 0 {
+		return nil, nil
+	}
+
+	rx, ry, err := rectRadii(n, vp, w, h)
+	if err != nil {
+		return nil, err
+	}
+
+	if rx == 0 || ry == 0 {
+		return []PathCmd{
+			{'M', []Point{{x, y}}},
+			{'L', []Point{{x + w, y}, {x + w, y + h}, {x, y + h}}},
+			{'Z', nil},
+		}, nil
+	}
+
+	x1, y1 := x+w, y+h
+
+	var b pathbuilder
+	b.moveTo(Point{x + rx, y})
+	b.lineTo(Point{x1 - rx, y})
+	b.corner(Point{x1, y}, Point{x1, y + ry})
+	b.lineTo(Point{x1, y1 - ry})
+	b.corner(Point{x1, y1}, Point{x1 - rx, y1})
+	b.lineTo(Point{x + rx, y1})
+	b.corner(Point{x, y1}, Point{x, y1 - ry})
+	b.lineTo(Point{x, y + ry})
+	b.corner(Point{x, y}, Point{x + rx, y})
+	b.close()
+	return b.cmd, nil
+}
+
+// rectRadii returns the corner radii of an SVG rect.
+func rectRadii(n Node, vp Point, w, h float64) (rx, ry float64, err error) {
+	hasrx, hasry := hasattr(n, "rx"), hasattr(n, "ry")
+	if hasrx {
+		if rx, err = shape_length(n, vp, "rx"); err != nil {
+			return 0, 0, fmt.Errorf("rect rx: %w", err)
+		}
+	}
+	if hasry {
+		if ry, err = shape_length(n, vp, "ry"); err != nil {
+			return 0, 0, fmt.Errorf("rect ry: %w", err)
+		}
+	}
+
+	switch {
+	case hasrx && !hasry:
+		ry = rx
+	case hasry && !hasrx:
+		rx = ry
+	}
+
+	if rx < 0 || ry < 0 {
+		return 0, 0, fmt.Errorf("negative rect radius")
+	}
+
+	if rx > w/2 {
+		rx = w / 2
+	}
+	if ry > h/2 {
+		ry = h / 2
+	}
+	return rx, ry, nil
+}
+
+func ellipseCmds(n Node, vp Point, rxattr, ryattr string) ([]PathCmd, error) {
+	cx, cy, rx, ry, err := shapeattrs(n, vp, "cx", "cy", rxattr, ryattr)
+	if err != nil {
+		return nil, err
+	}
+
+	if rx <= 0 || ry <= 0 {
+		return nil, nil
+	}
+
+	var b pathbuilder
+	b.moveTo(Point{cx + rx, cy})
+	b.corner(Point{cx + rx, cy + ry}, Point{cx, cy + ry})
+	b.corner(Point{cx - rx, cy + ry}, Point{cx - rx, cy})
+	b.corner(Point{cx - rx, cy - ry}, Point{cx, cy - ry})
+	b.corner(Point{cx + rx, cy - ry}, Point{cx + rx, cy})
+	b.close()
+	return b.cmd, nil
+}
+
+func lineCmds(n Node, vp Point) ([]PathCmd, error) {
+	x1, y1, x2, y2, err := shapeattrs(n, vp, "x1", "y1", "x2", "y2")
+	if err != nil {
+		return nil, err
+	}
+
+	return []PathCmd{
+		{'M', []Point{{x1, y1}}},
+		{'L', []Point{{x2, y2}}},
+	}, nil
+}
+
+func polyCmds(n Node) ([]PathCmd, error) {
+	// A trailing odd coordinate is ignored.
+	d := pathdecoder{data: findattr(n, "points")}
+	var pts []Point
+	for d.err == nil && d.isnum() {
+		x := d.number()
+		if d.err != nil || !d.isnum() {
+			break
+		}
+		pts = append(pts, Point{x, d.number()})
+	}
+	if d.err == nil && d.pos < len(d.data) {
+		d.seterrf("Unexpected %q at position %d", d.data[d.pos], d.pos)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("invalid points: %w", d.err)
+	}
+
+	if len(pts) < 2 {
+		return nil, nil
+	}
+
+	cmds := []PathCmd{
+		{'M', pts[:1]},
+		{'L', pts[1:]},
+	}
+	if n.Name.Local == "polygon" {
+		cmds = append(cmds, PathCmd{'Z', nil})
+	}
+	return cmds, nil
+}
+
+// shapeattrs parses four length attributes of n.
+// Missing attributes have the value 0.
+func shapeattrs(n Node, vp Point, a, b, c, d string) (va, vb, vc, vd float64, err error) {
+	names := []string{a, b, c, d}
+	var v [4]float64
+	for i, name := range names {
+		v[i], err = shape_length(n, vp, name)
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("%s %s: %w", n.Name.Local, name, err)
+		}
+	}
+	return v[0], v[1], v[2], v[3], nil
+}
+
+// shape_length parses the length attribute name of n, or returns 0
+// if n has no such attribute. Percentages are relative to the width
+// or height of the viewport size vp, or to its normalized diagonal.
+func shape_length(n Node, vp Point, name string) (float64, error) {
+	s := findattr(n, name)
+	if s == "" {
+		return 0, nil
+	}
+	v, pct, err := parse_percentage(s)
+	if err != nil || !pct {
+		return v, err
+	}
+	switch name {
+	case "x", "cx", "x1", "x2", "width", "rx":
+		return v * vp.X, nil
+	case "y", "cy", "y1", "y2", "height", "ry":
+		return v * vp.Y, nil
+	}
+	return v * math.Sqrt((vp.X*vp.X+vp.Y*vp.Y)/2), nil
+}
+
+// parse_length parses an SVG length in user units.
+// Absolute units are converted using 96 user units per inch,
+// font relative units assume a 16px font with an 8px x-height.
+func parse_length(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	f := 1.0
+	for _, u := range lengthUnits {
+		if t := strings.TrimSuffix(s, u.name); t != s {
+			s, f = t, u.f
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v * f, err
+}
+
+var lengthUnits = []struct {
+	name string
+	f    float64
+}{
+	{"px", 1},
+	{"pt", 96.0 / 72},
+	{"pc", 16},
+	{"mm", 96 / 25.4},
+	{"cm", 96 / 2.54},
+	{"in", 96},
+	{"em", 16},
+	{"ex", 8},
+}
+
+// pathbuilder builds path commands for shapes.
+type pathbuilder struct {
+	cmd  []PathCmd
+	last Point
+}
+
+func (b *pathbuilder) moveTo(p Point) {
+	b.cmd = append(b.cmd, PathCmd{'M', []Point{p}})
+	b.last = p
+}
+
+func (b *pathbuilder) add(cmd byte, v ...Point) {
+	if n := len(b.cmd); n != 0 && b.cmd[n-1].Cmd == cmd {
+		b.cmd[n-1].Pt = append(b.cmd[n-1].Pt, v...)
+	} else {
+		b.cmd = append(b.cmd, PathCmd{cmd, v})
+	}
+	b.last = v[len(v)-1]
+}
+
+func (b *pathbuilder) lineTo(p Point) {
+	if p != b.last {
+		b.add('L', p)
+	}
+}
+
+func (b *pathbuilder) close() {
+	b.cmd = append(b.cmd, PathCmd{'Z', nil})
+}
+
+// corner adds a quarter elliptical arc from the current point to p
+// inscribed in the corner c of the bounding rectangle.
+func (b *pathbuilder) corner(c, p Point) {
+	p0 := b.last
+	r := Point{math.Abs(p.X - p0.X), math.Abs(p.Y - p0.Y)}
+	sweep := (c.X-p0.X)*(p.Y-c.Y)-(c.Y-p0.Y)*(p.X-c.X) > 0
+	b.add('A', arc_pts(r, 0, false, sweep, p)...)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestShapeCmds(t *testing.T) {
+	tests := []struct {
+		elem string
+		want string
+	}{
+		{`<rect x="1" y="2" width="3" height="4"/>`,
+			"{M 1,2} {L 4,2 4,6 1,6} {Z}"},
+		{`<rect width="0" height="4"/>`,
+			""},
+		{`<rect width="10" height="4" rx="5"/>`,
+			"{M 5,0} {A 5,2 0,2 10,2 5,2 0,2 5,4 5,2 0,2 0,2 5,2 0,2 5,0} {Z}"},
+		{`<rect x="0" y="0" width="10" height="10" rx="1" ry="2"/>`,
+			"{M 1,0} {L 9,0} {A 1,2 0,2 10,2} {L 10,8} {A 1,2 0,2 9,10} {L 1,10} " +
+				"{A 1,2 0,2 0,8} {L 0,2} {A 1,2 0,2 1,0} {Z}"},
+		{`<circle cx="5" cy="5" r="5"/>`,
+			"{M 10,5} {A 5,5 0,2 5,10 5,5 0,2 0,5 5,5 0,2 5,0 5,5 0,2 10,5} {Z}"},
+		{`<ellipse cx="0" cy="0" rx="2" ry="1"/>`,
+			"{M 2,0} {A 2,1 0,2 0,1 2,1 0,2 -2,0 2,1 0,2 0,-1 2,1 0,2 2,0} {Z}"},
+		{`<line x1="1" y1="2" x2="3px" y2="4"/>`,
+			"{M 1,2} {L 3,4}"},
+		{`<line x1="1in" y1="3pt" x2="1cm" y2="0.5em"/>`,
+			"{M 96,4} {L 37.7953,8}"},
+		{`<polyline points="1,2 3,4 5,6 7"/>`,
+			"{M 1,2} {L 3,4 5,6}"},
+		{`<polygon points="1 2,3 4, 5 6"/>`,
+			"{M 1,2} {L 3,4 5,6} {Z}"},
+		{`<polyline points="10-5 3-2"/>`,
+			"{M 10,-5} {L 3,-2}"},
+		{"<polygon points=\"1.5.5\n\t2e1-1e-1,+3 4 \"/>",
+			"{M 1.5,0.5} {L 20,-0.1 3,4} {Z}"},
+		{`<rect x="10%" y="50%" width="50%" height="20%" rx="5%"/>`,
+			"{M 3,5} {L 11,5} {A 1,1 0,2 12,6 1,1 0,2 11,7} {L 3,7} {A 1,1 0,2 2,6 1,1 0,2 3,5} {Z}"},
+		{`<circle cx="50%" cy="50%" r="10%"/>`,
+			"{M 11.5811,5} {A 1.5811,1.5811 0,2 10,6.5811 1.5811,1.5811 0,2 8.4189,5 " +
+				"1.5811,1.5811 0,2 10,3.4189 1.5811,1.5811 0,2 11.5811,5} {Z}"},
+		{`<line x1="0%" y1="100%" x2="100%" y2="0"/>`,
+			"{M 0,10} {L 20,0}"},
+	}
+
+	for _, tt := range tests {
+		var n Node
+		if err := xml.Unmarshal([]byte(tt.elem), (*xmlNode)(&n)); err != nil {
+			t.Fatal(err)
+		}
+
+		cmds, err := ShapeCmds(n, Point{20, 10})
+		if err != nil {
+			t.Errorf("%s: %v", tt.elem, err)
+			continue
+		}
+
+		if got := fmtCmds(cmds); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.elem, got, tt.want)
+		}
+	}
+
+	for _, elem := range []string{
+		`<polyline points="1,2 3,x"/>`,
+		`<polyline points="1,2,,3,4"/>`,
+		`<rect width="1x" height="1"/>`,
+		`<circle r="%"/>`,
+	} {
+		var n Node
+		if err := xml.Unmarshal([]byte(elem), (*xmlNode)(&n)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ShapeCmds(n, Point{20, 10}); err == nil {
+			t.Errorf("%s: no error", elem)
+		}
+	}
+}
+
+func TestUnstyledShape(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">
+<rect x="2" y="2" width="12" height="12"/></svg>`
+
+	prog := procTestSvg(t, doc, svgOpts{currentColor: -1})
+	want := "SetSolidFill #000000ff BeginMoveTo 2,2 HLineTo 14,2 VLineTo 14,14 HLineTo 2,14"
+	if got := fmtOps(prog); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// procTestSvg converts the svg document doc and decodes its program.
+func procTestSvg(t *testing.T, doc string, opts svgOpts) *iconpack.Program {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "icon.svg")
+	if err := os.WriteFile(fn, []byte(doc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	im, err := ProcSvg(fn, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := iconpack.DecodeProgram(im.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+// fmtOps formats the ops of prog with their colors and points.
+func fmtOps(prog *iconpack.Program) string {
+	round := func(v float64) float64 {
+		return math.Round(v*1e4) / 1e4
+	}
+	var v []string
+	for _, op := range prog.Ops {
+		v = append(v, op.Code.String())
+		switch op.Code {
+		case iconpack.OpSolidFill, iconpack.OpSolidStroke:
+			c := op.Color
+			v = append(v, fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A))
+		case iconpack.OpPaletteFill, iconpack.OpPaletteStroke:
+			v = append(v, fmt.Sprint(op.Index))
+		case iconpack.OpPaletteAlphaFill, iconpack.OpPaletteAlphaStroke:
+			v = append(v, fmt.Sprintf("%d/%02x", op.Index, op.Color.A))
+		case iconpack.OpFillRule, iconpack.OpPushClip, iconpack.OpLineCap, iconpack.OpLineJoin:
+			v = append(v, fmt.Sprint(op.Mode))
+		case iconpack.OpStrokeWidth, iconpack.OpMiterLimit:
+			v = append(v, fmt.Sprint(round(op.Value)))
+		}
+		for _, pt := range op.Pt {
+			v = append(v, fmt.Sprintf("%v,%v", round(pt.X), round(pt.Y)))
+		}
+	}
+	return strings.Join(v, " ")
+}
+
+// xmlNode unmarshals a single xml element into a Node.
+type xmlNode Node
+
+func (n *xmlNode) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	n.Name = start.Name
+	n.Attr = start.Attr
+	return d.Skip()
+}
+
+func fmtCmds(cmds []PathCmd) string {
+	round := func(v float64) float64 {
+		return math.Round(v*1e4) / 1e4
+	}
+	var v []string
+	for _, c := range cmds {
+		sb := new(strings.Builder)
+		sb.WriteByte('{')
+		sb.WriteByte(c.Cmd)
+		for _, pt := range c.Pt {
+			fmt.Fprintf(sb, " %v,%v", round(pt.X), round(pt.Y))
+		}
+		sb.WriteByte('}')
+		v = append(v, sb.String())
+	}
+	return strings.Join(v, " ")
+}
@@ -8,14 +8,17 @@ import (
 
 func simplify_svg(project Project) error {
 
-	inkscape := NewInkscapeShell()
-	defer inkscape.Close()
+	pp, err := NewPreprocessor(project)
+	if err != nil {
+		return err
+	}
+	defer pp.Close()
 
 	for _, sub := range project.SizeDir {
 		sd := filepath.Join(project.IconDir, sub)
 		td := filepath.Join(project.IntermediateDir, sub)
 
-		if err := simplify_svg_dir(inkscape, sd, td); err != nil {
+		if err := simplify_svg_dir(pp, sd, td); err != nil {
 			return err
 		}
 	}
@@ -23,8 +26,8 @@ func simplify_svg(project Project) error {
 	return nil
 }
 
-func simplify_svg_dir(is *InkscapeShell, sd, td string) error {
-	if err := os.MkdirAll(td, 0666); err != nil {
+func simplify_svg_dir(pp Preprocessor, sd, td string) error {
+	if err := os.MkdirAll(td, 0777); err != nil {
 		return err
 	}
 
@@ -36,7 +39,7 @@ func simplify_svg_dir(is *InkscapeShell, sd, td string) error {
 	for _, svg := range svgs {
 		sf := filepath.Join(sd, svg)
 		tf := filepath.Join(td, svg)
-		if err := simplify_svg_file(is, sf, tf); err != nil {
+		if err := simplify_svg_file(pp, sf, tf); err != nil {
 			return err
 		}
 	}
@@ -44,7 +47,7 @@ func simplify_svg_dir(is *InkscapeShell, sd, td string) error {
 	return nil
 }
 
-func simplify_svg_file(is *InkscapeShell, sf, tf string) error {
+func simplify_svg_file(pp Preprocessor, sf, tf string) error {
 	if !cli.rebuild && file_up_to_date(sf, tf) {
 		return nil
 	}
@@ -53,15 +56,5 @@ func simplify_svg_file(is *InkscapeShell, sf, tf string) error {
 		fmt.Printf("Simplify %s\n", sf)
 	}
 
-	is.Cmdf("file-open:%s", filepath.ToSlash(sf))
-	is.Cmd("select-all")
-	is.Cmd("object-to-path")
-	is.Cmd("object-stroke-to-path")
-	is.Cmd("export-overwrite:true")
-	is.Cmd("export-plain-svg:true")
-	is.Cmdf("export-filename:%s", filepath.ToSlash(tf))
-	is.Cmd("export-do")
-	is.Cmd("file-close")
-
-	return is.Err()
+	return pp.Process(sf, tf)
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+type fakePreprocessor struct {
+	processed []string
+}
+
+func (p *fakePreprocessor) Process(src, dst string) error {
+	p.processed = append(p.processed, filepath.Base(src))
+	return copy_file(src, dst)
+}
+
+func (p *fakePreprocessor) Close() error { return nil }
+
+func TestSimplifySvgDir(t *testing.T) {
+	sd := t.TempDir()
+	td := filepath.Join(t.TempDir(), "intermediate")
+
+	past := time.Now().Add(-time.Hour)
+	for _, fn := range []string{"a.svg", "b.svg", "c.txt"} {
+		p := filepath.Join(sd, fn)
+		if err := os.WriteFile(p, []byte("<svg/>"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pp := new(fakePreprocessor)
+	if err := simplify_svg_dir(pp, sd, td); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(pp.processed)
+	want := []string{"a.svg", "b.svg"}
+	if !reflect.DeepEqual(pp.processed, want) {
+		t.Fatalf("processed %v, want %v", pp.processed, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(td, "a.svg")); err != nil {
+		t.Fatal(err)
+	}
+
+	// up to date files are skipped
+	pp = new(fakePreprocessor)
+	if err := simplify_svg_dir(pp, sd, td); err != nil {
+		t.Fatal(err)
+	}
+	if len(pp.processed) != 0 {
+		t.Fatalf("processed %v, want none", pp.processed)
+	}
+}
+
+func TestNewPreprocessor(t *testing.T) {
+	p := DefaultProject
+
+	p.Preprocessor = PreprocessNative
+	if _, err := NewPreprocessor(p); err != nil {
+		t.Error(err)
+	}
+
+	p.Preprocessor = PreprocessCommand
+	if _, err := NewPreprocessor(p); err == nil {
+		t.Error("command preprocessor without command: no error")
+	}
+
+	p.PreprocessCommand = []string{"cp", "{{.Src}", "{{.Dst}}"}
+	if _, err := NewPreprocessor(p); err == nil {
+		t.Error("invalid command template: no error")
+	}
+
+	p.Preprocessor = "unknown"
+	if _, err := NewPreprocessor(p); err == nil {
+		t.Error("unknown preprocessor: no error")
+	}
+}
+
+func TestNativePreprocessIcon(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">
+<circle cx="8" cy="8" r="6"/><polygon points="1,1 4,1 1,4"/></svg>`
+
+	sd := t.TempDir()
+	td := filepath.Join(t.TempDir(), "intermediate")
+	if err := os.WriteFile(filepath.Join(sd, "icon.svg"), []byte(doc), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	p := DefaultProject
+	p.Preprocessor = PreprocessNative
+	pp, err := NewPreprocessor(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pp.Close()
+	if err := simplify_svg_dir(pp, sd, td); err != nil {
+		t.Fatal(err)
+	}
+
+	im, err := ProcSvg(filepath.Join(td, "icon.svg"), svgOpts{currentColor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := iconpack.DecodeProgram(im.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fill, paths int
+	for _, op := range prog.Ops {
+		switch op.Code {
+		case iconpack.OpSolidFill:
+			fill++
+		case iconpack.OpBeginMoveTo:
+			paths++
+		}
+	}
+	if fill == 0 || paths != 2 {
+		t.Errorf("got %d fill ops and %d paths, want 2 filled paths:\n%s", fill, paths, fmtOps(prog))
+	}
+}
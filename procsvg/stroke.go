@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+)
+
+// strokeStyle is the SVG stroke style of a node.
+type strokeStyle struct {
+	color      color.NRGBA // zero alpha for no stroke
+	current    bool        // color is the current color palette entry
+	opacity    float64
+	width      float64
+	cap        byte // 0: butt, 1: round, 2: square
+	join       byte // 0: miter, 1: round, 2: bevel
+	miterLimit float64
+}
+
+var defaultStroke = strokeStyle{
+	opacity:    1,
+	width:      1,
+	miterLimit: 4,
+}
+
+func (s strokeStyle) visible() bool {
+	return s.color.A != 0 && s.width > 0
+}
+
+// stroke_visible reports if the current stroke
+// is visible with the effective opacity.
+func (g *svgprog) stroke_visible() bool {
+	return g.stroke.visible() && g.stroke_color().A != 0
+}
+
+// stroke_color returns the stroke color with effective alpha.
+func (g *svgprog) stroke_color() color.NRGBA {
+	return with_alpha(g.stroke.color, g.stroke.opacity*g.opacity)
+}
+
+// update_stroke applies the stroke presentation attributes of n to g.stroke.
+func (g *svgprog) update_stroke(n Node) error {
+	s := &g.stroke
+
+	switch a := get_presentation_attr(n, "stroke"); a {
+	case "":
+	case "none":
+		s.color, s.current = color.NRGBA{}, false
+	default:
+		if c, ok := parse_color(a, g.currentColor); ok {
+			s.color, s.current = c, g.use_current_index(a)
+		} else if id, ok := paint_url(a); ok {
+			st, err := g.stroke_paint(n, id)
+			if err != nil {
+				return err
+			}
+			s.color, s.current = st.color, st.current
+		}
+	}
+
+	if a := get_presentation_attr(n, "stroke-opacity"); a != "" {
+		v, err := parse_opacity(a)
+		if err != nil {
+			return fmt.Errorf("stroke-opacity: %w", err)
+		}
+		s.opacity = v
+	}
+
+	if a := get_presentation_attr(n, "stroke-width"); a != "" {
+		w, pct, err := parse_percentage(a)
+		if err != nil {
+			return fmt.Errorf("stroke-width: %w", err)
+		}
+		if pct {
+			// Percentages are relative to the normalized viewport diagonal.
+			vw, vh := g.viewport.X, g.viewport.Y
+			w *= math.Sqrt((vw*vw + vh*vh) / 2)
+		}
+		s.width = w
+	}
+
+	switch a := get_presentation_attr(n, "stroke-linecap"); a {
+	case "":
+	case "butt":
+		s.cap = 0
+	case "round":
+		s.cap = 1
+	case "square":
+		s.cap = 2
+	default:
+		return fmt.Errorf("invalid stroke-linecap %q", a)
+	}
+
+	switch a := get_presentation_attr(n, "stroke-linejoin"); a {
+	case "":
+	case "miter", "miter-clip", "arcs":
+		s.join = 0
+	case "round":
+		s.join = 1
+	case "bevel":
+		s.join = 2
+	default:
+		return fmt.Errorf("invalid stroke-linejoin %q", a)
+	}
+
+	if a := get_presentation_attr(n, "stroke-miterlimit"); a != "" {
+		v, err := strconv.ParseFloat(a, 64)
+		if err != nil || v < 1 {
+			return fmt.Errorf("invalid stroke-miterlimit %q", a)
+		}
+		s.miterLimit = v
+	}
+
+	return nil
+}
+
+// stroke_paint returns the stop used for stroking with
+// the paint server id. Gradient strokes of n are approximated
+// with the color of their first stop.
+func (g *svgprog) stroke_paint(n Node, id string) (gradientStop, error) {
+	ref := g.ids[id]
+	if ref == nil || !is_gradient(ref) {
+		fmt.Fprintf(os.Stderr, "invalid stroke reference %q in %s\n", id, g.fn)
+		return gradientStop{}, nil
+	}
+
+	gr, err := g.resolve_gradient(ref)
+	if err != nil || len(gr.stops) == 0 {
+		return gradientStop{}, err
+	}
+
+	g.report(n, fmt.Sprintf("gradient stroke %q painted with solid color", id))
+	return gr.stops[0], nil
+}
+
+// handle_stroke emits the ops for the stroke style of the current path
+// that differ from the style already set in the program.
+func (g *svgprog) handle_stroke() {
+	s := g.stroke
+	if !g.stroke_visible() {
+		if g.progStroke.visible() {
+			g.mem.Byte(0x10)
+			g.progStroke.color = color.NRGBA{}
+		}
+		return
+	}
+
+	// Stroke width in view box units.
+	m := g.transform()
+	s.width *= math.Sqrt(math.Abs(m.Determinant()))
+
+	p := &g.progStroke
+	s.color = g.stroke_color()
+	if s.color != p.color || s.current != p.current {
+		g.paint_op(s.color, s.current, 0x11, 0x12, 0x17)
+		p.color, p.current = s.color, s.current
+	}
+	if s.width != p.width {
+		g.mem.Byte(0x13)
+		g.mem.Coord(s.width)
+		p.width = s.width
+	}
+	if s.cap != p.cap {
+		g.mem.Byte(0x14)
+		g.mem.Byte(s.cap)
+		p.cap = s.cap
+	}
+	if s.join != p.join {
+		g.mem.Byte(0x15)
+		g.mem.Byte(s.join)
+		p.join = s.join
+	}
+	if s.miterLimit != p.miterLimit {
+		g.mem.Byte(0x16)
+		g.mem.Coord(s.miterLimit)
+		p.miterLimit = s.miterLimit
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestStrokeColorOps(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">
+<g fill="none" stroke="#f00">
+<path d="M1 1 L15 1"/><path d="M1 3 L15 3" stroke-width="2"/>
+<path d="M1 5 L15 5" stroke="#00f"/><path d="M1 7 L15 7" stroke="#00f"/>
+</g></svg>`
+
+	fn := filepath.Join(t.TempDir(), "icon.svg")
+	if err := os.WriteFile(fn, []byte(doc), 0666); err != nil {
+		t.Fatal(err)
+	}
+	im, err := ProcSvg(fn, svgOpts{currentColor: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := iconpack.DecodeProgram(im.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for _, op := range prog.Ops {
+		switch op.Code {
+		case iconpack.OpSolidStroke, iconpack.OpPaletteStroke, iconpack.OpPaletteAlphaStroke:
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("got %d stroke color ops, want 2", n)
+	}
+}
+
+func TestStrokeWidth(t *testing.T) {
+	tests := []struct {
+		attr string
+		want float64
+	}{
+		{`stroke-width="2"`, 2},
+		{`stroke-width="2px"`, 2},
+		{`stroke-width="10%"`, 0.1 * math.Sqrt((30*30+40*40)/2.0)},
+		{`style="stroke-width: 20%"`, 0.2 * math.Sqrt((30*30+40*40)/2.0)},
+	}
+
+	for _, tt := range tests {
+		doc := `<svg xmlns="http://www.w3.org/2000/svg" width="30" height="40" viewBox="0 0 30 40">` +
+			`<g fill="none" stroke="#000" ` + tt.attr + `><path d="M1 1 L15 1"/></g></svg>`
+		prog := procTestSvg(t, doc, svgOpts{eps: 1e-4, currentColor: -1})
+
+		got := math.NaN()
+		for _, op := range prog.Ops {
+			if op.Code == iconpack.OpStrokeWidth {
+				got = op.Value
+			}
+		}
+		if math.Abs(got-tt.want) > 1e-3 {
+			t.Errorf("%s: got stroke width %g, want %g", tt.attr, got, tt.want)
+		}
+	}
+}
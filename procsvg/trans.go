@@ -119,6 +119,122 @@ func (m Matrix) Scale(sx, sy float64) Matrix {
 	}
 }
 
+func (m Matrix) SkewX(α float64) Matrix {
+	// b:
+	//   1  tanα  0    m₁₁ m₁₂ m₁₃
+	//   0    1   0    m₂₁ m₂₂ m₂₃
+	//   0    0   1    m₃₁ m₃₂ m₃₃
+
+	t := math.Tan(α * math.Pi / 180)
+
+	// c₁₁ = a₁₁
+	// c₂₁ = a₂₁
+	// c₁₂ = a₁₁tanα + a₁₂
+	// c₂₂ = a₂₁tanα + a₂₂
+	// c₁₃ = a₁₃
+	// c₂₃ = a₂₃
+	return Matrix{
+		m[0],
+		m[1],
+		m[0]*t + m[2],
+		m[1]*t + m[3],
+		m[4],
+		m[5],
+	}
+}
+
+func (m Matrix) SkewY(α float64) Matrix {
+	// b:
+	//    1   0  0    m₁₁ m₁₂ m₁₃
+	//  tanα  1  0    m₂₁ m₂₂ m₂₃
+	//    0   0  1    m₃₁ m₃₂ m₃₃
+
+	t := math.Tan(α * math.Pi / 180)
+
+	// c₁₁ = a₁₁ + a₁₂tanα
+	// c₂₁ = a₂₁ + a₂₂tanα
+	// c₁₂ = a₁₂
+	// c₂₂ = a₂₂
+	// c₁₃ = a₁₃
+	// c₂₃ = a₂₃
+	return Matrix{
+		m[0] + m[2]*t,
+		m[1] + m[3]*t,
+		m[2],
+		m[3],
+		m[4],
+		m[5],
+	}
+}
+
+// Determinant returns the determinant of m,
+// the factor m scales areas with.
+// It is negative if m mirrors.
+func (m Matrix) Determinant() float64 {
+	return m[0]*m[3] - m[1]*m[2]
+}
+
+// Invert returns the inverse of m,
+// or false if m is singular.
+func (m Matrix) Invert() (Matrix, bool) {
+	det := m.Determinant()
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return Matrix{}, false
+	}
+
+	// inverse of the linear part: [m₂₂ -m₁₂; -m₂₁ m₁₁] / det
+	a := m[3] / det
+	b := -m[1] / det
+	c := -m[2] / det
+	d := m[0] / det
+	return Matrix{
+		a,
+		b,
+		c,
+		d,
+		-(a*m[4] + c*m[5]),
+		-(b*m[4] + d*m[5]),
+	}, true
+}
+
+// MatrixParts are the parts of a decomposed Matrix.
+// Angles are in degrees.
+type MatrixParts struct {
+	TX, TY float64 // translation
+	Rotate float64
+	SkewX  float64
+	SX, SY float64 // scale; SY is negative if the matrix mirrors
+}
+
+// Matrix returns the matrix composed of the parts,
+// applying scale, skew, rotation and translation in this order.
+func (p MatrixParts) Matrix() Matrix {
+	return MatrixIdentity.Translate(p.TX, p.TY).Rotate(p.Rotate).SkewX(p.SkewX).Scale(p.SX, p.SY)
+}
+
+// Decompose splits m into parts, so that p.Matrix() equals m.
+// It returns false if m is singular.
+func (m Matrix) Decompose() (p MatrixParts, ok bool) {
+	det := m.Determinant()
+	sx := math.Hypot(m[0], m[1])
+	if sx == 0 || det == 0 {
+		return p, false
+	}
+
+	// Rotating the columns back by -θ gives
+	//   [sx  sy·tanφ]
+	//   [ 0  sy     ]
+	sy := det / sx
+	return MatrixParts{
+		TX:     m[4],
+		TY:     m[5],
+		Rotate: math.Atan2(m[1], m[0]) * 180 / math.Pi,
+		SkewX:  math.Atan((m[0]*m[2]+m[1]*m[3])/(sx*sy)) * 180 / math.Pi,
+		SX:     sx,
+		SY:     sy,
+	}, true
+}
+
 // SvgTransformMatrix creates a Matrix from an SVG transform attribute.
 func SvgTransformMatrix(svgtransform string) (Matrix, error) {
 	k := svgtrtok{p: svgtransform}
@@ -162,7 +278,17 @@ func SvgTransformMatrix(svgtransform string) (Matrix, error) {
 			if narg == 1 {
 				sy = sx
 			}
-			result.Scale(sx, sy)
+			result = result.Scale(sx, sy)
+
+		case "skewX", "skewY":
+			if narg != 1 {
+				return result, fmt.Errorf("%s must have 1 argument, got %d", k.fn, narg)
+			}
+			if k.fn == "skewX" {
+				result = result.SkewX(k.arg[0])
+			} else {
+				result = result.SkewY(k.arg[0])
+			}
 
 		default:
 			return result, fmt.Errorf("unknown function %q", k.fn)
@@ -187,8 +313,11 @@ func (k *svgtrtok) scan() bool {
 		return false
 	}
 
-	for k.ch() == ' ' {
+	k.skipwsp()
+	if k.ch() == ',' && k.fn != "" {
+		// comma between transforms
 		k.i++
+		k.skipwsp()
 	}
 
 	if k.ch() == -1 {
@@ -233,6 +362,17 @@ func (k *svgtrtok) chstr() string {
 	return fmt.Sprintf("%q", c)
 }
 
+func (k *svgtrtok) skipwsp() {
+	for {
+		switch k.ch() {
+		case ' ', '\t', '\n', '\r':
+			k.i++
+		default:
+			return
+		}
+	}
+}
+
 func (k *svgtrtok) parsefn() bool {
 	start := k.i
 
@@ -252,9 +392,7 @@ func (k *svgtrtok) parsefn() bool {
 
 	k.fn = k.p[start:k.i]
 
-	for k.ch() == ' ' {
-		k.i++
-	}
+	k.skipwsp()
 
 	if k.ch() != '(' {
 		k.err = fmt.Errorf("expected '(' after function name %q at %v, got %v", k.fn, start, k.chstr())
@@ -267,38 +405,59 @@ func (k *svgtrtok) parsefn() bool {
 }
 
 func (k *svgtrtok) parsearg() bool {
-	for k.ch() == ' ' {
+	k.skipwsp()
+
+	if k.ch() == ')' && len(k.arg) == 0 {
 		k.i++
+		return false
 	}
 
 	start := k.i
 
-	maybenum := func() bool {
+	isdigit := func() bool {
 		c := k.ch()
-		return c != ' ' && c != ',' && c != ')'
+		return '0' <= c && c <= '9'
+	}
+	digits := func() int {
+		n := 0
+		for isdigit() {
+			k.i++
+			n++
+		}
+		return n
 	}
 
-	for maybenum() {
+	// number: sign? digits? ('.' digits)? (('e'|'E') sign? digits)?
+	if c := k.ch(); c == '+' || c == '-' {
 		k.i++
 	}
-
-	if start == k.i {
-		k.err = fmt.Errorf("expected function argument at %v, got %v", start, k.chstr())
-		return false
+	n := digits()
+	if k.ch() == '.' {
+		k.i++
+		n += digits()
+	}
+	if c := k.ch(); n != 0 && (c == 'e' || c == 'E') {
+		k.i++
+		if c := k.ch(); c == '+' || c == '-' {
+			k.i++
+		}
+		digits()
 	}
 
 	sarg := k.p[start:k.i]
 	arg, err := strconv.ParseFloat(sarg, 64)
-	if err != nil {
-		k.err = fmt.Errorf("expected function argument at %v, got %q", start, sarg)
+	if n == 0 || err != nil {
+		if sarg == "" {
+			k.err = fmt.Errorf("expected function argument at %v, got %v", start, k.chstr())
+		} else {
+			k.err = fmt.Errorf("expected function argument at %v, got %q", start, sarg)
+		}
 		return false
 	}
 
 	k.arg = append(k.arg, arg)
 
-	for k.ch() == ' ' {
-		k.i++
-	}
+	k.skipwsp()
 
 	c := k.ch()
 	if c == ',' {
@@ -311,5 +470,10 @@ func (k *svgtrtok) parsearg() bool {
 		return false
 	}
 
+	if c == -1 {
+		k.err = fmt.Errorf("expected ')' after %q arguments", k.fn)
+		return false
+	}
+
 	return true // continue parsing
 }
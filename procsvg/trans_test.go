@@ -19,3 +19,141 @@ func TestSvgTransformMatrix(t *testing.T) {
 		}
 	}
 }
+
+func TestSvgTransformForms(t *testing.T) {
+	tests := []struct {
+		tr   string
+		want Matrix
+	}{
+		{"", MatrixIdentity},
+		{" \n ", MatrixIdentity},
+		{"matrix(1 2 3 4 5 6)", Matrix{1, 2, 3, 4, 5, 6}},
+		{"matrix(1,2,3,4,5,6)", Matrix{1, 2, 3, 4, 5, 6}},
+		{"matrix( 1, 2 ,3\n4\t5 , 6 )", Matrix{1, 2, 3, 4, 5, 6}},
+		{"translate(10)", Matrix{1, 0, 0, 1, 10, 0}},
+		{"translate(10 20)", Matrix{1, 0, 0, 1, 10, 20}},
+		{"translate(10,20)", Matrix{1, 0, 0, 1, 10, 20}},
+		{"translate(-10-20)", Matrix{1, 0, 0, 1, -10, -20}},
+		{"translate (+1e1, .5e+1)", Matrix{1, 0, 0, 1, 10, 5}},
+		{"scale(2)", Matrix{2, 0, 0, 2, 0, 0}},
+		{"scale(2 3)", Matrix{2, 0, 0, 3, 0, 0}},
+		{"scale(.5.25)", Matrix{.5, 0, 0, .25, 0, 0}},
+		{"scale(1E-1,-1)", Matrix{.1, 0, 0, -1, 0, 0}},
+		{"rotate(90)", Matrix{0, 1, -1, 0, 0, 0}},
+		{"rotate(90 10 10)", Matrix{0, 1, -1, 0, 20, 0}},
+		{"rotate(90,10,10)", Matrix{0, 1, -1, 0, 20, 0}},
+		{"skewX(45)", Matrix{1, 0, 1, 1, 0, 0}},
+		{"skewY(45)", Matrix{1, 1, 0, 1, 0, 0}},
+		{"skewX(-45)", Matrix{1, 0, -1, 1, 0, 0}},
+		{"translate(10,20) scale(2)", Matrix{2, 0, 0, 2, 10, 20}},
+		{"translate(10,20),scale(2)", Matrix{2, 0, 0, 2, 10, 20}},
+		{"translate(10,20) , scale(2)", Matrix{2, 0, 0, 2, 10, 20}},
+		{"\ttranslate(10 20)\n\tscale(2) ", Matrix{2, 0, 0, 2, 10, 20}},
+		{"translate(10,20)scale(2)", Matrix{2, 0, 0, 2, 10, 20}},
+		{"scale(2) translate(10,20)", Matrix{2, 0, 0, 2, 20, 40}},
+		{"skewX(45) scale(2,3)", Matrix{2, 0, 3, 3, 0, 0}},
+		{"scale(2,3) skewY(45)", Matrix{2, 3, 0, 3, 0, 0}},
+		{"rotate(90) skewX(45)", Matrix{0, 1, -1, 1, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		m, err := SvgTransformMatrix(tt.tr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.tr, err)
+			continue
+		}
+		if !matrix_near(m, tt.want, 1e-9) {
+			t.Errorf("%q: got %v, want %v", tt.tr, m, tt.want)
+		}
+	}
+
+	for _, s := range []string{
+		"foo(1)",
+		"scale()",
+		"scale(1,)",
+		"matrix(1 2)",
+		"rotate(1 2)",
+		"skewX(1 2)",
+		"skewY()",
+		"translate(1",
+		"translate(1 x)",
+		",scale(2)",
+		"scale(2),,scale(2)",
+		"scale(2) scale",
+		"scale(--1)",
+	} {
+		if _, err := SvgTransformMatrix(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+func TestMatrixInvertDecompose(t *testing.T) {
+	for _, s := range []string{
+		"matrix(1 2 3 4 5 6)",
+		"translate(10,20) rotate(30) skewX(20) scale(2,3)",
+		"rotate(-120 5 5) scale(-1,1)",
+		"skewY(30) translate(-4)",
+		"scale(0.001)",
+	} {
+		m, err := SvgTransformMatrix(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inv, ok := m.Invert()
+		if !ok {
+			t.Errorf("%q: not invertible", s)
+			continue
+		}
+		if id := m.Mul(inv); !matrix_near(id, MatrixIdentity, 1e-9) {
+			t.Errorf("%q: m×inv = %v", s, id)
+		}
+		if id := inv.Mul(m); !matrix_near(id, MatrixIdentity, 1e-9) {
+			t.Errorf("%q: inv×m = %v", s, id)
+		}
+		if d := m.Determinant() * inv.Determinant(); math.Abs(d-1) > 1e-9 {
+			t.Errorf("%q: det×inv det = %v", s, d)
+		}
+
+		p, ok := m.Decompose()
+		if !ok {
+			t.Errorf("%q: decompose failed", s)
+			continue
+		}
+		if r := p.Matrix(); !matrix_near(r, m, 1e-9) {
+			t.Errorf("%q: decomposed %+v gives %v, want %v", s, p, r, m)
+		}
+	}
+
+	p, _ := MatrixIdentity.Translate(1, 2).Rotate(30).SkewX(20).Scale(2, -3).Decompose()
+	want := MatrixParts{TX: 1, TY: 2, Rotate: 30, SkewX: 20, SX: 2, SY: -3}
+	for _, v := range [][2]float64{
+		{p.TX, want.TX}, {p.TY, want.TY},
+		{p.Rotate, want.Rotate}, {p.SkewX, want.SkewX},
+		{p.SX, want.SX}, {p.SY, want.SY},
+	} {
+		if math.Abs(v[0]-v[1]) > 1e-9 {
+			t.Errorf("decompose: got %+v, want %+v", p, want)
+			break
+		}
+	}
+
+	for _, m := range []Matrix{{}, {1, 2, 2, 4, 5, 6}, {0, 0, 1, 1, 0, 0}} {
+		if _, ok := m.Invert(); ok {
+			t.Errorf("%v: inverted singular matrix", m)
+		}
+		if _, ok := m.Decompose(); ok {
+			t.Errorf("%v: decomposed singular matrix", m)
+		}
+	}
+}
+
+func matrix_near(a, b Matrix, tol float64) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > tol {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	const defs = `<defs><path id="p" d="M0 0 L2 0 L0 2"/></defs>
+<symbol id="s" viewBox="0 0 2 2"><path d="M0 0 L2 0 L0 2"/></symbol>
+<symbol id="t"><path d="M1 1 L3 1 L1 3"/></symbol>`
+
+	tests := []struct {
+		elem string
+		want string
+	}{
+		{``, ""},
+		{`<use href="#p"/>`,
+			"SetSolidFill #000000ff BeginMoveTo 0,0 HLineTo 2,0 LineTo 0,2"},
+		{`<use href="#p" x="1" y="2" transform="scale(2)"/>`,
+			"SetSolidFill #000000ff BeginMoveTo 2,4 HLineTo 6,4 LineTo 2,8"},
+		{`<use xlink:href="#p" x="1"/>`,
+			"SetSolidFill #000000ff BeginMoveTo 1,0 HLineTo 3,0 LineTo 1,2"},
+		{`<use href="#s" x="4" y="4" width="8" height="8"/>`,
+			"SetSolidFill #000000ff BeginMoveTo 4,4 HLineTo 12,4 LineTo 4,12"},
+		{`<use href="#s"/>`,
+			"SetSolidFill #000000ff BeginMoveTo 0,0 HLineTo 16,0 LineTo 0,16"},
+		{`<use href="#t" x="2" width="4" height="4"/>`,
+			"SetSolidFill #000000ff BeginMoveTo 3,1 HLineTo 5,1 LineTo 3,3"},
+		{`<use href="#p" fill="#f00" stroke="#00f"/>`,
+			"SetSolidFill #ff0000ff SetSolidStroke #0000ffff BeginMoveTo 0,0 HLineTo 2,0 LineTo 0,2"},
+		{`<g fill="#f00"><use href="#p"/></g>`,
+			"SetSolidFill #ff0000ff BeginMoveTo 0,0 HLineTo 2,0 LineTo 0,2"},
+		{`<use href="#missing"/>`, ""},
+	}
+
+	for _, tt := range tests {
+		doc := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"` +
+			` width="16" height="16" viewBox="0 0 16 16">` + defs + tt.elem + `</svg>`
+		prog := procTestSvg(t, doc, svgOpts{currentColor: -1})
+		if got := fmtOps(prog); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.elem, got, tt.want)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, doc := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">` +
+			`<g id="a"><use href="#a"/></g></svg>`,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16">` +
+			`<defs><g id="a"><use href="#b"/></g><g id="b"><use href="#a"/></g></defs><use href="#a"/></svg>`,
+	} {
+		fn := filepath.Join(dir, "icon.svg")
+		if err := os.WriteFile(fn, []byte(doc), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ProcSvg(fn, svgOpts{currentColor: -1}); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
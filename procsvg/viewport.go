@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Missing view box and image size inference modes used in project files.
+const (
+	InferViewBoxSize   = "size"
+	InferViewBoxBounds = "bounds"
+	InferSizeViewBox   = "viewbox"
+	InferError         = "error"
+)
+
+// parse_viewbox parses a viewBox attribute value
+// as min-x, min-y, width and height.
+func parse_viewbox(s string) ([4]float64, error) {
+	var vb [4]float64
+	f := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(f) != 4 {
+		return vb, fmt.Errorf("error parsing viewBox %q", s)
+	}
+	for i, x := range f {
+		v, err := strconv.ParseFloat(x, 64)
+		if err != nil {
+			return vb, fmt.Errorf("error parsing viewBox %q", s)
+		}
+		vb[i] = v
+	}
+	if vb[2] < 0 || vb[3] < 0 {
+		return vb, fmt.Errorf("negative viewBox size %q", s)
+	}
+	return vb, nil
+}
+
+// viewbox_transform returns the transformation mapping view box vb
+// into the w×h viewport at the origin according to the
+// preserveAspectRatio attribute value par.
+func viewbox_transform(vb [4]float64, w, h float64, par string) (Matrix, error) {
+	if vb[2] == 0 || vb[3] == 0 {
+		return MatrixIdentity.Scale(0, 0), nil
+	}
+
+	align, slice := "xMidYMid", false
+	f := strings.Fields(par)
+	if len(f) != 0 && f[0] == "defer" {
+		f = f[1:]
+	}
+	if len(f) > 2 {
+		return Matrix{}, fmt.Errorf("invalid preserveAspectRatio %q", par)
+	}
+	if len(f) > 0 {
+		align = f[0]
+	}
+	if len(f) > 1 {
+		switch f[1] {
+		case "meet":
+		case "slice":
+			slice = true
+		default:
+			return Matrix{}, fmt.Errorf("invalid preserveAspectRatio %q", par)
+		}
+	}
+
+	sx, sy := w/vb[2], h/vb[3]
+	var tx, ty float64
+	if align != "none" {
+		if len(align) != 8 {
+			return Matrix{}, fmt.Errorf("invalid preserveAspectRatio %q", par)
+		}
+		ax, okx := align_factor(align[1:4])
+		ay, oky := align_factor(align[5:])
+		if align[0] != 'x' || align[4] != 'Y' || !okx || !oky {
+			return Matrix{}, fmt.Errorf("invalid preserveAspectRatio %q", par)
+		}
+
+		s := sx
+		if (sy < sx) != slice {
+			s = sy
+		}
+		sx, sy = s, s
+		tx = (w - vb[2]*s) * ax
+		ty = (h - vb[3]*s) * ay
+	}
+
+	return MatrixIdentity.Translate(tx, ty).Scale(sx, sy).Translate(-vb[0], -vb[1]), nil
+}
+
+// align_factor returns the alignment factor of
+// Min, Mid or Max in preserveAspectRatio values.
+func align_factor(s string) (float64, bool) {
+	switch s {
+	case "Min":
+		return 0, true
+	case "Mid":
+		return 0.5, true
+	case "Max":
+		return 1, true
+	}
+	return 0, false
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+func TestViewboxTransform(t *testing.T) {
+	tests := []struct {
+		vb   string
+		w, h float64
+		par  string
+		want Matrix
+	}{
+		{"0 0 10 10", 20, 20, "", Matrix{2, 0, 0, 2, 0, 0}},
+		{"5,5,10,10", 10, 10, "", Matrix{1, 0, 0, 1, -5, -5}},
+		{"0 0 10 10", 40, 20, "", Matrix{2, 0, 0, 2, 10, 0}},
+		{"0 0 10 10", 40, 20, "xMinYMin", Matrix{2, 0, 0, 2, 0, 0}},
+		{"0 0 10 10", 40, 20, "xMaxYMax meet", Matrix{2, 0, 0, 2, 20, 0}},
+		{"0 0 10 10", 40, 20, "xMidYMid slice", Matrix{4, 0, 0, 4, 0, -10}},
+		{"0 0 10 10", 40, 20, "none", Matrix{4, 0, 0, 2, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		vb, err := parse_viewbox(tt.vb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := viewbox_transform(vb, tt.w, tt.h, tt.par)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range m {
+			if math.Abs(m[i]-tt.want[i]) > 1e-9 {
+				t.Errorf("%q %gx%g %q: got %v, want %v", tt.vb, tt.w, tt.h, tt.par, m, tt.want)
+				break
+			}
+		}
+	}
+
+	for _, s := range []string{"0 0 10", "0 0 a 1", "0 0 -1 1"} {
+		if _, err := parse_viewbox(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+	for _, par := range []string{"xMidYmid", "xMidYMid clip", "center"} {
+		if _, err := viewbox_transform([4]float64{0, 0, 1, 1}, 1, 1, par); err == nil {
+			t.Errorf("%q: no error", par)
+		}
+	}
+}
+
+func TestSvgLength(t *testing.T) {
+	tests := []struct {
+		attr string
+		def  string
+		want float64
+	}{
+		{`width="24"`, "", 24},
+		{`width="24.5px"`, "", 24.5},
+		{`width="12pt"`, "", 16},
+		{`width="1pc"`, "", 16},
+		{`width="25.4mm"`, "", 96},
+		{`width="50%"`, "", 10},
+		{``, "100%", 20},
+		{``, "0", 0},
+	}
+
+	for _, tt := range tests {
+		var n Node
+		if err := xml.Unmarshal([]byte("<svg "+tt.attr+"/>"), (*xmlNode)(&n)); err != nil {
+			t.Fatal(err)
+		}
+		v, err := svg_length(n, "width", tt.def, 20)
+		if err != nil {
+			t.Errorf("%s: %v", tt.attr, err)
+			continue
+		}
+		if math.Abs(v-tt.want) > 1e-9 {
+			t.Errorf("%s: got %g, want %g", tt.attr, v, tt.want)
+		}
+	}
+
+	for _, attr := range []string{``, `width="1x"`, `width="%"`} {
+		var n Node
+		if err := xml.Unmarshal([]byte("<svg "+attr+"/>"), (*xmlNode)(&n)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svg_length(n, "width", "", 20); err == nil {
+			t.Errorf("%s: no error", attr)
+		}
+	}
+}
+
+func TestRootViewBox(t *testing.T) {
+	const shapes = `<defs><rect x="-100" y="-100" width="1" height="1"/></defs>
+<g transform="translate(2,1)"><rect width="10" height="5"/><circle cx="10" cy="10" r="2"/></g>`
+
+	tests := []struct {
+		attr    string
+		viewBox string // inference mode
+		size    string
+		want    string // image size and program view box
+	}{
+		{`width="24" height="16" viewBox="0 0 12 8"`, "error", "error", "24×16 {0 0} {12 8}"},
+		{`width="24" height="16"`, "size", "error", "24×16 {0 0} {24 16}"},
+		{`width="18pt" height="16"`, "size", "error", "24×16 {0 0} {24 16}"},
+		{`width="24" height="16"`, "bounds", "error", "24×16 {-1 1} {17 13}"},
+		{`width="100%" height="16"`, "size", "error", "12×16 {2 -1} {14 15}"},
+		{`viewBox="0 0 12 8"`, "error", "viewbox", "12×8 {0 0} {12 8}"},
+		{`width="24" viewBox="0 0 12 8"`, "error", "viewbox", "24×16 {0 0} {12 8}"},
+		{`height="4" viewBox="0 0 12 8"`, "error", "viewbox", "6×4 {0 0} {12 8}"},
+		{``, "size", "viewbox", "12×12 {2 1} {14 13}"},
+	}
+
+	for _, tt := range tests {
+		n, err := xmlTree(strings.NewReader("<svg " + tt.attr + ">" + shapes + "</svg>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g := svgprog{inferViewBox: tt.viewBox, inferSize: tt.size}
+		if err := g.svg(n); err != nil {
+			t.Errorf("%s: %v", tt.attr, err)
+			continue
+		}
+		got := fmt.Sprintf("%d×%d %g %g", g.im.Width, g.im.Height, g.viewbox[0], g.viewbox[1])
+		if got != tt.want {
+			t.Errorf("%s %s %s: got %s, want %s", tt.attr, tt.viewBox, tt.size, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ attr, viewBox, size string }{
+		{`width="24" height="16"`, "error", "viewbox"},
+		{`width="24" viewBox="0 0 12 8"`, "size", "error"},
+		{`viewBox="0 0 12 8"`, "size", "error"},
+	} {
+		var n Node
+		if err := xml.Unmarshal([]byte("<svg "+tt.attr+"/>"), (*xmlNode)(&n)); err != nil {
+			t.Fatal(err)
+		}
+		g := svgprog{inferViewBox: tt.viewBox, inferSize: tt.size}
+		if err := g.svg(n); err == nil {
+			t.Errorf("%s %s %s: no error", tt.attr, tt.viewBox, tt.size)
+		}
+	}
+
+	n, err := xmlTree(strings.NewReader("<svg><defs>" + shapes + "</defs></svg>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := svgprog{inferViewBox: InferViewBoxBounds, inferSize: InferSizeViewBox}
+	if err := g.svg(n); err == nil {
+		t.Error("empty image: no error")
+	}
+}
+
+func TestPixelPrecision(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 64 64">
+<rect x="8" y="4.5" width="32.2" height="48" fill="#000"/></svg>`
+
+	fn := filepath.Join(t.TempDir(), "icon.svg")
+	if err := os.WriteFile(fn, []byte(doc), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		scale   bool
+		prec    float64
+		viewBox iconpack.Rect
+		pts     []iconpack.Point
+	}{
+		{false, 0.25, iconpack.Rect{Max: iconpack.Point{X: 64, Y: 64}},
+			[]iconpack.Point{{X: 8, Y: 4.5}, {X: 40.25, Y: 4.5}, {X: 40.25, Y: 52.5}, {X: 8, Y: 52.5}}},
+		{true, 1.0 / 16, iconpack.Rect{Max: iconpack.Point{X: 16, Y: 16}},
+			[]iconpack.Point{{X: 2, Y: 1.125}, {X: 10.0625, Y: 1.125}, {X: 10.0625, Y: 13.125}, {X: 2, Y: 13.125}}},
+	}
+	for _, tt := range tests {
+		im, err := ProcSvg(fn, svgOpts{
+			eps:          1e-4,
+			pixelPrec:    1.0 / 16,
+			scaleViewBox: tt.scale,
+			currentColor: -1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := iconpack.DecodeProgram(im.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prog.ViewBox != tt.viewBox {
+			t.Errorf("scale %v: got view box %v, want %v", tt.scale, prog.ViewBox, tt.viewBox)
+		}
+		var pts []iconpack.Point
+		for _, op := range prog.Ops {
+			pts = append(pts, op.Pt...)
+		}
+		if len(pts) != len(tt.pts) {
+			t.Fatalf("scale %v: got points %v, want %v", tt.scale, pts, tt.pts)
+		}
+		for i, p := range pts {
+			if math.Abs(p.X-tt.pts[i].X) > tt.prec || math.Abs(p.Y-tt.pts[i].Y) > tt.prec {
+				t.Errorf("scale %v: got points %v, want %v", tt.scale, pts, tt.pts)
+				break
+			}
+		}
+	}
+}
+
+func TestProcSvgViewBoxError(t *testing.T) {
+	dir := t.TempDir()
+	for i, doc := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 a 16"/>`,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16" viewBox="0 0 16 16" preserveAspectRatio="center"/>`,
+		`<g xmlns="http://www.w3.org/2000/svg"/>`,
+	} {
+		fn := filepath.Join(dir, fmt.Sprintf("icon%d.svg", i))
+		if err := os.WriteFile(fn, []byte(doc), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ProcSvg(fn, svgOpts{currentColor: -1}); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
+
+func TestProcSvgInferError(t *testing.T) {
+	dir := t.TempDir()
+	for i, tt := range []struct{ doc, viewBox, size string }{
+		{`<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16"/>`, InferError, InferSizeViewBox},
+		{`<svg xmlns="http://www.w3.org/2000/svg"/>`, InferViewBoxBounds, InferSizeViewBox},
+		{`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16"/>`, InferViewBoxSize, InferError},
+	} {
+		fn := filepath.Join(dir, fmt.Sprintf("icon%d.svg", i))
+		if err := os.WriteFile(fn, []byte(tt.doc), 0666); err != nil {
+			t.Fatal(err)
+		}
+		opts := svgOpts{currentColor: -1, inferViewBox: tt.viewBox, inferSize: tt.size}
+		if _, err := ProcSvg(fn, opts); err == nil {
+			t.Errorf("%s %s %s: no error", tt.doc, tt.viewBox, tt.size)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package raster
+
+import (
+	"math"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+// flattenArc appends the line segment approximation of the elliptical
+// arc a from p0 to p1 to pts. The arc end points are in view box
+// coordinates, the appended points are transformed with view.
+// The arc parameters are corrected as specified by SVG.
+func flattenArc(pts []point, view affine, p0, p1 iconpack.Point, a iconpack.Arc) []point {
+	if p0 == p1 {
+		return pts
+	}
+
+	end := view.apply(point{p1.X, p1.Y})
+	rx, ry := math.Abs(a.Radius.X), math.Abs(a.Radius.Y)
+	if rx == 0 || ry == 0 {
+		return append(pts, end)
+	}
+
+	sinφ, cosφ := math.Sincos(a.Rotation * math.Pi / 180)
+
+	// end point to center parametrization
+	dx, dy := (p0.X-p1.X)/2, (p0.Y-p1.Y)/2
+	x1 := cosφ*dx + sinφ*dy
+	y1 := -sinφ*dx + cosφ*dy
+
+	if λ := x1*x1/(rx*rx) + y1*y1/(ry*ry); λ > 1 {
+		s := math.Sqrt(λ)
+		rx, ry = rx*s, ry*s
+	}
+
+	var k float64
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	if den := rx*rx*y1*y1 + ry*ry*x1*x1; num > 0 {
+		k = math.Sqrt(num / den)
+	}
+	if a.LargeArc == a.Sweep {
+		k = -k
+	}
+	cx1, cy1 := k*rx*y1/ry, -k*ry*x1/rx
+	cx := cosφ*cx1 - sinφ*cy1 + (p0.X+p1.X)/2
+	cy := sinφ*cx1 + cosφ*cy1 + (p0.Y+p1.Y)/2
+
+	θ1 := math.Atan2((y1-cy1)/ry, (x1-cx1)/rx)
+	dθ := math.Atan2((-y1-cy1)/ry, (-x1-cx1)/rx) - θ1
+	if a.Sweep && dθ < 0 {
+		dθ += 2 * math.Pi
+	} else if !a.Sweep && dθ > 0 {
+		dθ -= 2 * math.Pi
+	}
+
+	// Use segments with a sagitta below flatness in pixels.
+	r := math.Max(rx, ry) * math.Max(math.Hypot(view[0], view[1]), math.Hypot(view[2], view[3]))
+	n := 1
+	if r > flatness {
+		step := 2 * math.Acos(1-flatness/r)
+		n = segments(math.Pow(math.Abs(dθ)/step, 2))
+	}
+
+	for i := 1; i < n; i++ {
+		θ := θ1 + dθ*float64(i)/float64(n)
+		ex, ey := rx*math.Cos(θ), ry*math.Sin(θ)
+		pts = append(pts, view.apply(point{
+			x: cosφ*ex - sinφ*ey + cx,
+			y: sinφ*ex + cosφ*ey + cy,
+		}))
+	}
+	return append(pts, end)
+}
@@ -0,0 +1,179 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+// affine is a 2D affine transformation in iconpack.Gradient.Matrix order.
+type affine [6]float64
+
+func (m affine) apply(p point) point {
+	return point{
+		x: m[0]*p.x + m[2]*p.y + m[4],
+		y: m[1]*p.x + m[3]*p.y + m[5],
+	}
+}
+
+// mul returns the transformation applying b then m.
+func (m affine) mul(b affine) affine {
+	return affine{
+		m[0]*b[0] + m[2]*b[1],
+		m[1]*b[0] + m[3]*b[1],
+		m[0]*b[2] + m[2]*b[3],
+		m[1]*b[2] + m[3]*b[3],
+		m[0]*b[4] + m[2]*b[5] + m[4],
+		m[1]*b[4] + m[3]*b[5] + m[5],
+	}
+}
+
+// invert returns the inverse of m.
+// It returns false if m is not invertible.
+func (m affine) invert() (affine, bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 || math.IsNaN(det) {
+		return affine{}, false
+	}
+	a, b, c, d := m[3]/det, -m[1]/det, -m[2]/det, m[0]/det
+	return affine{
+		a, b, c, d,
+		-(a*m[4] + c*m[5]),
+		-(b*m[4] + d*m[5]),
+	}, true
+}
+
+// gradient is an image.Image painting a gradient.
+type gradient struct {
+	inv    affine // pixel to gradient space
+	radial bool
+	focal  point // radial focal point in gradient space
+	spread iconpack.Spread
+	stops  []gradientStop
+}
+
+type gradientStop struct {
+	offset float64
+	c      color.RGBA // premultiplied
+}
+
+// newGradient returns the paint of gradient op.
+// The view affine maps view box coordinates to pixels.
+// It returns a nil image if the gradient paints nothing.
+func newGradient(op iconpack.Op, view affine, pal iconpack.Palette) (image.Image, error) {
+	gr := op.Gradient
+
+	g := &gradient{
+		radial: op.Code == iconpack.OpRadialGradient,
+		spread: gr.Spread,
+	}
+
+	for _, s := range gr.Stops {
+		c := s.Color
+		if s.Palette {
+			if s.Index >= len(pal) {
+				return nil, &iconpack.PaletteIndexError{Pos: op.Pos, Index: s.Index}
+			}
+			c = pal[s.Index]
+			c.A = uint8((int(c.A)*int(s.Color.A) + 0x7f) / 0xff)
+		}
+		off := s.Offset
+		if n := len(g.stops); n != 0 && off < g.stops[n-1].offset {
+			off = g.stops[n-1].offset
+		}
+		g.stops = append(g.stops, gradientStop{
+			offset: off,
+			c:      color.RGBAModel.Convert(c).(color.RGBA),
+		})
+	}
+
+	m := view.mul(affine(gr.Matrix))
+	inv, ok := m.invert()
+	if !ok {
+		return nil, nil
+	}
+	g.inv = inv
+
+	if g.radial {
+		g.focal = inv.apply(view.apply(point{gr.Focal.X, gr.Focal.Y}))
+	}
+
+	return g, nil
+}
+
+func (g *gradient) ColorModel() color.Model { return color.RGBAModel }
+
+func (g *gradient) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+
+func (g *gradient) At(x, y int) color.Color {
+	u := g.inv.apply(point{float64(x) + 0.5, float64(y) + 0.5})
+
+	var t float64
+	if g.radial {
+		t = g.radialOffset(u)
+	} else {
+		t = u.x
+	}
+
+	switch g.spread {
+	case iconpack.SpreadRepeat:
+		t -= math.Floor(t)
+	case iconpack.SpreadReflect:
+		t = math.Abs(t - 2*math.Floor(t/2+0.5))
+	}
+
+	return g.color(t)
+}
+
+// radialOffset returns the gradient offset of u,
+// relative to the distance from the focal point
+// to the unit circle along the ray through u.
+func (g *gradient) radialOffset(u point) float64 {
+	f := g.focal
+	w := u.sub(f)
+	ww := w.dot(w)
+	if ww == 0 {
+		return 0
+	}
+
+	// solve |f + k×w| = 1 for k > 0
+	b := f.dot(w)
+	c := f.dot(f) - 1
+	disc := b*b - ww*c
+	if disc < 0 {
+		return 1
+	}
+	k := (-b + math.Sqrt(disc)) / ww
+	if k <= 0 {
+		return 1
+	}
+	return 1 / k
+}
+
+// color returns the interpolated color at offset t.
+func (g *gradient) color(t float64) color.RGBA {
+	s := g.stops
+	if t <= s[0].offset {
+		return s[0].c
+	}
+	for i := 1; i < len(s); i++ {
+		if t < s[i].offset {
+			a, b := s[i-1], s[i]
+			f := (t - a.offset) / (b.offset - a.offset)
+			mix := func(x, y uint8) uint8 {
+				return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5)
+			}
+			return color.RGBA{
+				mix(a.c.R, b.c.R),
+				mix(a.c.G, b.c.G),
+				mix(a.c.B, b.c.B),
+				mix(a.c.A, b.c.A),
+			}
+		}
+	}
+	return s[len(s)-1].c
+}
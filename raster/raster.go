@@ -0,0 +1,357 @@
+// Package raster renders icon pack programs into images.
+//
+// Paths are rasterized with anti-aliasing using exact horizontal
+// and subsampled vertical pixel coverage.
+package raster
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+// Options specify rendering options.
+type Options struct {
+	// Palette is used to look up colors of palette fill ops.
+	Palette iconpack.Palette
+}
+
+// Render renders the variant of icon ic best fitting dx×dy pixels
+// into a new dx×dy image using palette pal.
+func Render(ic *iconpack.Icon, dx, dy int, pal iconpack.Palette) (*image.RGBA, error) {
+	v := ic.Variant(dx, dy)
+	if v == nil {
+		return nil, fmt.Errorf("raster: icon %q has no images", ic.Name)
+	}
+
+	prog, err := v.Program()
+	if err != nil {
+		return nil, err
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, dx, dy))
+	err = Draw(m, m.Bounds(), prog, &Options{Palette: pal})
+	return m, err
+}
+
+// Draw paints prog over rectangle r of dst.
+// The program view box is mapped onto r.
+func Draw(dst draw.Image, r image.Rectangle, prog *iconpack.Program, opts *Options) error {
+	if opts == nil {
+		opts = new(Options)
+	}
+
+	vb := prog.ViewBox
+	if vb.Dx() <= 0 || vb.Dy() <= 0 || r.Empty() {
+		return nil
+	}
+
+	sx := float64(r.Dx()) / vb.Dx()
+	sy := float64(r.Dy()) / vb.Dy()
+
+	p := painter{
+		dst:  dst,
+		clip: r.Intersect(dst.Bounds()),
+		view: affine{
+			sx, 0, 0, sy,
+			float64(r.Min.X) - vb.Min.X*sx,
+			float64(r.Min.Y) - vb.Min.Y*sy,
+		},
+		scale: math.Sqrt(sx * sy),
+		fill:  image.NewUniform(color.NRGBA{0, 0, 0, 0xff}),
+		style: strokeStyle{
+			width:      1,
+			miterLimit: 4,
+		},
+	}
+
+	palette := func(op iconpack.Op) (image.Image, error) {
+		if op.Index >= len(opts.Palette) {
+			return nil, &iconpack.PaletteIndexError{Pos: op.Pos, Index: op.Index}
+		}
+		c := opts.Palette[op.Index]
+		if op.Code == iconpack.OpPaletteAlphaFill || op.Code == iconpack.OpPaletteAlphaStroke {
+			c.A = uint8((int(c.A)*int(op.Color.A) + 0x7f) / 0xff)
+		}
+		return image.NewUniform(c), nil
+	}
+
+	for _, op := range prog.Ops {
+		if op.Code < iconpack.OpBeginMoveTo {
+			p.paint()
+			p.endClip()
+		}
+
+		var err error
+		switch op.Code {
+
+		case iconpack.OpSolidFill:
+			p.fill = image.NewUniform(op.Color)
+
+		case iconpack.OpPaletteFill, iconpack.OpPaletteAlphaFill:
+			p.fill, err = palette(op)
+
+		case iconpack.OpNoFill:
+			p.fill = nil
+
+		case iconpack.OpLinearGradient, iconpack.OpRadialGradient:
+			p.fill, err = newGradient(op, p.view, opts.Palette)
+
+		case iconpack.OpFillRule:
+			p.fillRule = iconpack.FillRule(op.Mode)
+
+		case iconpack.OpSolidStroke:
+			p.stroke = image.NewUniform(op.Color)
+
+		case iconpack.OpPaletteStroke, iconpack.OpPaletteAlphaStroke:
+			p.stroke, err = palette(op)
+
+		case iconpack.OpNoStroke:
+			p.stroke = nil
+
+		case iconpack.OpStrokeWidth:
+			p.style.width = op.Value
+
+		case iconpack.OpLineCap:
+			p.style.cap = iconpack.LineCap(op.Mode)
+
+		case iconpack.OpLineJoin:
+			p.style.join = iconpack.LineJoin(op.Mode)
+
+		case iconpack.OpMiterLimit:
+			p.style.miterLimit = op.Value
+
+		case iconpack.OpPushClip:
+			p.clipStack = append(p.clipStack, p.clipMask)
+			p.clipRule = iconpack.FillRule(op.Mode)
+			p.clipAcc = image.NewAlpha(p.clip)
+
+		case iconpack.OpPopClip:
+			n := len(p.clipStack)
+			p.clipMask = p.clipStack[n-1]
+			p.clipStack = p.clipStack[:n-1]
+
+		case iconpack.OpBeginMoveTo:
+			p.paint()
+			p.moveTo(op.Pt[0])
+
+		case iconpack.OpMoveTo:
+			p.moveTo(op.Pt[0])
+
+		case iconpack.OpClosePath:
+			p.closed[len(p.closed)-1] = true
+
+		case iconpack.OpLineTo, iconpack.OpRelLineTo,
+			iconpack.OpHLineTo, iconpack.OpVLineTo,
+			iconpack.OpRelHLineTo, iconpack.OpRelVLineTo:
+			for _, pt := range op.Pt {
+				p.lineTo(pt)
+			}
+
+		case iconpack.OpCubicBezierTo, iconpack.OpRelCubicBezierTo:
+			for i := 0; i < len(op.Pt); i += 3 {
+				p.cubicTo(op.Pt[i], op.Pt[i+1], op.Pt[i+2])
+			}
+
+		case iconpack.OpQuadraticBezierTo, iconpack.OpRelQuadraticBezierTo:
+			for i := 0; i < len(op.Pt); i += 2 {
+				p.quadTo(op.Pt[i], op.Pt[i+1])
+			}
+
+		case iconpack.OpArcTo:
+			for i, pt := range op.Pt {
+				p.arcTo(op.Arc[i], pt)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	p.paint()
+	p.endClip()
+	return nil
+}
+
+// painter accumulates the current path and paints it using
+// the current fill and stroke.
+type painter struct {
+	dst  draw.Image
+	clip image.Rectangle
+
+	view  affine  // view box to pixel transformation
+	scale float64 // stroke width scale
+
+	fill     image.Image // nil if filling is disabled
+	fillRule iconpack.FillRule
+	stroke   image.Image // nil if stroking is disabled
+	style    strokeStyle // stroke style in view box units
+
+	// clipMask is the coverage of the clip region within clip,
+	// or nil if painting is not clipped.
+	clipMask  *image.Alpha
+	clipStack []*image.Alpha // clip masks saved by PushClip
+
+	// clipAcc is the union of clip paths after PushClip,
+	// it is nil unless clip paths are being collected.
+	clipAcc  *image.Alpha
+	clipRule iconpack.FillRule
+
+	// flattened subpaths of the current path in pixel coordinates
+	path   [][]point
+	closed []bool // subpaths closed by ClosePath
+
+	// start and current point of the
+	// current subpath in view box coordinates
+	start, last iconpack.Point
+
+	z rasterizer
+}
+
+func (p *painter) xform(pt iconpack.Point) point {
+	return p.view.apply(point{pt.X, pt.Y})
+}
+
+func (p *painter) moveTo(pt iconpack.Point) {
+	p.path = append(p.path, []point{p.xform(pt)})
+	p.closed = append(p.closed, false)
+	p.start, p.last = pt, pt
+}
+
+// subpath returns the current subpath.
+func (p *painter) subpath() *[]point {
+	n := len(p.path)
+	if p.closed[n-1] {
+		// Drawing after ClosePath starts a new subpath
+		// at the start point of the closed one.
+		p.path = append(p.path, []point{p.path[n-1][0]})
+		p.closed = append(p.closed, false)
+		p.last = p.start
+		n++
+	}
+	return &p.path[n-1]
+}
+
+func (p *painter) lineTo(pt iconpack.Point) {
+	sp := p.subpath()
+	*sp = append(*sp, p.xform(pt))
+	p.last = pt
+}
+
+func (p *painter) quadTo(p1, p2 iconpack.Point) {
+	sp := p.subpath()
+	*sp = flattenQuad(*sp, p.xform(p1), p.xform(p2))
+	p.last = p2
+}
+
+func (p *painter) cubicTo(p1, p2, p3 iconpack.Point) {
+	sp := p.subpath()
+	*sp = flattenCubic(*sp, p.xform(p1), p.xform(p2), p.xform(p3))
+	p.last = p3
+}
+
+func (p *painter) arcTo(a iconpack.Arc, pt iconpack.Point) {
+	sp := p.subpath()
+	*sp = flattenArc(*sp, p.view, p.last, pt, a)
+	p.last = pt
+}
+
+// paint fills and strokes the current path and starts a new one.
+func (p *painter) paint() {
+	if len(p.path) == 0 {
+		return
+	}
+	defer func() {
+		p.path = p.path[:0]
+		p.closed = p.closed[:0]
+	}()
+
+	if p.clipAcc != nil {
+		p.z.reset()
+		for _, sp := range p.path {
+			p.z.polygon(sp)
+		}
+		if mask := p.z.mask(p.clip, p.clipRule); mask != nil {
+			union(p.clipAcc, mask)
+		}
+		return
+	}
+
+	if p.fill != nil {
+		p.z.reset()
+		for _, sp := range p.path {
+			p.z.polygon(sp)
+		}
+		p.draw(p.fill, p.fillRule)
+	}
+
+	if p.stroke != nil && p.style.width > 0 {
+		style := p.style
+		style.width *= p.scale
+
+		p.z.reset()
+		for i, sp := range p.path {
+			p.z.stroke(sp, p.closed[i], style)
+		}
+		p.draw(p.stroke, iconpack.FillNonZero)
+	}
+}
+
+// draw paints src through the rasterizer coverage mask.
+func (p *painter) draw(src image.Image, rule iconpack.FillRule) {
+	mask := p.z.mask(p.clip, rule)
+	if mask == nil {
+		return
+	}
+	if p.clipMask != nil {
+		intersect(mask, p.clipMask)
+	}
+
+	draw.DrawMask(p.dst, mask.Rect, src, mask.Rect.Min, mask, mask.Rect.Min, draw.Over)
+}
+
+// endClip intersects the clip region with the
+// clip paths collected since PushClip.
+func (p *painter) endClip() {
+	if p.clipAcc == nil {
+		return
+	}
+	if p.clipMask != nil {
+		intersect(p.clipAcc, p.clipMask)
+	}
+	p.clipMask, p.clipAcc = p.clipAcc, nil
+}
+
+// union adds coverage m to dst.
+func union(dst, m *image.Alpha) {
+	r := m.Rect.Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		d := dst.Pix[dst.PixOffset(r.Min.X, y):]
+		s := m.Pix[m.PixOffset(r.Min.X, y):]
+		for i := 0; i < r.Dx(); i++ {
+			a, b := int(d[i]), int(s[i])
+			d[i] = uint8(a + b - (a*b+0x7f)/0xff)
+		}
+	}
+}
+
+// intersect multiplies the coverage in dst with m.
+// Coverage outside m is cleared.
+func intersect(dst, m *image.Alpha) {
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		d := dst.Pix[dst.PixOffset(dst.Rect.Min.X, y):]
+		for i := 0; i < dst.Rect.Dx(); i++ {
+			x := dst.Rect.Min.X + i
+			if !(image.Point{x, y}).In(m.Rect) {
+				d[i] = 0
+				continue
+			}
+			d[i] = uint8((int(d[i])*int(m.Pix[m.PixOffset(x, y)]) + 0x7f) / 0xff)
+		}
+	}
+}
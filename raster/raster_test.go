@@ -0,0 +1,348 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+// 1 byte coordinate
+func c1(v int) byte {
+	return byte(v+64)<<1 | 0x01
+}
+
+func TestDraw(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x02, 0x00,
+		0x70, c1(3), c1(3),
+		0x82, c1(13), c1(3), c1(13), c1(13), c1(3), c1(13),
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pal := iconpack.Palette{{0xff, 0, 0, 0xff}}
+
+	tests := []struct {
+		size int
+		x, y int
+		want uint8 // alpha
+	}{
+		{16, 8, 8, 0xff},
+		{16, 1, 1, 0},
+		{16, 13, 8, 0},
+		{16, 12, 12, 0xff},
+		{8, 1, 3, 0x80}, // half covered
+		{8, 6, 3, 0x80},
+		{8, 3, 1, 0x80},
+		{8, 1, 1, 0x40}, // quarter covered
+		{32, 16, 16, 0xff},
+	}
+
+	for _, tt := range tests {
+		m := image.NewRGBA(image.Rect(0, 0, tt.size, tt.size))
+		if err := Draw(m, m.Bounds(), prog, &Options{Palette: pal}); err != nil {
+			t.Fatal(err)
+		}
+
+		c := m.RGBAAt(tt.x, tt.y)
+		if d := int(c.A) - int(tt.want); d < -1 || d > 1 {
+			t.Errorf("%d×%d at %d,%d: got alpha %#02x, want %#02x",
+				tt.size, tt.size, tt.x, tt.y, c.A, tt.want)
+		}
+		if c.A != 0 && (c.R != c.A || c.G != 0 || c.B != 0) {
+			t.Errorf("%d×%d at %d,%d: got color %v", tt.size, tt.size, tt.x, tt.y, c)
+		}
+	}
+}
+
+func TestDrawPaletteIndex(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x02, 0x01,
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	err = Draw(m, m.Bounds(), prog, &Options{
+		Palette: iconpack.Palette{color.NRGBA{0, 0, 0, 0xff}},
+	})
+	if _, ok := err.(*iconpack.PaletteIndexError); !ok {
+		t.Errorf("got %v, want palette index error", err)
+	}
+}
+
+func TestDrawPaletteAlpha(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x07, 0x00, 0x80,
+		0x70, c1(0), c1(0),
+		0x82, c1(16), c1(0), c1(16), c1(16), c1(0), c1(16),
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	err = Draw(m, m.Bounds(), prog, &Options{
+		Palette: iconpack.Palette{color.NRGBA{0, 0, 0xff, 0xff}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := m.RGBAAt(8, 8); c.A != 0x80 || c.B != 0x80 || c.R != 0 {
+		t.Errorf("got %v, want half transparent blue", c)
+	}
+}
+
+func TestDrawStroke(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x03,
+		0x11, 0, 0, 0xff, 0xff,
+		0x13, c1(2),
+		0x70, c1(4), c1(4),
+		0x81, c1(12), c1(4), c1(12), c1(12),
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		size int
+		x, y int
+		want uint8 // alpha
+	}{
+		{16, 8, 3, 0xff},
+		{16, 8, 4, 0xff},
+		{16, 8, 2, 0},
+		{16, 8, 5, 0},
+		{16, 8, 8, 0},     // not filled
+		{16, 3, 4, 0},     // butt cap
+		{16, 12, 3, 0xff}, // miter join
+		{16, 11, 11, 0xff},
+		{16, 12, 12, 0}, // butt cap
+		{32, 16, 6, 0xff},
+		{32, 16, 10, 0},
+	}
+
+	for _, tt := range tests {
+		m := image.NewRGBA(image.Rect(0, 0, tt.size, tt.size))
+		if err := Draw(m, m.Bounds(), prog, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		c := m.RGBAAt(tt.x, tt.y)
+		if d := int(c.A) - int(tt.want); d < -1 || d > 1 {
+			t.Errorf("%d×%d at %d,%d: got alpha %#02x, want %#02x",
+				tt.size, tt.size, tt.x, tt.y, c.A, tt.want)
+		}
+	}
+}
+
+func TestDrawClosePath(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x03,
+		0x11, 0, 0, 0xff, 0xff,
+		0x13, c1(2),
+		0x70, c1(4), c1(4),
+		0x82, c1(12), c1(4), c1(12), c1(12), c1(4), c1(12),
+		0x72,
+		0x80, c1(8), c1(8), // starts at 4,4
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	if err := Draw(m, m.Bounds(), prog, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		x, y int
+		want uint8 // alpha
+	}{
+		{3, 8, 0xff}, // closing segment
+		{2, 8, 0},
+		{3, 3, 0xff}, // miter join at start
+		{6, 6, 0xff}, // subpath after ClosePath
+		{10, 6, 0},
+	}
+	for _, tt := range tests {
+		c := m.RGBAAt(tt.x, tt.y)
+		if d := int(c.A) - int(tt.want); d < -1 || d > 1 {
+			t.Errorf("at %d,%d: got alpha %#02x, want %#02x", tt.x, tt.y, c.A, tt.want)
+		}
+	}
+}
+
+func TestDrawArc(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x01, 0, 0, 0xff, 0xff,
+		0x70, c1(2), c1(8),
+		0xc0, c1(1), c1(1), c1(0), 0x02, c1(14), c1(8), // radii scaled to 6
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	if err := Draw(m, m.Bounds(), prog, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		x, y int
+		want uint8 // alpha
+	}{
+		{8, 3, 0xff},
+		{3, 6, 0xff},
+		{12, 6, 0xff},
+		{8, 1, 0},
+		{2, 2, 0},
+		{8, 9, 0},
+	}
+	for _, tt := range tests {
+		c := m.RGBAAt(tt.x, tt.y)
+		if d := int(c.A) - int(tt.want); d < -1 || d > 1 {
+			t.Errorf("at %d,%d: got alpha %#02x, want %#02x", tt.x, tt.y, c.A, tt.want)
+		}
+	}
+}
+
+func TestDrawClip(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x20, 0x00, // clip to left half and top right strip
+		0x70, c1(0), c1(0),
+		0x82, c1(8), c1(0), c1(8), c1(16), c1(0), c1(16),
+		0x70, c1(8), c1(0),
+		0x82, c1(16), c1(0), c1(16), c1(4), c1(8), c1(4),
+		0x20, 0x00, // intersect with top half
+		0x70, c1(0), c1(0),
+		0x82, c1(16), c1(0), c1(16), c1(8), c1(0), c1(8),
+		0x01, 0xff, 0, 0, 0xff,
+		0x70, c1(0), c1(0),
+		0x82, c1(16), c1(0), c1(16), c1(16), c1(0), c1(16),
+		0x21,
+		0x21,
+		0x01, 0, 0, 0xff, 0xff,
+		0x70, c1(12), c1(12),
+		0x82, c1(16), c1(12), c1(16), c1(16), c1(12), c1(16),
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	if err := Draw(m, m.Bounds(), prog, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{2, 2, red},
+		{2, 6, red},
+		{2, 12, color.RGBA{}},
+		{12, 2, red},
+		{12, 6, color.RGBA{}},
+		{14, 14, blue},
+		{10, 14, color.RGBA{}},
+	}
+	for _, tt := range tests {
+		if c := m.RGBAAt(tt.x, tt.y); c != tt.want {
+			t.Errorf("at %d,%d: got %v, want %v", tt.x, tt.y, c, tt.want)
+		}
+	}
+}
+
+func TestDrawFillRule(t *testing.T) {
+	for _, rule := range []iconpack.FillRule{iconpack.FillNonZero, iconpack.FillEvenOdd} {
+		prog, err := iconpack.DecodeProgram([]byte{
+			c1(0), c1(0), c1(16), c1(16),
+			0x04, byte(rule),
+			0x70, c1(2), c1(2),
+			0x82, c1(14), c1(2), c1(14), c1(14), c1(2), c1(14),
+			0x71, c1(6), c1(6),
+			0x82, c1(10), c1(6), c1(10), c1(10), c1(6), c1(10),
+			0x00,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		if err := Draw(m, m.Bounds(), prog, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		want := uint8(0xff)
+		if rule == iconpack.FillEvenOdd {
+			want = 0
+		}
+		if got := m.RGBAAt(8, 8).A; got != want {
+			t.Errorf("fill rule %d: got alpha %#02x in hole, want %#02x", rule, got, want)
+		}
+		if got := m.RGBAAt(4, 8).A; got != 0xff {
+			t.Errorf("fill rule %d: got alpha %#02x, want 0xff", rule, got)
+		}
+	}
+}
+
+func TestDrawGradient(t *testing.T) {
+	prog, err := iconpack.DecodeProgram([]byte{
+		c1(0), c1(0), c1(16), c1(16),
+		0x05, c1(0), c1(0), c1(16), c1(0),
+		0x00, 0x02,
+		0x00, 0x00, 0, 0, 0, 0xff,
+		0xff, 0x01, 0x00, 0xff,
+		0x70, c1(0), c1(0),
+		0x82, c1(16), c1(0), c1(16), c1(16), c1(0), c1(16),
+		0x00,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pal := iconpack.Palette{{0, 0, 0xff, 0xff}}
+
+	m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	if err := Draw(m, m.Bounds(), prog, &Options{Palette: pal}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		x    int
+		want uint8 // blue
+	}{
+		{0, 0x08},
+		{8, 0x88},
+		{15, 0xf8},
+	}
+	for _, tt := range tests {
+		c := m.RGBAAt(tt.x, 8)
+		if d := int(c.B) - int(tt.want); d < -1 || d > 1 || c.A != 0xff {
+			t.Errorf("at %d: got %v, want blue %#02x", tt.x, c, tt.want)
+		}
+	}
+}
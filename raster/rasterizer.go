@@ -0,0 +1,243 @@
+package raster
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+// subsamples is the number of vertical samples per pixel row.
+const subsamples = 16
+
+// flatness is the maximum distance in pixels between
+// curves and their line segment approximations.
+const flatness = 0.1
+
+type point struct {
+	x, y float64
+}
+
+func (p point) add(q point) point      { return point{p.x + q.x, p.y + q.y} }
+func (p point) sub(q point) point      { return point{p.x - q.x, p.y - q.y} }
+func (p point) mul(f float64) point    { return point{p.x * f, p.y * f} }
+func (p point) dot(q point) float64    { return p.x*q.x + p.y*q.y }
+func (p point) cross(q point) float64  { return p.x*q.y - p.y*q.x }
+func (p point) len() float64           { return math.Hypot(p.x, p.y) }
+func (p point) normal() point          { return point{-p.y, p.x} }
+func lerp(p, q point, t float64) point { return p.add(q.sub(p).mul(t)) }
+
+// flattenQuad appends the line segment approximation of the
+// quadratic Bézier curve from the last point in pts to pts.
+func flattenQuad(pts []point, p1, p2 point) []point {
+	p0 := pts[len(pts)-1]
+	dd := p0.sub(p1.mul(2)).add(p2).len()
+	n := segments(dd / (4 * flatness))
+	for i := 1; i < n; i++ {
+		t := float64(i) / float64(n)
+		pts = append(pts, lerp(lerp(p0, p1, t), lerp(p1, p2, t), t))
+	}
+	return append(pts, p2)
+}
+
+// flattenCubic appends the line segment approximation of the
+// cubic Bézier curve from the last point in pts to pts.
+func flattenCubic(pts []point, p1, p2, p3 point) []point {
+	p0 := pts[len(pts)-1]
+	dd := math.Max(
+		p0.sub(p1.mul(2)).add(p2).len(),
+		p1.sub(p2.mul(2)).add(p3).len())
+	n := segments(0.75 * dd / flatness)
+	for i := 1; i < n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+		pts = append(pts, point{
+			x: a*p0.x + b*p1.x + c*p2.x + d*p3.x,
+			y: a*p0.y + b*p1.y + c*p2.y + d*p3.y,
+		})
+	}
+	return append(pts, p3)
+}
+
+// segments returns the number of line segments needed
+// for a curve with squared segment count estimate nsq.
+func segments(nsq float64) int {
+	const maxSegments = 256
+	n := int(math.Ceil(math.Sqrt(nsq)))
+	if n < 1 {
+		return 1
+	}
+	if n > maxSegments {
+		return maxSegments
+	}
+	return n
+}
+
+// edge is a path line segment with y0 < y1.
+type edge struct {
+	x0, y0, x1, y1 float64
+	dir            int // winding direction
+}
+
+// rasterizer computes path coverage masks.
+type rasterizer struct {
+	edges []edge
+
+	// scratch buffers
+	active []edge
+	cross  []crossing
+	acc    []float64
+}
+
+type crossing struct {
+	x   float64
+	dir int
+}
+
+func (z *rasterizer) reset() {
+	z.edges = z.edges[:0]
+}
+
+func (z *rasterizer) line(p, q point) {
+	if p.y == q.y {
+		return // horizontal edges don't contribute to coverage
+	}
+	if p.y < q.y {
+		z.edges = append(z.edges, edge{p.x, p.y, q.x, q.y, 1})
+	} else {
+		z.edges = append(z.edges, edge{q.x, q.y, p.x, p.y, -1})
+	}
+}
+
+// polygon adds the edges of the closed polygon pts.
+func (z *rasterizer) polygon(pts []point) {
+	if len(pts) < 2 {
+		return
+	}
+	prev := pts[len(pts)-1]
+	for _, p := range pts {
+		z.line(prev, p)
+		prev = p
+	}
+}
+
+// bounds returns the pixel bounds of the edges.
+func (z *rasterizer) bounds() image.Rectangle {
+	if len(z.edges) == 0 {
+		return image.Rectangle{}
+	}
+	x0, y0 := math.Inf(1), math.Inf(1)
+	x1, y1 := math.Inf(-1), math.Inf(-1)
+	for _, e := range z.edges {
+		x0 = math.Min(x0, math.Min(e.x0, e.x1))
+		x1 = math.Max(x1, math.Max(e.x0, e.x1))
+		y0 = math.Min(y0, e.y0)
+		y1 = math.Max(y1, e.y1)
+	}
+	return image.Rect(
+		int(math.Floor(x0)), int(math.Floor(y0)),
+		int(math.Ceil(x1)), int(math.Ceil(y1)))
+}
+
+// mask returns the coverage mask of the path within clip
+// using the fill rule rule.
+// It returns nil if the path doesn't cover any pixels in clip.
+func (z *rasterizer) mask(clip image.Rectangle, rule iconpack.FillRule) *image.Alpha {
+	r := z.bounds().Intersect(clip)
+	if r.Empty() {
+		return nil
+	}
+
+	m := image.NewAlpha(r)
+
+	dx := r.Dx()
+	if cap(z.acc) < dx {
+		z.acc = make([]float64, dx)
+	}
+	acc := z.acc[:dx]
+
+	sort.Slice(z.edges, func(i, j int) bool {
+		return z.edges[i].y0 < z.edges[j].y0
+	})
+	next := 0 // next edge to activate
+	z.active = z.active[:0]
+
+	const w = 1.0 / subsamples
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for i := range acc {
+			acc[i] = 0
+		}
+
+		for s := 0; s < subsamples; s++ {
+			sy := float64(y) + (float64(s)+0.5)*w
+
+			// update active edges
+			for next < len(z.edges) && z.edges[next].y0 <= sy {
+				z.active = append(z.active, z.edges[next])
+				next++
+			}
+			z.cross = z.cross[:0]
+			n := 0
+			for _, e := range z.active {
+				if sy >= e.y1 {
+					continue // edge done
+				}
+				z.active[n] = e
+				n++
+				x := e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0)
+				z.cross = append(z.cross, crossing{x, e.dir})
+			}
+			z.active = z.active[:n]
+
+			sort.Slice(z.cross, func(i, j int) bool {
+				return z.cross[i].x < z.cross[j].x
+			})
+
+			winding := 0
+			for i, c := range z.cross {
+				winding += c.dir
+				inside := winding != 0
+				if rule == iconpack.FillEvenOdd {
+					inside = winding&1 != 0
+				}
+				if inside && i+1 < len(z.cross) {
+					addSpan(acc, c.x-float64(r.Min.X), z.cross[i+1].x-float64(r.Min.X), w)
+				}
+			}
+		}
+
+		row := m.Pix[(y-r.Min.Y)*m.Stride:]
+		for i, a := range acc {
+			if a >= 1 {
+				row[i] = 0xff
+			} else if a > 0 {
+				row[i] = uint8(a*0xff + 0.5)
+			}
+		}
+	}
+
+	return m
+}
+
+// addSpan adds coverage w to acc for the horizontal span [x0, x1).
+func addSpan(acc []float64, x0, x1, w float64) {
+	if x0 < 0 {
+		x0 = 0
+	}
+	if n := float64(len(acc)); x1 > n {
+		x1 = n
+	}
+	if x0 >= x1 {
+		return
+	}
+
+	i0 := int(x0)
+	i1 := int(math.Ceil(x1))
+	for i := i0; i < i1; i++ {
+		l := math.Max(x0, float64(i))
+		r := math.Min(x1, float64(i+1))
+		acc[i] += (r - l) * w
+	}
+}
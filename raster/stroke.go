@@ -0,0 +1,188 @@
+package raster
+
+import (
+	"math"
+
+	"github.com/tajtiattila/vector-icon/iconpack"
+)
+
+// strokeStyle specifies how paths are stroked.
+type strokeStyle struct {
+	width      float64
+	cap        iconpack.LineCap
+	join       iconpack.LineJoin
+	miterLimit float64
+}
+
+// stroke adds the outline of the polyline pts to z.
+// Closed polylines have joins instead of caps at their ends.
+//
+// The outline is the union of polygons for segments, joins and caps.
+// Each polygon is added with the same orientation so that
+// the nonzero winding rule yields their union.
+func (z *rasterizer) stroke(pts []point, closed bool, s strokeStyle) {
+	pts = dedup(pts)
+	hw := s.width / 2
+	if hw <= 0 || len(pts) == 0 {
+		return
+	}
+
+	if closed && len(pts) > 1 {
+		if pts[len(pts)-1] == pts[0] {
+			pts = pts[:len(pts)-1]
+		}
+		if len(pts) > 1 {
+			z.strokeClosed(pts, hw, s)
+			return
+		}
+	}
+
+	if len(pts) == 1 {
+		// zero length subpath
+		p := pts[0]
+		switch s.cap {
+		case iconpack.CapRound:
+			z.circle(p, hw)
+		case iconpack.CapSquare:
+			z.convex(
+				point{p.x - hw, p.y - hw}, point{p.x + hw, p.y - hw},
+				point{p.x + hw, p.y + hw}, point{p.x - hw, p.y + hw})
+		}
+		return
+	}
+
+	last := len(pts) - 1
+	for i := 0; i < last; i++ {
+		a, b := pts[i], pts[i+1]
+		d := b.sub(a)
+		d = d.mul(1 / d.len())
+		if s.cap == iconpack.CapSquare {
+			if i == 0 {
+				a = a.sub(d.mul(hw))
+			}
+			if i+1 == last {
+				b = b.add(d.mul(hw))
+			}
+		}
+		n := d.normal().mul(hw)
+		z.convex(a.add(n), b.add(n), b.sub(n), a.sub(n))
+	}
+
+	for i := 1; i < last; i++ {
+		z.join(pts[i-1], pts[i], pts[i+1], hw, s)
+	}
+
+	if s.cap == iconpack.CapRound {
+		z.circle(pts[0], hw)
+		z.circle(pts[last], hw)
+	}
+}
+
+// strokeClosed adds the outline of the closed polyline pts
+// without duplicate points.
+func (z *rasterizer) strokeClosed(pts []point, hw float64, s strokeStyle) {
+	n := len(pts)
+	for i := range pts {
+		a, b := pts[i], pts[(i+1)%n]
+		d := b.sub(a)
+		d = d.mul(1 / d.len())
+		m := d.normal().mul(hw)
+		z.convex(a.add(m), b.add(m), b.sub(m), a.sub(m))
+	}
+
+	for i := range pts {
+		z.join(pts[(i+n-1)%n], pts[i], pts[(i+1)%n], hw, s)
+	}
+}
+
+// join adds the join polygon at p between segments p0→p and p→p1.
+func (z *rasterizer) join(p0, p, p1 point, hw float64, s strokeStyle) {
+	d0 := p.sub(p0)
+	d0 = d0.mul(1 / d0.len())
+	d1 := p1.sub(p)
+	d1 = d1.mul(1 / d1.len())
+
+	cross := d0.cross(d1)
+	dot := d0.dot(d1)
+	if math.Abs(cross) < 1e-9 && dot > 0 {
+		return // collinear
+	}
+
+	if s.join == iconpack.JoinRound {
+		z.circle(p, hw)
+		return
+	}
+
+	// outer side of the turn
+	side := hw
+	if cross > 0 {
+		side = -hw
+	}
+	n0 := d0.normal()
+	n1 := d1.normal()
+	a := p.add(n0.mul(side))
+	b := p.add(n1.mul(side))
+
+	// miter length relative to stroke width
+	if s.join == iconpack.JoinMiter && 1+dot > 1e-9 {
+		if ratio := math.Sqrt(2 / (1 + dot)); ratio <= s.miterLimit {
+			tip := p.add(n0.add(n1).mul(side / (1 + dot)))
+			z.convex(p, a, tip, b)
+			return
+		}
+	}
+
+	z.convex(p, a, b)
+}
+
+// circle adds a circle polygon with center c and radius r.
+func (z *rasterizer) circle(c point, r float64) {
+	n := 8
+	if r > flatness {
+		n = int(math.Ceil(math.Pi / math.Acos(1-flatness/r)))
+		if n < 8 {
+			n = 8
+		}
+		if n > 256 {
+			n = 256
+		}
+	}
+
+	pts := make([]point, n)
+	for i := range pts {
+		sin, cos := math.Sincos(float64(i) * 2 * math.Pi / float64(n))
+		pts[i] = point{c.x + r*cos, c.y + r*sin}
+	}
+	z.convex(pts...)
+}
+
+// convex adds the polygon pts with positive orientation.
+func (z *rasterizer) convex(pts ...point) {
+	var area float64
+	prev := pts[len(pts)-1]
+	for _, p := range pts {
+		area += prev.cross(p)
+		prev = p
+	}
+	if area < 0 {
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	z.polygon(pts)
+}
+
+// dedup returns pts with consecutive duplicate points removed.
+func dedup(pts []point) []point {
+	if len(pts) < 2 {
+		return pts
+	}
+	v := make([]point, 1, len(pts))
+	v[0] = pts[0]
+	for _, p := range pts[1:] {
+		if p != v[len(v)-1] {
+			v = append(v, p)
+		}
+	}
+	return v
+}